@@ -0,0 +1,850 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/LoupLobet/swb/swb"
+)
+
+// ExitEnvironment is the exit status of swb when a site failed because of
+// its environment (e.g. a read-only dst tree) rather than its content.
+const ExitEnvironment = 3
+
+var (
+	ConfigPath  = flag.String("c", "config.json", "Configuration file")
+	WorkingDir  = flag.String("w", ".", "Working directory")
+	EnvFlag     = flag.String("env", "", "Profile of the configuration to apply (e.g. prod)")
+	WaitFlag    = flag.Bool("wait", false, "Wait for the other swb processes using the dst trees rather than failing")
+	QuietFlag   = flag.Bool("q", false, "Only print errors and a summary")
+	VerboseFlag = flag.Bool("v", false, "Print the commands run and their durations")
+	DebugFlag   = flag.Bool("vv", false, "Like -v, and print the files which are up to date")
+	LogFormat   = flag.String("log-format", "text", "Format of the output, text or json (one JSON object per event)")
+	JSONFlag    = flag.Bool("json", false, "Same as -log-format=json")
+	NoSandbox   = flag.Bool("no-sandbox", false, "Do not restrict swb with pledge(2) and unveil(2) on OpenBSD")
+	// The flags of the commands, before there were commands.
+	CleanFlag = flag.Bool("k", false, "Clean the dst trees (see clean)")
+	BuildFlag = flag.Bool("b", false, "Build the dst trees (see build)")
+	WatchFlag = flag.Bool("watch", false, "Rebuild the sites whenever their sources change (see build)")
+)
+
+// commands are the commands of swb, with a summary of their usage.
+var commands = []struct{ name, usage string }{
+	{"build", "Build the dst trees"},
+	{"clean", "Clean the dst trees"},
+	{"serve", "Serve a site, rebuilding it whenever its sources change"},
+	{"daemon", "Rebuild the sites when receiving webhooks"},
+	{"verify", "Check that the dst trees are in sync with their src trees"},
+	{"check", "Check the internal links of the dst trees"},
+	{"deploy", "Upload the dst trees to their deployment targets"},
+	{"snapshot", "Record the metadata of a site"},
+	{"replay", "Replay the build of a snapshot"},
+	{"new", "Create a new page"},
+	{"page", "Render a page to the standard output"},
+	{"init", "Create a new project"},
+	{"import", "Import an existing HTML site"},
+}
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage of swb:\n  swb [flags] command [command flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s%s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+var out *swb.Logger
+
+// siteFailed reports the failure of the site.
+func siteFailed(site *swb.Site, err error) {
+	out.Error(site, fmt.Sprintf("site %s failed", site.Name), err)
+}
+
+// fatalf reports an error, and exits.
+func fatalf(format string, args ...any) {
+	out.Error(nil, fmt.Sprintf(format, args...), nil)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *JSONFlag {
+		*LogFormat = "json"
+	}
+	if *LogFormat != "text" && *LogFormat != "json" {
+		fmt.Fprintf(os.Stderr, "unknown log format %s\n", *LogFormat)
+		flag.Usage()
+		os.Exit(2)
+	}
+	level := swb.LevelNormal
+	switch {
+	case *QuietFlag:
+		level = swb.LevelQuiet
+	case *DebugFlag:
+		level = swb.LevelDebug
+	case *VerboseFlag:
+		level = swb.LevelVerbose
+	}
+	w := os.Stdout
+	if flag.Arg(0) == "page" {
+		// The standard output is the page's.
+		w = os.Stderr
+	}
+	out = swb.NewLogger(w, level, *LogFormat == "json")
+	workingDir, err := swb.ExpandPath(*WorkingDir)
+	if err != nil {
+		fatalf("invalid working directory: %v", err)
+	}
+	if err := os.Chdir(workingDir); err != nil {
+		fatalf("cannot change working directory: %v", err)
+	}
+	if flag.NArg() == 0 {
+		if !*CleanFlag && !*BuildFlag {
+			flag.Usage()
+			os.Exit(2)
+		}
+		runSites(loadConfig(), *CleanFlag, *BuildFlag, *WatchFlag, false, false, "")
+		return
+	}
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "build":
+		build(args)
+	case "clean":
+		clean(args)
+	case "serve":
+		serve(args)
+	case "daemon":
+		daemon(args)
+	case "verify":
+		verify(args)
+	case "check":
+		check(args)
+	case "deploy":
+		deploy(args)
+	case "snapshot":
+		snapshot(args)
+	case "replay":
+		replay(args)
+	case "new":
+		newPage(args)
+	case "page":
+		renderPage(args)
+	case "init":
+		initProject(args)
+	case "import":
+		importSite(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func loadConfig() *swb.Config {
+	configPath := findConfig()
+	config, err := swb.LoadProfile(configPath, *EnvFlag)
+	if err != nil {
+		// Indent the problems after the first one.
+		fatalf("cannot read config: %s", strings.ReplaceAll(err.Error(), "\n", "\n\t"))
+	}
+	if *VerboseFlag || *DebugFlag {
+		out.Info(nil, "config "+configPath)
+	}
+	config.Progress = out
+	config.Wait = *WaitFlag
+	return config
+}
+
+// patterns is a flag of glob patterns, which can be given more than once.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	*p = append(*p, pattern)
+	return nil
+}
+
+func build(args []string) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	clean := flags.Bool("clean", false, "Clean the dst trees before building them")
+	watch := flags.Bool("watch", false, "Rebuild the sites whenever their sources change")
+	drafts := flags.Bool("drafts", false, "Build the draft pages too")
+	future := flags.Bool("future", false, "Build the pages dated in the future too")
+	name := flags.String("site", "", "Name of the site to build (default all of them)")
+	var only patterns
+	flags.Var(&only, "only", "Only build the files of the src trees matching this pattern (can be repeated)")
+	var dryRun bool
+	flags.BoolVar(&dryRun, "n", false, "Print what would be done, without doing it")
+	flags.BoolVar(&dryRun, "dry-run", false, "Same as -n")
+	var force bool
+	flags.BoolVar(&force, "f", false, "Rebuild every page and place every asset again, even if up to date")
+	flags.BoolVar(&force, "force", false, "Same as -f")
+	var keepGoing bool
+	flags.BoolVar(&keepGoing, "k", false, "Build the next sites when one fails, and print a summary")
+	flags.BoolVar(&keepGoing, "keep-going", false, "Same as -k")
+	reportPath := flags.String("report", "", "Write a JSON report of the build to this file")
+	profile := flags.Bool("profile", false, "Print the time of the phases of each site, and its slowest files and commands")
+	flags.Parse(args)
+	config := loadConfig()
+	config.Drafts = config.Drafts || *drafts
+	config.Future = config.Future || *future
+	config.DryRun = dryRun
+	config.Force = force
+	config.Only = only
+	selectSite(config, *name)
+	runSites(config, *clean, true, *watch, keepGoing, *profile, *reportPath)
+}
+
+func clean(args []string) {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	name := flags.String("site", "", "Name of the site to clean (default all of them)")
+	var dryRun bool
+	flags.BoolVar(&dryRun, "n", false, "Print what would be removed, without removing it")
+	flags.BoolVar(&dryRun, "dry-run", false, "Same as -n")
+	force := flags.Bool("force", false, "Clean the dst trees even if they overlap their src tree or do not look like ones")
+	flags.Parse(args)
+	config := loadConfig()
+	config.DryRun = dryRun
+	config.ForceClean = *force
+	selectSite(config, *name)
+	runSites(config, true, false, false, false, false, "")
+}
+
+// selectSite leaves only the site called name in the configuration, unless
+// name is empty.
+func selectSite(config *swb.Config, name string) {
+	if err := config.SelectSite(name); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// slowest is the number of the slowest files and commands of a site printed
+// with -profile.
+const slowest = 10
+
+// runSites cleans and builds the sites, and then watches them if asked to.
+// A site failing because of its content stops swb, unless it keeps going:
+// the next sites are then processed, and a summary counting the sites (not
+// their pages) built, failed and skipped is printed. The total of the sites
+// processed is printed either way. The timings of each site are printed if
+// profile is set, and the report of the sites processed is written to
+// reportPath, if not empty.
+func runSites(config *swb.Config, clean, build, watching, keepGoing, profile bool, reportPath string) {
+	envFailed, failed := false, false
+	var nbuilt, nfailed, nskipped int
+	var results []swb.SiteResult
+	if !watching {
+		// The configuration is reloaded when watching, so that the new
+		// sites would be out of reach.
+		sandbox(config, false)
+	}
+	for _, site := range config.Sites {
+		out.Start(site)
+		res := run(config, site, clean, build)
+		results = append(results, res)
+		err := res.Err
+		out.Summary(site, err)
+		if profile {
+			out.Timings(site, swb.NewTimings(res.Report, slowest))
+		}
+		switch {
+		case err != nil:
+			nfailed++
+		case len(res.Report.Built)+len(res.Report.Linked)+len(res.Report.Removed) > 0:
+			nbuilt++
+		default:
+			nskipped++
+		}
+		if err != nil {
+			siteFailed(site, err)
+			if swb.IsEnvironmental(err) || watching {
+				// Other sites may not be affected.
+				envFailed = true
+				continue
+			}
+			failed = true
+			if !keepGoing {
+				break
+			}
+		}
+	}
+	out.Total()
+	writeReport(reportPath, results)
+	if keepGoing {
+		out.Info(nil, fmt.Sprintf("summary of %d sites: %d built, %d failed, %d skipped (up to date)", len(config.Sites), nbuilt, nfailed, nskipped))
+	}
+	if watching {
+		watch(config)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	if envFailed {
+		os.Exit(ExitEnvironment)
+	}
+}
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	name := flags.String("site", "", "Name of the site to serve (default the first one)")
+	addr := flags.String("addr", "localhost:8000", "Address to listen on")
+	drafts := flags.Bool("drafts", false, "Build the draft pages too")
+	future := flags.Bool("future", false, "Build the pages dated in the future too")
+	flags.Parse(args)
+	config := loadConfig()
+	config.Drafts = config.Drafts || *drafts
+	config.Future = config.Future || *future
+	if len(config.Sites) == 0 {
+		fatalf("no site to serve")
+	}
+	site := config.Sites[0]
+	if *name != "" {
+		i := slices.IndexFunc(config.Sites, func(site *swb.Site) bool { return site.Name == *name })
+		if i < 0 {
+			fatalf("no site named %s", *name)
+		}
+		site = config.Sites[i]
+	}
+	sandbox(config, true)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out.Start(site)
+	_, err := config.BuildSite(ctx, site)
+	out.Summary(site, err)
+	if err != nil {
+		siteFailed(site, err)
+	}
+	host := *addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	out.Info(site, fmt.Sprintf("serving %s at http://%s/", site.DstRoot, host))
+	out.Start(site)
+	err = config.Serve(ctx, site, *addr, func(site *swb.Site, report swb.Report, err error) {
+		out.Summary(site, err)
+		if err != nil {
+			siteFailed(site, err)
+		}
+		out.Start(site)
+	})
+	if err != nil {
+		fatalf("cannot serve site %s: %v", site.Name, err)
+	}
+}
+
+// daemon rebuilds a site whenever a signed webhook names it, until swb is
+// interrupted.
+func daemon(args []string) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "Address to listen on")
+	pull := flags.Bool("pull", false, "Update the src tree of a site with git pull before building it")
+	secretFile := flags.String("secret-file", "", "File holding the secret of the webhooks (default $SWB_WEBHOOK_SECRET)")
+	metrics := flags.Bool("metrics", false, "Serve metrics of the builds at /metrics, in the Prometheus format")
+	flags.Parse(args)
+	secret := []byte(os.Getenv("SWB_WEBHOOK_SECRET"))
+	if *secretFile != "" {
+		b, err := os.ReadFile(*secretFile)
+		if err != nil {
+			fatalf("cannot read webhook secret: %v", err)
+		}
+		secret = bytes.TrimSpace(b)
+	}
+	if len(secret) == 0 {
+		fatalf("no webhook secret, set $SWB_WEBHOOK_SECRET or give -secret-file")
+	}
+	config := loadConfig()
+	if *metrics {
+		config.Metrics = swb.NewMetrics()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	host := *addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	out.Info(nil, fmt.Sprintf("listening for webhooks at http://%s/webhook/<site>", host))
+	if *metrics {
+		out.Info(nil, fmt.Sprintf("serving metrics at http://%s/metrics", host))
+	}
+	for _, site := range config.Sites {
+		out.Start(site)
+	}
+	err := config.Daemon(ctx, *addr, secret, *pull, func(site *swb.Site, report swb.Report, err error) {
+		out.Summary(site, err)
+		if err != nil {
+			siteFailed(site, err)
+		}
+		out.Start(site)
+	}, reloaded)
+	if err != nil {
+		fatalf("cannot run the daemon: %v", err)
+	}
+}
+
+// watch rebuilds the sites whenever their sources change, until swb is
+// interrupted.
+func watch(config *swb.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for _, site := range config.Sites {
+		out.Start(site)
+	}
+	err := config.Watch(ctx, func(site *swb.Site, report swb.Report, err error) {
+		out.Summary(site, err)
+		if err != nil {
+			siteFailed(site, err)
+		}
+		out.Start(site)
+	}, reloaded)
+	if err != nil {
+		fatalf("cannot watch the sites: %v", err)
+	}
+}
+
+// reloaded reports the changes of the configuration reloaded by watch or
+// daemon, or why it could not be, the current one being kept.
+func reloaded(changes []string, err error) {
+	if err != nil {
+		out.Error(nil, "cannot reload config, keeping the current one", err)
+		return
+	}
+	if len(changes) == 0 {
+		out.Info(nil, "config reloaded, unchanged")
+		return
+	}
+	for _, change := range changes {
+		out.Info(nil, "config reloaded: "+change)
+	}
+}
+
+// sandbox restricts swb to the sites of the configuration, and to the
+// network if network is set, unless -no-sandbox is given.
+func sandbox(config *swb.Config, network bool) {
+	if *NoSandbox {
+		return
+	}
+	if err := config.Sandbox(network); err != nil {
+		fatalf("cannot sandbox swb: %v", err)
+	}
+}
+
+// run cleans and builds the site, and reports whether its dst tree changed.
+func run(config *swb.Config, site *swb.Site, clean, build bool) (res swb.SiteResult) {
+	ctx := context.Background()
+	res.Site = site
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+	if clean {
+		res.Report, res.Err = config.CleanSite(ctx, site)
+		if res.Err != nil {
+			return res
+		}
+	}
+	if build {
+		cleaned := res.Report
+		res.Report, res.Err = config.BuildSite(ctx, site)
+		res.Report.Removed = append(cleaned.Removed, res.Report.Removed...)
+		res.Report.Warnings = append(cleaned.Warnings, res.Report.Warnings...)
+		if res.Report.Phases == nil {
+			res.Report.Phases = make(map[string]time.Duration)
+		}
+		for phase, d := range cleaned.Phases {
+			res.Report.Phases[phase] += d
+		}
+	}
+	return res
+}
+
+// writeReport writes the report of the results of the sites to path, unless
+// it is empty.
+func writeReport(path string, results []swb.SiteResult) {
+	if path == "" {
+		return
+	}
+	if err := swb.WriteReport(path, results); err != nil {
+		fatalf("cannot write report: %v", err)
+	}
+}
+
+// configNames are the configuration files looked for in the working
+// directory, when none is given.
+var configNames = []string{"swb.json", "config.json", "swb.toml", "swb.yaml", "swb.yml"}
+
+// userConfigNames are the configuration files looked for then in the swb
+// directory of the user's configuration directory.
+var userConfigNames = []string{"config.json", "config.toml", "config.yaml", "config.yml"}
+
+// userConfigDir returns the swb directory of the user's configuration
+// directory: $XDG_CONFIG_HOME/swb, or else the default one of the system
+// (e.g. ~/.config/swb).
+func userConfigDir() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return ""
+		}
+	}
+	return filepath.Join(dir, "swb")
+}
+
+// findConfig returns the path of the configuration file: the one given with
+// -c, or else the first of configNames found in the working directory, or
+// else the first of userConfigNames found in userConfigDir.
+func findConfig() string {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "c" {
+			explicit = true
+		}
+	})
+	if explicit {
+		return *ConfigPath
+	}
+	candidates := slices.Clone(configNames)
+	if dir := userConfigDir(); dir != "" {
+		for _, name := range userConfigNames {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+	for _, name := range candidates {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	fatalf("no configuration file found, looked for %s (use -c to give one)", strings.Join(candidates, ", "))
+	return ""
+}
+
+func initProject(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	name := flags.String("name", "example.com", "Name of the site")
+	force := flags.Bool("force", false, "Overwrite existing files")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of init:\n  swb init [flags] [dir]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	dir := "."
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		dir = flags.Arg(0)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err := swb.Init(dir, *name, *force, os.Stdout); err != nil {
+		fatalf("could not init %s: %v", dir, err)
+	}
+}
+
+func newPage(args []string) {
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of new:\n  swb new site path\n")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	name, rel := flags.Arg(0), flags.Arg(1)
+	config := loadConfig()
+	i := slices.IndexFunc(config.Sites, func(site *swb.Site) bool { return site.Name == name })
+	if i < 0 {
+		fatalf("no site named %s", name)
+	}
+	srcPath, err := config.NewPage(context.Background(), config.Sites[i], rel, time.Now())
+	if err != nil {
+		fatalf("could not create page %s: %v", rel, err)
+	}
+	out.Action(config.Sites[i], swb.ActionBuild, srcPath, 0)
+}
+
+func renderPage(args []string) {
+	flags := flag.NewFlagSet("page", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of page:\n  swb page [-site name] path\n  swb page [-site name] [-as path] < page\n")
+		flags.PrintDefaults()
+	}
+	name := flags.String("site", "", "Name of the site of the page (default the one whose src tree holds it, or the first one)")
+	as := flags.String("as", "", "Path of the page read on the standard input (default stdin, with the extension of the builder, at the root of the src tree)")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	config := loadConfig()
+	pagePath := flags.Arg(0)
+	var src []byte
+	if pagePath == "" || pagePath == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fatalf("cannot read page: %v", err)
+		}
+		src, pagePath = b, *as
+	}
+	site, srcPath := pageSite(config, *name, pagePath)
+	page, err := config.RenderPage(context.Background(), site, srcPath, src)
+	if err != nil {
+		if srcPath == "" {
+			srcPath = "from the standard input"
+		}
+		fatalf("cannot render page %s: %s", srcPath, swb.FormatErrors(err))
+	}
+	os.Stdout.Write(page)
+}
+
+// pageSite returns the site of the page at pagePath (a path of its src
+// tree, or relative to it if the site is named), and the path of the page
+// under its SrcRoot. An empty pagePath is the one of a page read on the
+// standard input, left to RenderPage.
+func pageSite(config *swb.Config, name, pagePath string) (*swb.Site, string) {
+	if name == "" {
+		if pagePath != "" {
+			site, srcPath, err := config.SiteOf(pagePath)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			return site, srcPath
+		}
+		if len(config.Sites) == 0 {
+			fatalf("no site to render the page of")
+		}
+		name = config.Sites[0].Name
+	}
+	i := slices.IndexFunc(config.Sites, func(site *swb.Site) bool { return site.Name == name })
+	if i < 0 {
+		fatalf("no site named %s", name)
+	}
+	site := config.Sites[i]
+	if pagePath == "" {
+		return site, ""
+	}
+	if s, srcPath, err := config.SiteOf(pagePath); err == nil && s == site {
+		return site, srcPath
+	}
+	return site, filepath.Join(site.SrcRoot, pagePath)
+}
+
+func importSite(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	from := flags.String("from", "", "Directory of the existing HTML site")
+	to := flags.String("to", "", "Directory of the src tree to create")
+	tplOut := flags.String("tpl-out", "", "Path of the template to create")
+	ext := flags.String("ext", ".md", "Extension of the page sources")
+	force := flags.Bool("force", false, "Overwrite existing files")
+	flags.Parse(args)
+	if *from == "" || *to == "" || *tplOut == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err := swb.Import(*from, *to, *tplOut, *ext, *force, os.Stdout); err != nil {
+		fatalf("could not import %s: %v", *from, err)
+	}
+}
+
+func verify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	provenance := flags.Bool("provenance", false, "Check the dst trees against their provenance record rather than a build")
+	name := flags.String("site", "", "Name of the site to verify (default all of them)")
+	flags.Parse(args)
+	config := loadConfig()
+	selectSite(config, *name)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var failed error
+	for _, site := range config.Sites {
+		if *provenance {
+			if err := config.VerifyProvenance(site); err != nil {
+				out.Error(site, "could not verify site "+site.Name, err)
+				failed = errors.Join(failed, err)
+				continue
+			}
+			out.Action(site, swb.ActionVerify, site.DstRoot, 0)
+			continue
+		}
+		diffs, err := config.Verify(ctx, site)
+		if err != nil {
+			out.Error(site, "could not verify site "+site.Name, err)
+			failed = errors.Join(failed, err)
+			continue
+		}
+		for _, d := range diffs {
+			out.Warn(site, filepath.Join(site.DstRoot, filepath.FromSlash(d.Path)), d.Kind)
+		}
+		if len(diffs) > 0 {
+			err := fmt.Errorf("site %s has %d files out of sync with its src tree", site.Name, len(diffs))
+			out.Error(site, err.Error(), nil)
+			failed = errors.Join(failed, err)
+			continue
+		}
+		out.Action(site, swb.ActionVerify, site.DstRoot, 0)
+	}
+	if failed != nil {
+		os.Exit(1)
+	}
+}
+
+func check(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	name := flags.String("site", "", "Name of the site to check (default all of them)")
+	flags.Parse(args)
+	config := loadConfig()
+	selectSite(config, *name)
+	var failed bool
+	for _, site := range config.Sites {
+		broken, err := config.CheckLinks(site)
+		if err != nil {
+			out.Error(site, "could not check site "+site.Name, err)
+			failed = true
+			continue
+		}
+		for _, l := range broken {
+			out.Warn(site, fmt.Sprintf("%s:%d", l.Page, l.Line), "broken link "+l.URL)
+		}
+		if len(broken) > 0 {
+			out.Error(site, fmt.Sprintf("site %s has %d broken links", site.Name, len(broken)), nil)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func deploy(args []string) {
+	flags := flag.NewFlagSet("deploy", flag.ExitOnError)
+	name := flags.String("site", "", "Name of the site to deploy (default all of them)")
+	var dryRun bool
+	flags.BoolVar(&dryRun, "n", false, "Print what would be uploaded and removed, without doing it")
+	flags.BoolVar(&dryRun, "dry-run", false, "Same as -n")
+	flags.Parse(args)
+	config := loadConfig()
+	config.DryRun = dryRun
+	selectSite(config, *name)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var failed error
+	for _, site := range config.Sites {
+		if site.Deploy == nil {
+			if *name != "" {
+				fatalf("site %s has no deploy target", site.Name)
+			}
+			continue
+		}
+		if err := config.Deploy(ctx, site); err != nil {
+			out.Error(site, "could not deploy site "+site.Name, err)
+			failed = errors.Join(failed, err)
+		}
+	}
+	if failed != nil {
+		os.Exit(1)
+	}
+}
+
+func snapshot(args []string) {
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	name := flags.String("site", "", "Name of the site to record")
+	output := flags.String("o", "", "Output file (default stdout)")
+	flags.Parse(args)
+	if *name == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	config := loadConfig()
+	i := slices.IndexFunc(config.Sites, func(site *swb.Site) bool { return site.Name == *name })
+	if i < 0 {
+		fatalf("no site named %s", *name)
+	}
+	snap, err := config.Snapshot(config.Sites[i])
+	if err != nil {
+		fatalf("could not snapshot site %s: %v", *name, err)
+	}
+	b, err := json.MarshalIndent(snap, "", "\t")
+	if err != nil {
+		fatalf("could not snapshot site %s: %v", *name, err)
+	}
+	b = append(b, '\n')
+	if *output == "" {
+		os.Stdout.Write(b)
+		return
+	}
+	if err := os.WriteFile(*output, b, 0644); err != nil {
+		fatalf("could not write snapshot: %v", err)
+	}
+}
+
+func replay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	clean := flags.Bool("clean", false, "Clean the dst tree before building it")
+	keep := flags.Bool("keep", false, "Keep the reconstructed trees")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	b, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fatalf("cannot read snapshot: %v", err)
+	}
+	var snap swb.Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		fatalf("cannot read snapshot: %v", err)
+	}
+	dir, err := os.MkdirTemp("", "swb-replay-")
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *keep {
+		out.Info(nil, "replaying in "+dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	configPath, err := snap.Replay(dir)
+	if err != nil {
+		fatalf("cannot replay snapshot: %v", err)
+	}
+	config, err := swb.LoadConfig(configPath)
+	if err != nil {
+		fatalf("cannot read replayed config: %v", err)
+	}
+	// The decisions are reported like in verbose mode.
+	progress := swb.NewLogger(os.Stdout, swb.LevelVerbose, *LogFormat == "json")
+	config.Progress = progress
+	site := config.Sites[0]
+	ctx := context.Background()
+	if *clean {
+		_, err = config.CleanSite(ctx, site)
+	}
+	if err == nil {
+		_, err = config.BuildSite(ctx, site)
+	}
+	progress.Summary(site, err)
+	if err != nil {
+		siteFailed(site, err)
+	}
+}
@@ -1,3 +1,10 @@
-module swb
+module github.com/LoupLobet/swb
 
 go 1.24.1
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/fsnotify/fsnotify v1.10.1
+	golang.org/x/sys v0.13.0
+	gopkg.in/yaml.v3 v3.0.1
+)
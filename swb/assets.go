@@ -0,0 +1,152 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Strategies to place the files of the src tree which are not derived (the
+// assets) in the dst tree.
+const (
+	AssetsLink    = "link"
+	AssetsCopy    = "copy"
+	AssetsSymlink = "symlink"
+)
+
+// validateAssets checks the site's assets strategy.
+func (site *Site) validateAssets() error {
+	switch site.Assets {
+	case "", AssetsLink, AssetsCopy, AssetsSymlink:
+		return nil
+	}
+	return fmt.Errorf("site %s: unknown assets strategy %q", site.Name, site.Assets)
+}
+
+// assetsStrategy returns the strategy placing the assets of the site: its
+// assets one, or copy if one of its trees is a file system (see Site.Src),
+// in which the assets cannot be linked.
+func (site *Site) assetsStrategy() string {
+	if site.Src != nil || site.Dst != nil {
+		return AssetsCopy
+	}
+	return site.Assets
+}
+
+// placed reports whether the file at dstPath in the dst tree, described by
+// dstInfo (not following symbolic links), is the asset at srcPath in the src
+// tree, described by srcInfo, placed with the site's assets strategy. A copy
+// is placed if it has the size, the modification time and the permissions
+// of its source, so that the copies made when the src and dst trees are on
+// different file systems are kept with the link strategy.
+func (site *Site) placed(srcPath string, srcInfo fs.FileInfo, dstPath string, dstInfo fs.FileInfo) (bool, error) {
+	strategy := site.assetsStrategy()
+	if strategy == AssetsSymlink {
+		if dstInfo.Mode()&fs.ModeSymlink == 0 {
+			return false, nil
+		}
+		target, err := site.assetTarget(srcPath)
+		if err != nil {
+			return false, err
+		}
+		link, err := os.Readlink(dstPath)
+		return err == nil && link == target, nil
+	}
+	if !dstInfo.Mode().IsRegular() {
+		return false, nil
+	}
+	if os.SameFile(srcInfo, dstInfo) {
+		// A copy must not share the content of its source.
+		return strategy != AssetsCopy, nil
+	}
+	return srcInfo.Size() == dstInfo.Size() && srcInfo.ModTime().Equal(dstInfo.ModTime()) &&
+		dstInfo.Mode().Perm() == site.fileMode(srcInfo.Mode()), nil
+}
+
+// assetTarget returns the absolute path of the file an asset of the src
+// tree refers to, the one linked in the dst tree rather than the symbolic
+// links that may lead to it. The files of a Src are their own targets.
+func (site *Site) assetTarget(srcPath string) (string, error) {
+	if _, ok := site.srcName(srcPath); ok {
+		return srcPath, nil
+	}
+	target, err := filepath.EvalSymlinks(srcPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(target)
+}
+
+// placeAsset places the asset at srcPath in the src tree at dstPath in the
+// dst tree, unless it is already placed (and the build is not forced).
+// With the link strategy, the asset is copied if it cannot be linked
+// because the src and dst trees are on different file systems.
+func (config *Config) placeAsset(ctx context.Context, site *Site, srcPath, dstPath string) error {
+	target, err := site.assetTarget(srcPath)
+	if err != nil {
+		return err
+	}
+	srcInfo, err := site.stat(target)
+	if err != nil {
+		return err
+	}
+	dstInfo, err := site.lstat(dstPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	exists := err == nil
+	if exists && !config.Force {
+		placed, err := site.placed(srcPath, srcInfo, dstPath, dstInfo)
+		if err != nil {
+			return err
+		}
+		if placed {
+			config.action(site, ActionSkip, dstPath, 0)
+			return nil
+		}
+	}
+	if config.DryRun {
+		config.action(site, ActionLink, dstPath, 0)
+		return nil
+	}
+	if exists {
+		if err := site.remove(dstPath); err != nil {
+			return err
+		}
+	}
+	t := time.Now()
+	switch site.assetsStrategy() {
+	case AssetsSymlink:
+		err = os.Symlink(target, dstPath)
+	case AssetsCopy:
+		err = site.copyAsset(ctx, target, srcInfo, dstPath, site.fileMode(srcInfo.Mode()))
+	default:
+		err = os.Link(target, dstPath)
+		if errors.Is(err, syscall.EXDEV) {
+			err = site.copyAsset(ctx, target, srcInfo, dstPath, site.fileMode(srcInfo.Mode()))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	config.action(site, ActionLink, dstPath, time.Since(t))
+	return nil
+}
+
+// copyAsset copies the asset at srcPath to dstPath, with the permissions
+// perm (see Site.fileMode) and its modification time so that the copy is
+// known to be up to date.
+func (site *Site) copyAsset(ctx context.Context, srcPath string, srcInfo fs.FileInfo, dstPath string, perm fs.FileMode) error {
+	if err := site.copyFile(ctx, srcPath, dstPath); err != nil {
+		return err
+	}
+	if err := site.chmod(dstPath, perm); err != nil {
+		return err
+	}
+	return site.chtimes(dstPath, srcInfo.ModTime())
+}
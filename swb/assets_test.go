@@ -0,0 +1,92 @@
+package swb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestCopyAssetMode checks that a copied asset keeps the executable bit of
+// its source.
+func TestCopyAssetMode(t *testing.T) {
+	config := tinySites(t, 1, false)
+	site := config.Sites[0]
+	site.Assets = AssetsCopy
+	script := filepath.Join(site.SrcRoot, "install.sh")
+	writeFiles(t, site.SrcRoot, map[string]string{"install.sh": "#!/bin/sh\necho installed\n"})
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.BuildSite(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	dstPath := filepath.Join(site.DstRoot, "install.sh")
+	info, err := os.Stat(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0755 {
+		t.Errorf("copied script mode %v, want -rwxr-xr-x", perm)
+	}
+	srcInfo, err := os.Stat(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(srcInfo, info) {
+		t.Error("script linked, not copied")
+	}
+}
+
+// TestPreserveTimesRebuild checks that a page rebuilt for a change of its
+// template keeps the date of its source.
+func TestPreserveTimesRebuild(t *testing.T) {
+	config := tinySites(t, 1, false)
+	site := config.Sites[0]
+	site.PreserveTimes = true
+	srcPath := filepath.Join(site.SrcRoot, "index.md")
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(srcPath, date, date); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	dstPath := filepath.Join(site.DstRoot, "index.html")
+	checkTime := func() {
+		t.Helper()
+		info, err := os.Stat(dstPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(date) {
+			t.Errorf("page time %v, want the source's %v", info.ModTime(), date)
+		}
+	}
+	checkTime()
+
+	// The template is newer than the build, not than the page.
+	later := time.Now().Add(time.Minute)
+	writeFiles(t, filepath.Dir(site.TplPath), map[string]string{filepath.Base(site.TplPath): "<body>\n%content%\n</body>\n"})
+	if err := os.Chtimes(site.TplPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	report, err := config.BuildSite(ctx, site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(report.Rebuilt, dstPath) {
+		t.Errorf("rebuilt %v, want %s", report.Rebuilt, dstPath)
+	}
+	b, err := os.ReadFile(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<body>\n<h1>Home</h1>\n\n</body>\n"; string(b) != want {
+		t.Errorf("page = %q, want %q", b, want)
+	}
+	checkTime()
+}
@@ -0,0 +1,45 @@
+package swb
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// tempPattern is the pattern of the names of the temporary files written
+// in the dst trees before being renamed to their output. Those left by an
+// interrupted build are removed by the next one, like any file of the dst
+// tree which is not an output.
+const tempPattern = ".swb-tmp-*"
+
+// writeFile writes b to the file at path, like os.WriteFile, but through a
+// temporary file of the same directory renamed over it, so that the file
+// is never left partially written (e.g. by an interrupted build).
+func writeFile(path string, b []byte, perm fs.FileMode) error {
+	return writeAtomic(path, bytes.NewReader(b), perm)
+}
+
+// writeAtomic writes the content of r to the file at path, as writeFile
+// does.
+func writeAtomic(path string, r io.Reader, perm fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), tempPattern+filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
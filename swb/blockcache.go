@@ -0,0 +1,69 @@
+package swb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// NoCacheMarker, right after the opening delimiter of a block (e.g. %{!),
+// marks the block as depending on the page beyond the variables it refers
+// to, so that its output is never cached (see Site.BlockCache).
+const NoCacheMarker = "!"
+
+// blockVarRe matches the references to variables in the blocks.
+var blockVarRe = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// blockMarker returns the block without its no-cache marker, and whether its
+// output can be cached.
+func blockMarker(block string) (string, bool) {
+	if rest, ok := strings.CutPrefix(block, NoCacheMarker); ok {
+		return rest, false
+	}
+	return block, true
+}
+
+// blockKey returns the key of the output of the block run with the
+// environment env in the cache: the block and the values of the variables
+// it refers to.
+func blockKey(block string, env []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n", block)
+	var names []string
+	for _, m := range blockVarRe.FindAllStringSubmatch(block, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		// The last value of a variable is the one the command gets.
+		value, set := envValue(env, name)
+		fmt.Fprintf(h, "%s %t %q\n", name, set, value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedBlock runs the block at where with the environment env like
+// runBlock, or returns its output of the current build if the site caches
+// the blocks and it has already run with the same values of the variables
+// it refers to.
+func (config *Config) cachedBlock(ctx context.Context, site *Site, block, where string, env []string) (string, error) {
+	block, cacheable := blockMarker(block)
+	if !cacheable || site.blockCache == nil {
+		return config.runBlock(ctx, site, block, where, env)
+	}
+	key := blockKey(block, env)
+	if out, ok := site.blockCache[key]; ok {
+		return out, nil
+	}
+	out, err := config.runBlock(ctx, site, block, where, env)
+	if err == nil {
+		site.blockCache[key] = out
+	}
+	return out, err
+}
@@ -0,0 +1,54 @@
+package swb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// validateBuildLog checks that the site's build log is out of its trees,
+// where it would be built as a source or removed as a stale output.
+func (site *Site) validateBuildLog() error {
+	if site.BuildLog == "" || site.SrcRoot == "" || site.DstRoot == "" {
+		return nil
+	}
+	log, err := realPath(site.BuildLog)
+	if err != nil {
+		return fmt.Errorf("site %s: buildLog: %v", site.Name, err)
+	}
+	for _, root := range []string{site.SrcRoot, site.DstRoot} {
+		if dir, err := realPath(root); err == nil && within(dir, log) {
+			return fmt.Errorf("site %s: buildLog %s is inside %s (move it out, e.g. next to it)", site.Name, site.BuildLog, root)
+		}
+	}
+	return nil
+}
+
+// startLog starts the build log of the site, if it has one: the actions
+// of the build, the commands run with their standard error, and its
+// warnings and errors, as reported at the debug level (see Logger). It
+// returns the function ending it with the error of the build.
+func (site *Site) startLog() (func(err error), error) {
+	if site.BuildLog == "" {
+		return func(error) {}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(site.BuildLog), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(site.BuildLog)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(f, "build of site %s at %s\n", site.Name, now().Format(time.RFC3339))
+	site.log = NewLogger(f, LevelDebug, false)
+	site.log.Start(site)
+	return func(err error) {
+		if err != nil {
+			fmt.Fprintf(f, "site %s failed: %s\n", site.Name, FormatErrors(err))
+		}
+		site.log.Summary(site, err)
+		site.log = nil
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,114 @@
+package swb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A PageCheck is an assertion on the rendered pages of a site, run after
+// a page is rendered and before it is written. Its problems are reported
+// as warnings, or make the page fail if it is strict.
+type PageCheck struct {
+	Name   string `json:"name" toml:"name" yaml:"name"`
+	Tag    string `json:"tag,omitempty" toml:"tag,omitempty" yaml:"tag,omitempty"`
+	Count  *int   `json:"count,omitempty" toml:"count,omitempty" yaml:"count,omitempty"`
+	Max    int64  `json:"max,omitempty" toml:"max,omitempty" yaml:"max,omitempty"`
+	Strict bool   `json:"strict,omitempty" toml:"strict,omitempty" yaml:"strict,omitempty"`
+}
+
+// A pageCheck implements a named PageCheck: validate checks its parameters
+// and run returns the problems found in a page, with their details.
+type pageCheck struct {
+	validate func(c *PageCheck) error
+	run      func(c *PageCheck, page []byte) []string
+}
+
+// pageChecks are the built-in checks, by name.
+var pageChecks = map[string]pageCheck{
+	"tagCount":   {validateTagCount, checkTagCount},
+	"maxSize":    {validateMaxSize, checkMaxSize},
+	"noInsecure": {func(*PageCheck) error { return nil }, checkNoInsecure},
+}
+
+func validateTagCount(c *PageCheck) error {
+	if c.Tag == "" || c.Count == nil || *c.Count < 0 {
+		return errors.New("tag and a non-negative count are required")
+	}
+	return nil
+}
+
+// checkTagCount checks that the page holds exactly count tag elements.
+func checkTagCount(c *PageCheck, page []byte) []string {
+	re := regexp.MustCompile(`(?i)<` + regexp.QuoteMeta(c.Tag) + `[\s/>]`)
+	if n := len(re.FindAllIndex(page, -1)); n != *c.Count {
+		return []string{fmt.Sprintf("found %d <%s> elements, want %d", n, c.Tag, *c.Count)}
+	}
+	return nil
+}
+
+func validateMaxSize(c *PageCheck) error {
+	if c.Max <= 0 {
+		return errors.New("a positive max is required")
+	}
+	return nil
+}
+
+// checkMaxSize checks that the page is at most max bytes long.
+func checkMaxSize(c *PageCheck, page []byte) []string {
+	if int64(len(page)) > c.Max {
+		return []string{fmt.Sprintf("page is %d bytes, max %d", len(page), c.Max)}
+	}
+	return nil
+}
+
+// insecureRe matches the http:// URLs of the resources loaded by a page
+// (i.e. not the ones of its links, except for <link> elements).
+var insecureRe = regexp.MustCompile(`(?i)(?:\b(?:src|srcset|poster|data)\s*=\s*["']?|<link\b[^>]*\bhref\s*=\s*["']?|url\(\s*["']?)(http://[^"'\s>),]+)`)
+
+// checkNoInsecure checks that the page loads no resource over http.
+func checkNoInsecure(c *PageCheck, page []byte) []string {
+	var problems []string
+	for _, m := range insecureRe.FindAllSubmatch(page, -1) {
+		problems = append(problems, "insecure resource "+string(m[1]))
+	}
+	return problems
+}
+
+// validatePageChecks checks that the site's page checks exist and have
+// valid parameters.
+func (site *Site) validatePageChecks() error {
+	for i := range site.PageChecks {
+		c := &site.PageChecks[i]
+		check, ok := pageChecks[c.Name]
+		if !ok {
+			return fmt.Errorf("site %s: pageChecks[%d]: unknown check %q", site.Name, i, c.Name)
+		}
+		if err := check.validate(c); err != nil {
+			return fmt.Errorf("site %s: pageChecks[%d]: %s: %v", site.Name, i, c.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkPage runs the site's page checks on the page rendered at dstPath.
+// The problems found by the strict checks are returned, the other ones are
+// reported as warnings.
+func (config *Config) checkPage(site *Site, dstPath string, page []byte) error {
+	var errs []string
+	for i := range site.PageChecks {
+		c := &site.PageChecks[i]
+		for _, problem := range pageChecks[c.Name].run(c, page) {
+			if c.Strict {
+				errs = append(errs, c.Name+": "+problem)
+			} else {
+				config.warn(site, dstPath, c.Name+": "+problem)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
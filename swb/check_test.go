@@ -0,0 +1,99 @@
+package swb
+
+import (
+	"slices"
+	"testing"
+)
+
+// checkTest is a test of a named page check: the problems it finds in
+// page with the parameters of c, or whether c is invalid.
+type checkTest struct {
+	c        PageCheck
+	page     string
+	problems []string
+	invalid  bool
+}
+
+func runCheckTests(t *testing.T, name string, tests []checkTest) {
+	t.Helper()
+	check := pageChecks[name]
+	for _, tt := range tests {
+		tt.c.Name = name
+		err := check.validate(&tt.c)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("%+v: invalid check accepted", tt.c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", tt.c, err)
+			continue
+		}
+		if problems := check.run(&tt.c, []byte(tt.page)); !slices.Equal(problems, tt.problems) {
+			t.Errorf("%+v on %q: problems %q, want %q", tt.c, tt.page, problems, tt.problems)
+		}
+	}
+}
+
+func TestCheckTagCount(t *testing.T) {
+	zero, one := 0, 1
+	runCheckTests(t, "tagCount", []checkTest{
+		{c: PageCheck{Tag: "h1", Count: &one}, page: "<h1>Title</h1><h2>Part</h2>"},
+		{c: PageCheck{Tag: "h1", Count: &one}, page: "<H1 class=x>Title</H1>"},
+		{c: PageCheck{Tag: "h1", Count: &one}, page: "<h10>Title</h10>",
+			problems: []string{"found 0 <h1> elements, want 1"}},
+		{c: PageCheck{Tag: "h1", Count: &one}, page: "<h1>A</h1><h1>B</h1>",
+			problems: []string{"found 2 <h1> elements, want 1"}},
+		{c: PageCheck{Tag: "br", Count: &zero}, page: "a<br/>b",
+			problems: []string{"found 1 <br> elements, want 0"}},
+		{c: PageCheck{Count: &one}, invalid: true},
+		{c: PageCheck{Tag: "h1"}, invalid: true},
+	})
+}
+
+func TestCheckMaxSize(t *testing.T) {
+	runCheckTests(t, "maxSize", []checkTest{
+		{c: PageCheck{Max: 4}, page: "abcd"},
+		{c: PageCheck{Max: 4}, page: "abcde", problems: []string{"page is 5 bytes, max 4"}},
+		{c: PageCheck{}, invalid: true},
+		{c: PageCheck{Max: -1}, invalid: true},
+	})
+}
+
+func TestCheckNoInsecure(t *testing.T) {
+	runCheckTests(t, "noInsecure", []checkTest{
+		{page: `<img src="https://a.org/x.png"><a href="http://b.org/">b</a>`},
+		{page: `<img src="http://a.org/x.png"><script src=http://b.org/y.js></script>`,
+			problems: []string{"insecure resource http://a.org/x.png", "insecure resource http://b.org/y.js"}},
+		{page: `<link rel="stylesheet" href="http://a.org/s.css">`,
+			problems: []string{"insecure resource http://a.org/s.css"}},
+		{page: `<div style="background: url('http://a.org/bg.png')">`,
+			problems: []string{"insecure resource http://a.org/bg.png"}},
+	})
+}
+
+// TestValidatePageChecks checks that the unknown checks are rejected.
+func TestValidatePageChecks(t *testing.T) {
+	site := &Site{Name: "site", PageChecks: []PageCheck{{Name: "maxSize", Max: 1}, {Name: "spelling"}}}
+	if err := site.validatePageChecks(); err == nil {
+		t.Error("unknown check accepted")
+	}
+}
+
+// TestCheckPage checks that the problems of the strict checks fail the
+// page, and the other ones are warnings.
+func TestCheckPage(t *testing.T) {
+	site := &Site{Name: "site", report: &Report{}, PageChecks: []PageCheck{
+		{Name: "maxSize", Max: 1},
+		{Name: "noInsecure", Strict: true},
+	}}
+	err := new(Config).checkPage(site, "page.html", []byte(`<img src="http://a.org/x.png">`))
+	if want := "noInsecure: insecure resource http://a.org/x.png"; err == nil || err.Error() != want {
+		t.Errorf("error %v, want %q", err, want)
+	}
+	want := []string{"page.html: maxSize: page is 30 bytes, max 1"}
+	if !slices.Equal(site.report.Warnings, want) {
+		t.Errorf("warnings %q, want %q", site.report.Warnings, want)
+	}
+}
@@ -0,0 +1,242 @@
+package swb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readConfig reads the configuration file at path into config, and merges
+// the files it includes, in order. The content of every file read is
+// written to h. seen holds the files being read, to detect include cycles.
+func readConfig(path string, config *Config, h hash.Hash, seen map[string]bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if seen[abs] {
+		return fmt.Errorf("%s: include cycle", path)
+	}
+	seen[abs] = true
+	defer delete(seen, abs)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	h.Write(b)
+	if err := decodeConfig(path, b, config); err != nil {
+		return err
+	}
+	config.files = append(config.files, path)
+	includes := config.Include
+	config.Include = nil
+	for _, pattern := range includes {
+		pattern, err := ExpandPath(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: include: %v", path, err)
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: include %s: %v", path, pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			// Report the missing file.
+			matches = []string{pattern}
+		}
+		for _, match := range matches {
+			included := new(Config)
+			if err := readConfig(match, included, h, seen); err != nil {
+				return err
+			}
+			config.merge(included)
+		}
+	}
+	return nil
+}
+
+// merge merges the included configuration into config: its sites and
+// builders are appended to the ones of config, and its other fields are
+// only used where config does not set them.
+func (config *Config) merge(included *Config) {
+	config.Sites = append(config.Sites, included.Sites...)
+	config.Builders = append(config.Builders, included.Builders...)
+	config.files = append(config.files, included.files...)
+	if config.Builder == (Builder{}) {
+		config.Builder = included.Builder
+	}
+	if config.RunCmd == nil {
+		config.RunCmd = included.RunCmd
+	}
+	config.QuickCheck = config.QuickCheck || included.QuickCheck
+	if config.CommandTimeout == "" {
+		config.CommandTimeout = included.CommandTimeout
+	}
+	for ext, filters := range included.PostProcess {
+		if _, ok := config.PostProcess[ext]; ok {
+			continue
+		}
+		if config.PostProcess == nil {
+			config.PostProcess = make(map[string][]string)
+		}
+		config.PostProcess[ext] = filters
+	}
+	for name, profile := range included.Profiles {
+		if _, ok := config.Profiles[name]; ok {
+			continue
+		}
+		if config.Profiles == nil {
+			config.Profiles = make(map[string]*Profile)
+		}
+		config.Profiles[name] = profile
+	}
+}
+
+// decodeConfig decodes the content b of the configuration file at path,
+// according to its extension. Decoding errors report the file and the line
+// of the problem.
+func decodeConfig(path string, b []byte, config *Config) error {
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(config); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			switch {
+			case errors.As(err, &syntaxErr):
+				return fmt.Errorf("%s:%d: %v", path, line(b, syntaxErr.Offset), err)
+			case errors.As(err, &typeErr):
+				return fmt.Errorf("%s:%d: field %s: %v", path, line(b, typeErr.Offset), typeErr.Field, err)
+			case errors.Is(err, io.ErrUnexpectedEOF):
+				return fmt.Errorf("%s: unexpected end of file", path)
+			}
+			if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+				field, _ = strconv.Unquote(field)
+				return fmt.Errorf("%s: unknown field %s%s", path, field, suggestField(field))
+			}
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if dec.More() {
+			return fmt.Errorf("%s:%d: unexpected data after the configuration", path, line(b, dec.InputOffset()))
+		}
+	case ".toml":
+		md, err := toml.Decode(string(b), config)
+		if err != nil {
+			var parseErr toml.ParseError
+			if errors.As(err, &parseErr) {
+				return fmt.Errorf("%s:%d: %s", path, parseErr.Position.Line, parseErr.Message)
+			}
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			var keys []string
+			for _, key := range undecoded {
+				keys = append(keys, key.String()+suggestField(key[len(key)-1]))
+			}
+			return fmt.Errorf("%s: unknown fields: %s", path, strings.Join(keys, ", "))
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(config); err != nil {
+			return fmt.Errorf("%s: %v", path, strings.TrimPrefix(err.Error(), "yaml: "))
+		}
+	default:
+		return fmt.Errorf("%s: unknown configuration format %q", path, ext)
+	}
+	return nil
+}
+
+// suggestField returns a suggestion of the known field of the
+// configuration closest to the unknown field name, or nothing if none is
+// close enough.
+func suggestField(name string) string {
+	best, bestDist := "", 3
+	for _, field := range configFields() {
+		if field == name {
+			// The field is known, but not at this level.
+			return " (not allowed here)"
+		}
+		if strings.EqualFold(field, name) {
+			return fmt.Sprintf(" (did you mean %s?)", field)
+		}
+		if d := distance(strings.ToLower(field), strings.ToLower(name)); d < bestDist {
+			best, bestDist = field, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %s?)", best)
+}
+
+// configFields returns the names of the fields of the configuration, at
+// every level.
+func configFields() []string {
+	var fields []string
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" || name == "" {
+				continue
+			}
+			fields = append(fields, name)
+			walk(f.Type)
+		}
+	}
+	walk(reflect.TypeOf(Config{}))
+	return fields
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// line returns the line of the byte at offset in b.
+func line(b []byte, offset int64) int {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	return bytes.Count(b[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,60 @@
+package swb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ContentToken is replaced in the templates by the body of the page built
+// by its builder, when swb runs it (see Builder.Stdin).
+const ContentToken = "%content%"
+
+// runBySwb reports whether the body of the pages of the builder is built
+// by swb rather than by the templates: if it is fed on the standard input
+// of the builder, or rendered by the internal builder.
+func (b Builder) runBySwb() bool {
+	return b.Stdin || b.Bin == BuilderInternal
+}
+
+// buildBody runs the builder b on the body of a page (without its front
+// matter), fed on its standard input, and returns its output. The
+// arguments of the builder can refer to the variables of env. The body is
+// rendered from Markdown by swb itself if b is the internal builder. The
+// code blocks of the output are highlighted if the site highlights them.
+func (config *Config) buildBody(ctx context.Context, site *Site, b Builder, body []byte, env []string) ([]byte, error) {
+	if b.Bin == BuilderInternal {
+		return site.highlightCode(markdown(body)), nil
+	}
+	argv := expandArgs(strings.Fields(b.Bin), env)
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("builder of %s files has no bin", b.Ext)
+	}
+	ctx, cancel := config.commandContext(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(body)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	t := time.Now()
+	err := config.runCommand(ctx, cmd)
+	config.command(site, Command{Argv: cmd.Args, Duration: time.Since(t), Page: envPage(env), Stderr: stderr.String()})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", argv[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", argv[0], err)
+	}
+	return site.highlightCode(stdout.Bytes()), nil
+}
+
+// renderContent renders the template t like render, with ContentToken
+// replaced by content. The token is only replaced outside of the blocks.
+func (config *Config) renderContent(ctx context.Context, site *Site, t *parsedTpl, env []string, content []byte) (string, error) {
+	return config.renderChunks(ctx, site, t, env, string(content))
+}
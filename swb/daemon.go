@@ -0,0 +1,222 @@
+package swb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// webhookPath is the path of the endpoint of the webhooks of Daemon, the
+// name of the site following it.
+const webhookPath = "/webhook/"
+
+// maxPayload is the maximum size of the body of a webhook (the one of
+// GitHub).
+const maxPayload = 25 << 20
+
+// Daemon listens on addr for webhooks (e.g. the push events of GitHub), and
+// rebuilds the site whose name follows /webhook/ in their path whenever one
+// signed with secret is posted, until ctx is done. The signature is the
+// HMAC-SHA256 of the body, in the X-Hub-Signature-256 header, like GitHub's
+// and Gitea's. If pull is set, the src tree of the site is updated with git
+// pull before the build. The builds run one after the other, the webhooks
+// received meanwhile triggering a single build of each site. built is
+// called after each build. If reloaded is not nil, the configuration is
+// reloaded when its files change, like with Watch.
+func (config *Config) Daemon(ctx context.Context, addr string, secret []byte, pull bool, built func(site *Site, report Report, err error), reloaded func(changes []string, err error)) error {
+	if len(secret) == 0 {
+		return errors.New("a webhook secret is required")
+	}
+	d := &daemon{config: config, secret: secret, pending: make(map[string]bool), wake: make(chan struct{}, 1)}
+	// The channels of the watcher of the configuration, which stay nil if
+	// it is not reloaded.
+	var events chan fsnotify.Event
+	var werrs chan error
+	var w *fsnotify.Watcher
+	if reloaded != nil {
+		var err error
+		if w, err = fsnotify.NewWatcher(); err != nil {
+			return err
+		}
+		defer w.Close()
+		if err := config.watchConfig(w); err != nil {
+			return err
+		}
+		events, werrs = w.Events, w.Errors
+	}
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	mux := http.NewServeMux()
+	mux.Handle(webhookPath, d)
+	if config.Metrics != nil {
+		mux.Handle(metricsPath, config.Metrics)
+	}
+	srv := &http.Server{Addr: addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			srv.Shutdown(context.Background())
+			return nil
+		case err := <-errc:
+			return err
+		case err := <-werrs:
+			return err
+		case ev := <-events:
+			if config.isConfigFile(ev.Name) {
+				timer.Reset(watchDelay)
+			}
+		case <-timer.C:
+			fresh, changes, err := config.Reload()
+			reloaded(changes, err)
+			if err != nil {
+				continue
+			}
+			d.mu.Lock()
+			for _, site := range fresh.Sites {
+				if config.reloaded(fresh, site) {
+					d.pending[site.Name] = true
+				}
+			}
+			*config = *fresh
+			d.mu.Unlock()
+			if err := config.watchConfig(w); err != nil {
+				return err
+			}
+			d.wakeUp()
+		case <-d.wake:
+			for _, site := range config.Sites {
+				if !d.take(site) {
+					continue
+				}
+				var report Report
+				start := time.Now()
+				err := phaseError(PhasePull, site.SrcRoot, config.pull(ctx, site, pull))
+				if err == nil {
+					report, err = config.BuildSite(ctx, site)
+				}
+				if config.Metrics != nil {
+					config.Metrics.Add(SiteResult{Site: site, Report: report, Duration: time.Since(start), Err: err})
+				}
+				built(site, report, err)
+			}
+		}
+	}
+}
+
+// A daemon receives the webhooks of Daemon.
+type daemon struct {
+	config *Config
+	secret []byte
+
+	// mu guards the sites of config, which are replaced when it is
+	// reloaded, and pending.
+	mu sync.Mutex
+	// Names of the sites to rebuild.
+	pending map[string]bool
+	wake    chan struct{}
+}
+
+func (d *daemon) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !d.verify(body, req.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if req.Header.Get("X-GitHub-Event") == "ping" {
+		fmt.Fprintln(w, "pong")
+		return
+	}
+	name := strings.TrimPrefix(req.URL.Path, webhookPath)
+	d.mu.Lock()
+	found := slices.ContainsFunc(d.config.Sites, func(site *Site) bool { return site.Name == name })
+	if found {
+		d.pending[name] = true
+	}
+	d.mu.Unlock()
+	if !found {
+		http.Error(w, "no site named "+name, http.StatusNotFound)
+		return
+	}
+	d.wakeUp()
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "rebuilding %s\n", name)
+}
+
+// wakeUp wakes Daemon up to rebuild the pending sites.
+func (d *daemon) wakeUp() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+		// A wake up is already pending.
+	}
+}
+
+// verify reports whether signature is the HMAC-SHA256 of body, as
+// "sha256=" followed by its hexadecimal encoding.
+func (d *daemon) verify(body []byte, signature string) bool {
+	sum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sum)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// take reports whether the site is to be rebuilt, and clears it.
+func (d *daemon) take(site *Site) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.pending[site.Name] {
+		return false
+	}
+	delete(d.pending, site.Name)
+	return true
+}
+
+// pull updates the src tree of the site with git pull, if pull is set.
+func (config *Config) pull(ctx context.Context, site *Site, pull bool) error {
+	if !pull || config.DryRun {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", site.SrcRoot, "pull", "--ff-only")
+	t := time.Now()
+	out, err := cmd.CombinedOutput()
+	config.command(site, Command{Argv: cmd.Args, Duration: time.Since(t)})
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("git pull: %w: %s", err, msg)
+		}
+		return fmt.Errorf("git pull: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package swb
+
+import (
+	"fmt"
+)
+
+// Default delimiters of the command substitution blocks.
+const (
+	DefaultOpen  = "%{"
+	DefaultClose = "}%"
+)
+
+// delimiters returns the opening and closing delimiters of the command
+// substitution blocks of the site's templates.
+func (site *Site) delimiters() (string, string) {
+	if len(site.Delimiters) == 2 {
+		return site.Delimiters[0], site.Delimiters[1]
+	}
+	return DefaultOpen, DefaultClose
+}
+
+func (site *Site) validateDelimiters() error {
+	if site.Delimiters == nil {
+		return nil
+	}
+	if len(site.Delimiters) != 2 {
+		return fmt.Errorf("site %s: delimiters: want an opening and a closing delimiter, got %q", site.Name, site.Delimiters)
+	}
+	open, close := site.Delimiters[0], site.Delimiters[1]
+	if open == "" || close == "" {
+		return fmt.Errorf("site %s: delimiters: delimiters cannot be empty", site.Name)
+	}
+	if open == close {
+		return fmt.Errorf("site %s: delimiters: opening and closing delimiters are both %q", site.Name, open)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package swb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DeployFile is the record of the last deployment of a site, written at
+// the root of its dst tree.
+const DeployFile = ".swb-deploy.json"
+
+// Types of the deployment targets.
+const (
+	// The dst tree is synchronized with rsync, which only transfers the
+	// changed files itself.
+	DeployRsync = "rsync"
+	// The changed files are copied with scp, over ssh.
+	DeployScp = "scp"
+	// The changed files are copied to an S3 (or S3-compatible) bucket with
+	// the aws command, or to a Google Cloud Storage one with gsutil.
+	DeployS3  = "s3"
+	DeployGCS = "gcs"
+)
+
+// A Deploy is the deployment target of a site.
+type Deploy struct {
+	// Type of the target, rsync, scp, s3 or gcs.
+	Type string `json:"type" toml:"type" yaml:"type"`
+	// Dest is the destination of the files, in the syntax of the
+	// command of the target (e.g. user@host:/var/www for rsync and scp,
+	// s3://bucket/prefix for s3).
+	Dest string `json:"dest" toml:"dest" yaml:"dest"`
+	// Extra arguments of the command (e.g. ["--endpoint-url", "..."] for
+	// an S3-compatible storage).
+	Args []string `json:"args,omitempty" toml:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// validateDeploy checks the site's deployment target.
+func (site *Site) validateDeploy() error {
+	d := site.Deploy
+	if d == nil {
+		return nil
+	}
+	switch d.Type {
+	case DeployRsync, DeployS3, DeployGCS:
+	case DeployScp:
+		if !strings.Contains(d.Dest, ":") {
+			return fmt.Errorf("site %s: deploy: scp dest %s is not host:path", site.Name, d.Dest)
+		}
+	default:
+		return fmt.Errorf("site %s: deploy: unknown type %q", site.Name, d.Type)
+	}
+	if d.Dest == "" {
+		return fmt.Errorf("site %s: deploy: dest is required", site.Name)
+	}
+	return nil
+}
+
+// A deployRecord records the files of a dst tree as they were deployed to
+// a destination.
+type deployRecord struct {
+	Dest  string                  `json:"dest"`
+	Files map[string]deployedFile `json:"files"`
+}
+
+type deployedFile struct {
+	Hash  string    `json:"hash"`
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+}
+
+// deployed reports whether the dst-relative path rel is a file to deploy:
+// the files swb writes for itself in the dst trees are not.
+func deployed(rel string) bool {
+	return !slices.Contains(append(markerFiles, DeployFile, LockFile), rel) && !matchAny([]string{tempPattern}, path.Base(rel))
+}
+
+// Deploy uploads the files of the dst tree of the site which changed since
+// its last deployment to its target, and removes the ones which have been
+// removed since. The deployment is recorded in the dst tree, so that a
+// file which failed to be uploaded is uploaded again by the next one.
+func (config *Config) Deploy(ctx context.Context, site *Site) error {
+	d := site.Deploy
+	if d == nil {
+		return fmt.Errorf("site %s has no deploy target", site.Name)
+	}
+	if site.Dst != nil {
+		return fmt.Errorf("site %s: a dst tree held by a Dst cannot be deployed, only a directory can", site.Name)
+	}
+	if _, err := os.Stat(filepath.Join(site.DstRoot, StateFile)); err != nil {
+		return fmt.Errorf("site %s has not been built: %w", site.Name, err)
+	}
+	unlock, err := config.lock(ctx, site)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	recordPath := filepath.Join(site.DstRoot, DeployFile)
+	var last deployRecord
+	if b, err := os.ReadFile(recordPath); err == nil {
+		json.Unmarshal(b, &last)
+	}
+	if last.Dest != d.Dest {
+		// Everything is deployed to a new destination.
+		last.Files = nil
+	}
+	// The record holds the files as they are deployed: a changed or
+	// removed file keeps its old entry until it is deployed.
+	record := deployRecord{Dest: d.Dest, Files: make(map[string]deployedFile)}
+	current := make(map[string]deployedFile)
+	var changed []string
+	err = filepath.WalkDir(site.DstRoot, func(p string, ent fs.DirEntry, err error) error {
+		if err != nil || ent.IsDir() {
+			return err
+		}
+		rel := filepath.ToSlash(site.rel(p))
+		if !deployed(rel) {
+			return nil
+		}
+		info, err := os.Stat(p)
+		if err != nil || info.IsDir() {
+			return err
+		}
+		f := deployedFile{Size: info.Size(), Mtime: info.ModTime()}
+		old, ok := last.Files[rel]
+		if ok && unchanged(info, old.Size, old.Mtime) {
+			f.Hash = old.Hash
+		} else if f.Hash, err = fileHash(p); err != nil {
+			return err
+		}
+		current[rel] = f
+		if ok && f.Hash == old.Hash {
+			record.Files[rel] = f
+		} else {
+			changed = append(changed, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var removed []string
+	for rel, old := range last.Files {
+		if _, ok := current[rel]; !ok {
+			removed = append(removed, rel)
+		}
+		if _, ok := record.Files[rel]; !ok {
+			record.Files[rel] = old
+		}
+	}
+	slices.Sort(removed)
+	if config.DryRun {
+		for _, rel := range changed {
+			config.action(site, ActionUpload, filepath.Join(site.DstRoot, rel), 0)
+		}
+		for _, rel := range removed {
+			config.action(site, ActionUnpublish, d.remote(rel), 0)
+		}
+		return nil
+	}
+	err = config.deploy(ctx, site, changed, removed, func(rel string, upload bool) {
+		if upload {
+			record.Files[rel] = current[rel]
+		} else {
+			delete(record.Files, rel)
+		}
+	})
+	b, jsonErr := json.MarshalIndent(record, "", "\t")
+	if jsonErr != nil {
+		return errors.Join(err, jsonErr)
+	}
+	if err := errors.Join(err, writeFile(recordPath, append(b, '\n'), site.newFileMode())); err != nil {
+		return err
+	}
+	return phaseError(PhasePostDeploy, "", config.runHooks(ctx, site, PhasePostDeploy, "deploy_dest="+d.Dest))
+}
+
+// remote returns the destination of the file at the dst-relative path rel.
+func (d *Deploy) remote(rel string) string {
+	return strings.TrimSuffix(d.Dest, "/") + "/" + rel
+}
+
+// deploy uploads the changed files and removes the removed ones, given by
+// their dst-relative path, to the target of the site, stopping at the first
+// failure. done is called for every file deployed.
+func (config *Config) deploy(ctx context.Context, site *Site, changed, removed []string, done func(rel string, upload bool)) error {
+	d := site.Deploy
+	run := func(argv ...string) error {
+		argv = append(argv[:1:1], append(slices.Clone(d.Args), argv[1:]...)...)
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		t := time.Now()
+		err := cmd.Run()
+		config.command(site, Command{Argv: cmd.Args, Duration: time.Since(t), Stderr: stderr.String()})
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%s: %w: %s", argv[0], err, msg)
+			}
+			return fmt.Errorf("%s: %w", argv[0], err)
+		}
+		return nil
+	}
+	if d.Type == DeployRsync {
+		if len(changed) == 0 && len(removed) == 0 {
+			return nil
+		}
+		argv := []string{"rsync", "-a", "--delete"}
+		for _, name := range append(markerFiles, DeployFile, LockFile) {
+			argv = append(argv, "--exclude=/"+name)
+		}
+		argv = append(argv, "--exclude="+tempPattern, site.DstRoot+"/", d.Dest)
+		t := time.Now()
+		if err := run(argv...); err != nil {
+			return err
+		}
+		for _, rel := range changed {
+			config.action(site, ActionUpload, filepath.Join(site.DstRoot, rel), time.Since(t))
+			done(rel, true)
+		}
+		for _, rel := range removed {
+			config.action(site, ActionUnpublish, d.remote(rel), 0)
+			done(rel, false)
+		}
+		return nil
+	}
+	var upload, remove func(rel string) error
+	switch d.Type {
+	case DeployS3:
+		upload = func(rel string) error {
+			return run("aws", "s3", "cp", filepath.Join(site.DstRoot, rel), d.remote(rel))
+		}
+		remove = func(rel string) error {
+			return run("aws", "s3", "rm", d.remote(rel))
+		}
+	case DeployGCS:
+		upload = func(rel string) error {
+			return run("gsutil", "cp", filepath.Join(site.DstRoot, rel), d.remote(rel))
+		}
+		remove = func(rel string) error {
+			return run("gsutil", "rm", d.remote(rel))
+		}
+	case DeployScp:
+		host, dir, _ := strings.Cut(d.Dest, ":")
+		made := make(map[string]bool)
+		upload = func(rel string) error {
+			if remoteDir := path.Dir(path.Join(dir, rel)); !made[remoteDir] {
+				if err := run("ssh", host, "mkdir -p "+shellQuote(remoteDir)); err != nil {
+					return err
+				}
+				made[remoteDir] = true
+			}
+			return run("scp", "-q", filepath.Join(site.DstRoot, rel), host+":"+path.Join(dir, rel))
+		}
+		remove = func(rel string) error {
+			return run("ssh", host, "rm -f "+shellQuote(path.Join(dir, rel)))
+		}
+	}
+	for _, rel := range changed {
+		t := time.Now()
+		if err := upload(rel); err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		config.action(site, ActionUpload, filepath.Join(site.DstRoot, rel), time.Since(t))
+		done(rel, true)
+	}
+	for _, rel := range removed {
+		t := time.Now()
+		if err := remove(rel); err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		config.action(site, ActionUnpublish, d.remote(rel), time.Since(t))
+		done(rel, false)
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
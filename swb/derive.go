@@ -0,0 +1,472 @@
+package swb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A Transform derives an output file with the OutExt extension from every
+// source file with the Ext extension, by running Cmd. The arguments of Cmd
+// can refer to the template environment variables (e.g. $src_path and
+// $dst_path), and the command is expected to write the output file.
+type Transform struct {
+	Ext    string   `json:"ext" toml:"ext" yaml:"ext"`
+	OutExt string   `json:"outExt" toml:"outExt" yaml:"outExt"`
+	Cmd    []string `json:"cmd" toml:"cmd" yaml:"cmd"`
+}
+
+// A rule derives an output file from every source file with a given
+// extension. The builder (which builds the pages through the template) and
+// the transforms of the site are rules.
+type rule struct {
+	ext    string
+	outExt string
+	// The outputs are pages built through the template.
+	page bool
+	// The outputs are their sources filtered (e.g. minified) rather than
+	// files of another type, so they can be fingerprinted like the linked
+	// assets.
+	asset bool
+	// Other outputs of the source whose output is at dstPath (e.g. the
+	// variants of an image), if any.
+	variants func(dstPath string) []string
+	// Files every output depends on, besides its source.
+	deps []string
+	// Every output is stale.
+	force bool
+	// Files the output of a given source depends on, besides deps.
+	srcDeps func(srcPath string) ([]string, error)
+	// The outputs have the time of their source, and the dependencies are
+	// compared to since, the end of the last build of the site.
+	preserveTimes bool
+	since         time.Time
+	// The draft pages, and the pages to be published in the future, are
+	// not built. The date of the next one is recorded in publish.
+	skipDrafts bool
+	skipFuture bool
+	publish    *time.Time
+	// The sources are compared to the ones recorded in the manifest of the
+	// last build by their hash, rather than to their output by their time.
+	byHash bool
+	build  func(ctx context.Context, srcPath, dstPath string) error
+	// Site whose files are derived.
+	site *Site
+}
+
+func (config *Config) rules(site *Site) []*rule {
+	// The pages depend on the template and the files it includes.
+	_, deps, err := site.readTemplate(site.TplPath)
+	if err != nil {
+		// The build fails on the template anyway.
+		deps = []string{site.TplPath}
+	}
+	if len(site.Fingerprint) > 0 {
+		deps = append(deps, filepath.Join(site.DstRoot, AssetManifest))
+	}
+	var rules []*rule
+	for _, b := range config.builders() {
+		rules = append(rules, &rule{
+			ext:     b.Ext,
+			outExt:  b.OutExt,
+			page:    true,
+			deps:    deps,
+			srcDeps: site.pageDeps,
+			build: func(ctx context.Context, srcPath, dstPath string) error {
+				return config.buildPage(ctx, site, srcPath, dstPath)
+			},
+		})
+	}
+	for _, t := range site.Transforms {
+		rules = append(rules, &rule{
+			ext:    t.Ext,
+			outExt: t.OutExt,
+			build: func(ctx context.Context, srcPath, dstPath string) error {
+				return config.transform(ctx, site, t, srcPath, dstPath)
+			},
+		})
+	}
+	rules = append(rules, config.imageRules(site, rules)...)
+	rules = append(rules, site.minifyRules(rules)...)
+	rules = append(rules, config.copyRules(site, rules)...)
+	if site.PreserveTimes {
+		// Without a state file, the site has never been built.
+		var since time.Time
+		if info, err := site.stat(filepath.Join(site.DstRoot, StateFile)); err == nil {
+			since = info.ModTime()
+		}
+		for _, r := range rules {
+			r.preserveTimes = true
+			r.since = since
+		}
+	}
+	for _, r := range rules {
+		r.force = config.Force
+		r.skipDrafts = !config.Drafts
+		r.skipFuture = !config.Future
+		r.publish = &site.publish
+		r.byHash = site.Rebuild == RebuildHash
+		r.site = site
+	}
+	return rules
+}
+
+// builders returns the builders of the content files, by order of
+// precedence, with their default output extension.
+func (config *Config) builders() []Builder {
+	var builders []Builder
+	for _, b := range append([]Builder{config.Builder}, config.Builders...) {
+		if b.Ext == "" {
+			continue
+		}
+		if b.OutExt == "" {
+			b.OutExt = ".html"
+		}
+		builders = append(builders, b)
+	}
+	return builders
+}
+
+// builder returns the builder of the content files with the ext
+// extension, or the main builder if there is none.
+func (config *Config) builder(ext string) Builder {
+	for _, b := range config.builders() {
+		if b.Ext == ext {
+			return b
+		}
+	}
+	return config.Builder
+}
+
+// validateBuilders checks that every content file has a single builder.
+func (config *Config) validateBuilders() error {
+	exts := make(map[string]bool)
+	for i, b := range config.Builders {
+		if b.Ext == "" {
+			return fmt.Errorf("builders[%d]: ext is required", i)
+		}
+		if b.Ext == config.Builder.Ext || exts[b.Ext] {
+			return fmt.Errorf("builders[%d]: %s files already have a builder", i, b.Ext)
+		}
+		exts[b.Ext] = true
+	}
+	return nil
+}
+
+// findRule returns the rule deriving the source files with the ext
+// extension, or nil if these files are not derived.
+func findRule(rules []*rule, ext string) *rule {
+	for _, r := range rules {
+		if r.ext != "" && r.ext == ext {
+			return r
+		}
+	}
+	return nil
+}
+
+// output returns the path in the dst tree of the output of the src file at
+// path, and the rule deriving it (nil if the file is linked).
+func (site *Site) output(rules []*rule, path string) (string, *rule) {
+	eqPath := filepath.Join(site.DstRoot, strings.TrimPrefix(path, site.SrcRoot))
+	ext := filepath.Ext(eqPath)
+	r := findRule(rules, ext)
+	if r != nil && !r.asset {
+		if rel, ok := site.permalink(r, site.srcRel(path)); ok {
+			return filepath.Join(site.DstRoot, filepath.FromSlash(rel)), r
+		}
+		if rel, ok := site.langPath(site.srcRel(path)); ok && r.page {
+			// about.fr.md is written to fr/about.html.
+			eqPath = filepath.Join(site.DstRoot, filepath.FromSlash(rel))
+		}
+		eqPath = strings.TrimSuffix(eqPath, ext) + r.outExt
+		if site.cleanURL(r, eqPath) {
+			// about.html is written to about/index.html.
+			eqPath = filepath.Join(strings.TrimSuffix(eqPath, r.outExt), "index.html")
+		}
+	} else if hashed, ok := site.assets[site.rel(eqPath)]; ok {
+		eqPath = filepath.Join(site.DstRoot, filepath.FromSlash(hashed))
+	}
+	return eqPath, r
+}
+
+// outputs returns the paths of all the outputs of the source whose output
+// by the rule r (nil for a linked file) is at dstPath.
+func (r *rule) outputs(dstPath string) []string {
+	if r == nil || r.variants == nil {
+		return []string{dstPath}
+	}
+	return append([]string{dstPath}, r.variants(dstPath)...)
+}
+
+// missingVariant reports whether one of the other outputs of the source
+// whose output is at dstPath is missing (e.g. it has been removed).
+func (r *rule) missingVariant(dstPath string) bool {
+	for _, outPath := range r.outputs(dstPath)[1:] {
+		if _, err := r.site.stat(outPath); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// stale reports whether the output of a rule is older than its source or
+// one of its dependencies. When the outputs have the time of their source,
+// an output is stale if its time differs from the one of its source (which
+// may have been replaced by an older version), or if a dependency changed
+// since the last build.
+func (r *rule) stale(srcPath string, srcInfo, dstInfo fs.FileInfo) (bool, error) {
+	if r.force {
+		return true, nil
+	}
+	if os.SameFile(srcInfo, dstInfo) {
+		// The output was linked to its source before the rule applied.
+		return true, nil
+	}
+	since := dstInfo.ModTime()
+	if r.preserveTimes {
+		if !r.byHash && !srcInfo.ModTime().Equal(dstInfo.ModTime()) {
+			return true, nil
+		}
+		since = r.since
+	} else if !r.byHash && srcInfo.ModTime().After(dstInfo.ModTime()) {
+		return true, nil
+	}
+	deps := r.deps
+	if r.srcDeps != nil {
+		srcDeps, err := r.srcDeps(srcPath)
+		if err != nil {
+			// The output is rebuilt, to report the error.
+			return true, nil
+		}
+		deps = append(slices.Clone(deps), srcDeps...)
+	}
+	for _, dep := range deps {
+		depInfo, err := r.site.stat(dep)
+		if err != nil {
+			return false, err
+		}
+		if depInfo.ModTime().After(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// finish gives the outputs of a rule at dstPath the permissions perm, those
+// of their source (see Site.fileMode), and its time if they are preserved.
+func (r *rule) finish(dstPath string, srcInfo fs.FileInfo, perm fs.FileMode) error {
+	for _, path := range r.outputs(dstPath) {
+		if err := r.site.chmod(path, perm); err != nil {
+			return err
+		}
+	}
+	if r.preserveTimes {
+		return r.site.chtimes(dstPath, srcInfo.ModTime())
+	}
+	return nil
+}
+
+func (site *Site) validateTransforms() error {
+	for i, t := range site.Transforms {
+		if t.Ext == "" || t.OutExt == "" || len(t.Cmd) == 0 {
+			return fmt.Errorf("site %s: transforms[%d]: ext, outExt and cmd are required", site.Name, i)
+		}
+	}
+	return nil
+}
+
+func (config *Config) transform(ctx context.Context, site *Site, t Transform, srcPath, dstPath string) error {
+	// The command writes a file of a private temporary directory, moved
+	// to the output once it succeeded, so that the output is never left
+	// partially written, and no other process can take its name.
+	tmpDir, err := os.MkdirTemp(site.tempDir(dstPath), tempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpPath := filepath.Join(tmpDir, filepath.Base(dstPath))
+	localPath, done, err := site.localFile(srcPath)
+	if err != nil {
+		return err
+	}
+	defer done()
+	env := append(config.env(site, srcPath, dstPath), "src_path="+localPath, "dst_path="+tmpPath)
+	argv := expandArgs(t.Cmd, env)
+	ctx, cancel := config.commandContext(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err = config.runCommand(ctx, cmd)
+	config.command(site, Command{Argv: cmd.Args, Duration: time.Since(start), Page: srcPath, Stderr: stderr.String()})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", argv[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", argv[0], err)
+	}
+	if _, err := os.Stat(tmpPath); err != nil {
+		return fmt.Errorf("%s did not write its output: %v", argv[0], err)
+	}
+	return site.moveFile(tmpPath, dstPath)
+}
+
+// cleanURL reports whether the page built by r at dstPath is written to
+// the index of a directory of its own.
+func (site *Site) cleanURL(r *rule, dstPath string) bool {
+	return site.CleanURLs && r.page && r.outExt == ".html" && filepath.Base(dstPath) != "index.html"
+}
+
+// outputDir reports whether the directory at dstPath in the dst tree holds
+// the output of a file of the src tree moved by clean URLs or permalinks,
+// or a next page of a listing. A directory of a page which is not built
+// (e.g. a draft) does not.
+func (site *Site) outputDir(rules []*rule, dstPath string) (bool, error) {
+	for outPath := range site.permalinked {
+		if under(outPath, dstPath) {
+			return true, nil
+		}
+	}
+	// The next pages of the listings and the stub pages of the aliases are
+	// recorded in the manifest.
+	for rel := range site.manifest {
+		outPath := filepath.Join(site.DstRoot, filepath.FromSlash(rel))
+		if !under(outPath, dstPath) {
+			continue
+		}
+		if derived, _, err := site.recorded(rules, outPath); err != nil || derived {
+			return derived, err
+		}
+	}
+	if !site.CleanURLs {
+		return false, nil
+	}
+	eqPath := filepath.Join(site.SrcRoot, strings.TrimPrefix(dstPath, site.DstRoot))
+	for _, r := range rules {
+		if r.ext == "" || !r.page || r.outExt != ".html" {
+			continue
+		}
+		srcPath := eqPath + r.ext
+		srcInfo, err := site.srcStat(srcPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		if err != nil || srcInfo.IsDir() {
+			continue
+		}
+		// A draft or a page to be published later is not output.
+		if outPath, r := site.output(rules, srcPath); under(outPath, dstPath) && !r.skipped(srcPath) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// derived reports whether the file at dstPath in the dst tree is the output
+// of a file in the src tree, either derived from it by a rule or linked to
+// it. The manifest of the last build tells it, if it records the file.
+func (site *Site) derived(rules []*rule, dstPath string, dstInfo fs.FileInfo) (bool, error) {
+	if isDirFile(dstPath) {
+		return false, nil
+	}
+	if derived, ok, err := site.recorded(rules, dstPath); ok || err != nil {
+		return derived, err
+	}
+	if site.permalinked[dstPath] {
+		// The drafts are not mapped.
+		return true, nil
+	}
+	ext := filepath.Ext(dstPath)
+	eqPath := filepath.Join(site.SrcRoot, strings.TrimPrefix(dstPath, site.DstRoot))
+	for _, r := range rules {
+		if r.ext == "" || r.outExt != ext {
+			continue
+		}
+		srcPaths := []string{strings.TrimSuffix(eqPath, ext) + r.ext}
+		if site.CleanURLs && filepath.Base(dstPath) == "index"+ext {
+			// about/index.html may be derived from about.md.
+			srcPaths = append(srcPaths, filepath.Dir(eqPath)+r.ext)
+		}
+		for _, srcPath := range srcPaths {
+			srcInfo, err := site.srcStat(srcPath)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return false, err
+			}
+			if err != nil || srcInfo.IsDir() {
+				continue
+			}
+			if outPath, r := site.output(rules, srcPath); outPath == dstPath {
+				return !r.skipped(srcPath), nil
+			}
+		}
+	}
+	if findRule(rules, ext) != nil {
+		// Such a source file is derived, not linked.
+		return false, nil
+	}
+	if rel, ok := site.hashed[site.rel(dstPath)]; ok {
+		// A fingerprinted asset is linked to the source without its hash.
+		eqPath = filepath.Join(site.SrcRoot, filepath.FromSlash(rel))
+	} else if site.fingerprinted(site.rel(dstPath)) {
+		// The asset has been renamed (or its content has changed).
+		return false, nil
+	}
+	srcInfo, err := site.srcStat(eqPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	if err != nil || srcInfo.IsDir() {
+		return false, nil
+	}
+	return site.placed(eqPath, srcInfo, dstPath, dstInfo)
+}
+
+// env returns the environment of the commands run to derive dstPath from
+// srcPath.
+func (config *Config) env(site *Site, srcPath, dstPath string) []string {
+	srcBase := filepath.Base(srcPath)
+	env := append(os.Environ(),
+		"page_name="+strings.TrimSuffix(srcBase, filepath.Ext(srcBase)),
+		"builder="+config.builder(filepath.Ext(srcPath)).Bin,
+		"site_name="+site.Name,
+		"src_path="+srcPath,
+		"dst_path="+dstPath,
+		"page_rel_path="+site.rel(dstPath),
+	)
+	if site.index != "" {
+		env = append(env, "site_index="+site.index)
+	}
+	if lang, _, _ := site.language(site.srcRel(srcPath)); lang != "" {
+		env = append(env, "lang="+lang)
+	}
+	if len(site.Fingerprint) > 0 && site.Dst == nil {
+		env = append(env, "asset_manifest="+filepath.Join(site.DstRoot, AssetManifest))
+	}
+	return append(env, site.Env...)
+}
+
+// expandArgs expands the variables of env in every argument of argv,
+// without any word splitting.
+func expandArgs(argv, env []string) []string {
+	vars := make(map[string]string)
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	expanded := make([]string, len(argv))
+	for i, arg := range argv {
+		expanded[i] = os.Expand(arg, func(k string) string { return vars[k] })
+	}
+	return expanded
+}
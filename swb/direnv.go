@@ -0,0 +1,120 @@
+package swb
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DirEnv is the name of the environment files of the directories of the
+// src trees: a JSON object of variables, added to the environment of the
+// commands of the templates of the pages under the directory. Like the
+// directory templates, these files are not part of the dst trees.
+const DirEnv = "_env.json"
+
+// isDirEnv reports whether the file at path is a directory environment.
+func isDirEnv(path string) bool {
+	return filepath.Base(path) == DirEnv
+}
+
+// isDirFile reports whether the file at path is a directory template or a
+// directory environment, which configure the pages under their directory
+// rather than being built themselves.
+func isDirFile(path string) bool {
+	return isDirTemplate(path) || isDirEnv(path)
+}
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// dirEnvFiles returns the paths of the environment files of the ancestor
+// directories of the src file at srcPath, the nearest last.
+func (site *Site) dirEnvFiles(srcPath string) []string {
+	var files []string
+	root := filepath.Clean(site.SrcRoot)
+	for dir := filepath.Dir(srcPath); ; dir = filepath.Dir(dir) {
+		envPath := filepath.Join(dir, DirEnv)
+		if info, err := site.stat(envPath); err == nil && !info.IsDir() {
+			files = append(files, envPath)
+		}
+		if filepath.Clean(dir) == root || !under(dir, root) {
+			break
+		}
+	}
+	slices.Reverse(files)
+	return files
+}
+
+// envVars returns the variables of the map m, sorted by name. The errors
+// are prefixed with what, where the map comes from.
+func envVars(m map[string]any, what string) ([]string, error) {
+	var env []string
+	for _, name := range slices.Sorted(maps.Keys(m)) {
+		if !envNameRe.MatchString(name) {
+			return nil, fmt.Errorf("%s: invalid variable name %q", what, name)
+		}
+		env = append(env, name+"="+frontMatterValue(m[name]))
+	}
+	return env, nil
+}
+
+// pageVars returns the variables of the page at srcPath with the front
+// matter fm: the ones of the environment files of its directories, the
+// nearest ones overriding the others, then the ones of the env map of its
+// front matter. They come after the site's env, which they override.
+func (site *Site) pageVars(srcPath string, fm map[string]any) ([]string, error) {
+	var env []string
+	for _, envPath := range site.dirEnvFiles(srcPath) {
+		b, err := site.readFile(envPath)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]any
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("%s: %v", envPath, err)
+		}
+		vars, err := envVars(m, envPath)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, vars...)
+	}
+	switch v := fm["env"].(type) {
+	case nil:
+	case map[string]any:
+		vars, err := envVars(v, "front matter: env")
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, vars...)
+	default:
+		return nil, fmt.Errorf("front matter: env %v is not a map of variables", v)
+	}
+	return env, nil
+}
+
+// pageDeps returns the files the page at srcPath depends on, besides the
+// site's template: its own template and the files it includes, and the
+// environment files of its directories.
+func (site *Site) pageDeps(srcPath string) ([]string, error) {
+	deps, err := site.templateDeps(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	return append(deps, site.dirEnvFiles(srcPath)...), nil
+}
+
+// envMap returns the variables env as a map, the last value of a variable
+// overriding the others.
+func envMap(env []string) map[string]string {
+	m := make(map[string]string)
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m[k] = v
+		}
+	}
+	return m
+}
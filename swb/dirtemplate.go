@@ -0,0 +1,31 @@
+package swb
+
+import (
+	"path/filepath"
+)
+
+// DirTemplate is the name of the templates of the directories of the src
+// trees: the pages under a directory holding one are built with it rather
+// than with the site's template. These templates are not part of the dst
+// trees.
+const DirTemplate = "_template.html"
+
+// isDirTemplate reports whether the file at path is a directory template.
+func isDirTemplate(path string) bool {
+	return filepath.Base(path) == DirTemplate
+}
+
+// dirTemplate returns the path of the directory template of the nearest
+// ancestor directory of the src file at srcPath, if any.
+func (site *Site) dirTemplate(srcPath string) (string, bool) {
+	root := filepath.Clean(site.SrcRoot)
+	for dir := filepath.Dir(srcPath); ; dir = filepath.Dir(dir) {
+		tplPath := filepath.Join(dir, DirTemplate)
+		if info, err := site.stat(tplPath); err == nil && !info.IsDir() {
+			return tplPath, true
+		}
+		if filepath.Clean(dir) == root || !under(dir, root) {
+			return "", false
+		}
+	}
+}
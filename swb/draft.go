@@ -0,0 +1,59 @@
+package swb
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isDraft reports whether the page with the front matter fm at srcPath is
+// a draft: its name starts with _ or its front matter has draft set to
+// true.
+func isDraft(srcPath string, fm map[string]any) bool {
+	if strings.HasPrefix(filepath.Base(srcPath), "_") {
+		return true
+	}
+	draft, _ := fm["draft"].(bool)
+	return draft
+}
+
+// publishDate returns the date at which the page with the front matter fm
+// is published: its publishDate, or else its date, or the zero time if it
+// has none or an invalid one.
+func publishDate(fm map[string]any) time.Time {
+	d := date(fm)
+	if v, ok := fm["publishDate"]; ok {
+		d = frontMatterValue(v)
+	}
+	t, _ := parseDate(d)
+	return t
+}
+
+// skipped reports whether the file at srcPath, derived by r, is a page
+// which is not built: a draft, or a page to be published in the future.
+// The date of the next page to be published is recorded in r.publish, so
+// that the site is built again once it is due.
+func (r *rule) skipped(srcPath string) bool {
+	if r == nil || !r.page || !r.skipDrafts && !r.skipFuture {
+		return false
+	}
+	if r.skipDrafts && strings.HasPrefix(filepath.Base(srcPath), "_") {
+		return true
+	}
+	b, err := r.site.readFile(srcPath)
+	if err != nil {
+		return false
+	}
+	// A page with an invalid front matter fails when built.
+	fm, _, _ := frontMatter(b)
+	if r.skipDrafts && isDraft(srcPath, fm) {
+		return true
+	}
+	if t := publishDate(fm); r.skipFuture && t.After(now()) {
+		if r.publish.IsZero() || t.Before(*r.publish) {
+			*r.publish = t
+		}
+		return true
+	}
+	return false
+}
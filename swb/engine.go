@@ -0,0 +1,179 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Template engines: the shell engine (the default) replaces the blocks of
+// the templates by the output of their commands, the Go engine renders
+// them with html/template.
+const (
+	EngineShell = "shell"
+	EngineGo    = "go"
+)
+
+// validateEngine checks the site's template engine.
+func (site *Site) validateEngine() error {
+	switch site.Engine {
+	case "", EngineShell, EngineGo:
+		return nil
+	}
+	return fmt.Errorf("site %s: unknown template engine %q", site.Name, site.Engine)
+}
+
+// A goSite is the site, in the data of the templates of the Go engine.
+type goSite struct {
+	Name    string
+	BaseURL string
+	// Variables of the site's env, by name.
+	Env map[string]string
+	// Every page of the site, as in the site index.
+	Pages []IndexEntry
+}
+
+// A goPage is the data of the page templates and of the archetype of a
+// site using the Go engine.
+type goPage struct {
+	IndexEntry
+	// Base name of the page, without its extension.
+	Name string
+	// Front matter of the page.
+	Params map[string]any
+	// Body of the page built by its builder.
+	Body template.HTML
+	// Table of contents of the body, if the page has one, as nested HTML
+	// lists and as the tree of its headings.
+	TOC      template.HTML
+	Headings []tocEntry
+	// Page of the listing, if the page is a paginated listing, or nil.
+	Paginator *paginator
+	// Environment of the page: the site's env, overridden by the
+	// environment files of its directories and the env of its front
+	// matter.
+	Env  map[string]string
+	Site goSite
+}
+
+// A goTaxonomy is the data of the taxonomy template of a site using the Go
+// engine.
+type goTaxonomy struct {
+	// Path of the page relative to the root of the dst tree.
+	Rel  string
+	Tags []tagEntry
+	// Name of the tag of the page, and its pages, empty for the index of
+	// the tags.
+	Tag   string
+	Pages []IndexEntry
+	// Page of the listing of the pages of the tag, or nil for the index
+	// of the tags.
+	Paginator *paginator
+	Site      goSite
+}
+
+// goSite returns the site, in the data of the templates of the Go engine.
+func (site *Site) goSite() goSite {
+	return goSite{Name: site.Name, BaseURL: site.BaseURL, Env: envMap(site.Env), Pages: site.entries}
+}
+
+// parseGo parses the template at tplPath, with its includes inlined, for
+// the Go engine.
+func (site *Site) parseGo(tplPath string) (*template.Template, error) {
+	t, err := site.loadTemplate(tplPath)
+	if err != nil {
+		return nil, err
+	}
+	return t.goTpl, nil
+}
+
+// executeGo renders the template at tplPath with the Go engine and data.
+func (site *Site) executeGo(tplPath string, data any) (string, error) {
+	t, err := site.parseGo(tplPath)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderGoPage renders the page at srcPath, with its front matter fm and its
+// body, written at dstPath, through the template at tplPath with the Go
+// engine. The body is built by the builder of the page, run by swb.
+func (config *Config) renderGoPage(ctx context.Context, site *Site, srcPath, dstPath, tplPath string, fm map[string]any, body []byte, pg *paginator) ([]byte, error) {
+	commit := site.lastCommit(srcPath)
+	pageVars, err := site.pageVars(srcPath, fm)
+	if err != nil {
+		return nil, err
+	}
+	env := append(append(config.env(site, srcPath, dstPath), pageVars...), "page_src_path="+srcPath)
+	env = append(env, gitEnv(commit, fm)...)
+	if _, ok := fm["lastmod"]; !ok && commit != nil {
+		if fm == nil {
+			fm = make(map[string]any)
+		}
+		fm["lastmod"] = commit.Date
+	}
+	content, err := config.buildBody(ctx, site, config.builder(filepath.Ext(srcPath)), body, env)
+	if err != nil {
+		return nil, err
+	}
+	var headings []tocEntry
+	if t := site.pageTOC(fm); t != nil {
+		content, headings = t.tableOfContents(content)
+	}
+	mtime := time.Now()
+	if srcInfo, err := site.stat(srcPath); err == nil {
+		mtime = srcInfo.ModTime()
+	} else if config.pageSrc == nil || !errors.Is(err, fs.ErrNotExist) {
+		// Only a page rendered from its content may have no file.
+		return nil, err
+	}
+	base := filepath.Base(srcPath)
+	rel := site.rel(dstPath)
+	data := goPage{
+		IndexEntry: IndexEntry{
+			Src:     srcPath,
+			Dst:     dstPath,
+			Rel:     rel,
+			URL:     site.url(rel),
+			Title:   title(fm),
+			Date:    date(fm),
+			Summary: summary(fm),
+			Tags:    tags(fm),
+			Mtime:   mtime.UTC(),
+			Git:     commit,
+		},
+		Name:      strings.TrimSuffix(base, filepath.Ext(base)),
+		Params:    fm,
+		Body:      template.HTML(content),
+		TOC:       template.HTML(tocHTML(headings)),
+		Headings:  headings,
+		Paginator: pg,
+		Env:       envMap(append(slices.Clone(site.Env), pageVars...)),
+		Site:      site.goSite(),
+	}
+	if e := site.entry(srcPath); e != nil {
+		data.Lang, data.Alternates = e.Lang, e.Alternates
+		data.Backlinks, data.Related = e.Backlinks, e.Related
+		data.Aliases = e.Aliases
+	}
+	built, err := site.executeGo(tplPath, data)
+	if err != nil {
+		return nil, err
+	}
+	page := site.rewriteAssets(dstPath, []byte(built))
+	if err := config.checkPage(site, dstPath, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
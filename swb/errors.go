@@ -0,0 +1,127 @@
+package swb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Phases of the processing of a site, in which errors can occur.
+const (
+	PhasePull        = "pull"
+	PhaseClean       = "clean"
+	PhasePreBuild    = "preBuild"
+	PhaseTemplate    = "template"
+	PhaseDst         = "dst"
+	PhaseFingerprint = "fingerprint"
+	PhaseTidy        = "tidy"
+	PhaseIndex       = "index"
+	PhaseWalk        = "walk"
+	PhaseBuild       = "build"
+	PhaseLink        = "link"
+	PhaseRedirects   = "redirects"
+	PhaseTaxonomy    = "taxonomy"
+	PhaseFeed        = "feed"
+	PhaseSitemap     = "sitemap"
+	PhaseSearch      = "search"
+	PhaseHighlight   = "highlight"
+	PhaseLinks       = "links"
+	PhasePrecompress = "precompress"
+	PhasePostBuild   = "postBuild"
+	PhaseManifest    = "manifest"
+	PhaseProvenance  = "provenance"
+	PhaseState       = "state"
+	PhasePostDeploy  = "postDeploy"
+)
+
+// A BuildError is an error that occurred in a phase of the processing of a
+// site, possibly on a given path. The errors of a site are joined (with
+// errors.Join), so that a failing site reports all of them.
+type BuildError struct {
+	Phase string
+	Path  string
+	Err   error
+}
+
+func (e *BuildError) Error() string {
+	if e.Path == "" {
+		if e.Phase == "" {
+			// An error of no phase, e.g. of the configuration.
+			return e.Err.Error()
+		}
+		return fmt.Sprintf("%s: %v", e.Phase, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Phase, e.Path, e.Err)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BuildError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Phase string `json:"phase"`
+		Path  string `json:"path,omitempty"`
+		Error string `json:"error"`
+	}{e.Phase, e.Path, e.Err.Error()})
+}
+
+// phaseError wraps err, if any, as a BuildError of the given phase.
+func phaseError(phase, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &BuildError{Phase: phase, Path: path, Err: err}
+}
+
+// buildErrors flattens the errors joined in err into BuildErrors.
+func buildErrors(err error) []*BuildError {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []*BuildError
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, buildErrors(err)...)
+		}
+		return errs
+	}
+	var buildErr *BuildError
+	if errors.As(err, &buildErr) {
+		return []*BuildError{buildErr}
+	}
+	return []*BuildError{{Err: err}}
+}
+
+// FormatErrors renders the errors joined in err grouped by phase, one per
+// line, or on a single line if there is only one.
+func FormatErrors(err error) string {
+	errs := buildErrors(err)
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	var phases []string
+	byPhase := make(map[string][]*BuildError)
+	for _, err := range errs {
+		if _, ok := byPhase[err.Phase]; !ok {
+			phases = append(phases, err.Phase)
+		}
+		byPhase[err.Phase] = append(byPhase[err.Phase], err)
+	}
+	var b strings.Builder
+	for _, phase := range phases {
+		fmt.Fprintf(&b, "\n  %s:", phase)
+		for _, err := range byPhase[phase] {
+			// The errors spanning several lines (e.g. the failures of the
+			// commands of a page) are indented under their first line.
+			msg := strings.ReplaceAll(err.Err.Error(), "\n", "\n      ")
+			if err.Path == "" {
+				fmt.Fprintf(&b, "\n    %s", msg)
+			} else {
+				fmt.Fprintf(&b, "\n    %s: %s", err.Path, msg)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestBuildErrorExit checks that the exit status of a failing snippet can
+// still be found in the errors joined for a site, each page failing on its
+// own.
+func TestBuildErrorExit(t *testing.T) {
+	config := tinySites(t, 1, false)
+	site := config.Sites[0]
+	if err := os.WriteFile(site.TplPath, []byte("%{\nexit 3\n}%\n%content%\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := config.BuildSite(context.Background(), site)
+	if err == nil {
+		t.Fatal("failing snippets built")
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("no *exec.ExitError in %v", err)
+	}
+	if code := exitErr.ExitCode(); code != 3 {
+		t.Errorf("exit code %d, want 3", code)
+	}
+	if errs := buildErrors(err); len(errs) != 2 {
+		t.Errorf("%d errors, want one per page: %v", len(errs), err)
+	}
+}
@@ -0,0 +1,78 @@
+package swb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandPath expands a leading ~ to the home directory of the user, and the
+// $VAR or ${VAR} references to the value of the environment variables. It
+// fails if one of the referenced variables is not set.
+func ExpandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	var unset []string
+	path = os.Expand(path, func(key string) string {
+		val, ok := os.LookupEnv(key)
+		if !ok {
+			unset = append(unset, "$"+key)
+		}
+		return val
+	})
+	if len(unset) > 0 {
+		return "", fmt.Errorf("%s not set", strings.Join(unset, ", "))
+	}
+	return path, nil
+}
+
+// expandPaths expands the paths of the site's configuration.
+func (site *Site) expandPaths() error {
+	fields := []struct {
+		name string
+		path *string
+	}{
+		{"srcRoot", &site.SrcRoot},
+		{"dstRoot", &site.DstRoot},
+		{"tplPath", &site.TplPath},
+		{"archetype", &site.Archetype},
+		{"buildLog", &site.BuildLog},
+	}
+	for _, field := range fields {
+		path, err := ExpandPath(*field.path)
+		if err != nil {
+			return fmt.Errorf("site %s: %s: %v", site.Name, field.name, err)
+		}
+		*field.path = path
+	}
+	return nil
+}
+
+// expandPaths expands the paths of the programs of the builders, i.e. the
+// first word of their bin. The rest of it is left to the template, whose
+// variables it can refer to.
+func (config *Config) expandPaths() error {
+	for i := -1; i < len(config.Builders); i++ {
+		b, name := &config.Builder, "builder"
+		if i >= 0 {
+			b, name = &config.Builders[i], fmt.Sprintf("builders[%d]", i)
+		}
+		bin := strings.TrimLeft(b.Bin, " \t")
+		end := strings.IndexAny(bin, " \t")
+		if end < 0 {
+			end = len(bin)
+		}
+		prog, err := ExpandPath(bin[:end])
+		if err != nil {
+			return fmt.Errorf("%s: bin: %v", name, err)
+		}
+		b.Bin = prog + bin[end:]
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package swb
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Feed is an Atom or RSS feed of the dated pages of a site, written in
+// its dst tree after each successful build.
+type Feed struct {
+	// Format of the feed, atom (the default) or rss.
+	Format string `json:"format,omitempty" toml:"format,omitempty" yaml:"format,omitempty"`
+	// Path of the feed relative to the root of the dst tree, atom.xml or
+	// rss.xml by default.
+	Path string `json:"path,omitempty" toml:"path,omitempty" yaml:"path,omitempty"`
+	// Title of the feed, the name of the site by default.
+	Title string `json:"title,omitempty" toml:"title,omitempty" yaml:"title,omitempty"`
+	// URL at which the root of the dst tree is published, the one of the
+	// site by default.
+	BaseURL string `json:"baseURL,omitempty" toml:"baseURL,omitempty" yaml:"baseURL,omitempty"`
+	// Section restricts the feed to the pages under this dst directory.
+	Section string `json:"section,omitempty" toml:"section,omitempty" yaml:"section,omitempty"`
+	// Maximum number of entries of the feed, 20 by default.
+	Limit int `json:"limit,omitempty" toml:"limit,omitempty" yaml:"limit,omitempty"`
+}
+
+// validateFeed checks the site's feed, and sets its defaults.
+func (site *Site) validateFeed() error {
+	feed := site.Feed
+	if feed == nil {
+		return nil
+	}
+	switch feed.Format {
+	case "":
+		feed.Format = "atom"
+	case "atom", "rss":
+	default:
+		return fmt.Errorf("site %s: feed: unknown format %q", site.Name, feed.Format)
+	}
+	if feed.Path == "" {
+		feed.Path = feed.Format + ".xml"
+	}
+	feed.Path = path.Clean(filepath.ToSlash(feed.Path))
+	if path.IsAbs(feed.Path) || feed.Path == ".." || strings.HasPrefix(feed.Path, "../") {
+		return fmt.Errorf("site %s: feed: path %s is not in the dst tree", site.Name, feed.Path)
+	}
+	if feed.BaseURL == "" {
+		feed.BaseURL = site.BaseURL
+	}
+	if feed.BaseURL == "" {
+		return fmt.Errorf("site %s: feed: baseURL is required", site.Name)
+	}
+	feed.BaseURL = strings.TrimSuffix(feed.BaseURL, "/")
+	feed.Section = strings.Trim(path.Clean("/"+filepath.ToSlash(feed.Section)), "/")
+	if feed.Title == "" {
+		feed.Title = site.Name
+	}
+	if feed.Limit < 0 {
+		return fmt.Errorf("site %s: feed: negative limit %d", site.Name, feed.Limit)
+	}
+	if feed.Limit == 0 {
+		feed.Limit = 20
+	}
+	return nil
+}
+
+// dateLayouts are the layouts of the page dates accepted in feeds.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	time.DateTime,
+	time.DateOnly,
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid date " + s)
+}
+
+// A feedEntry is a page of a feed.
+type feedEntry struct {
+	IndexEntry
+	date time.Time
+}
+
+// feedEntries returns the dated pages of the feed's section, the most
+// recent first. The pages without a date are left out, the ones with an
+// invalid date are reported as warnings.
+func (config *Config) feedEntries(site *Site, pages []IndexEntry) []feedEntry {
+	var entries []feedEntry
+	for _, page := range pages {
+		if site.Feed.Section != "" && !strings.HasPrefix(page.Rel, site.Feed.Section+"/") {
+			continue
+		}
+		if page.Date == "" {
+			continue
+		}
+		t, err := parseDate(page.Date)
+		if err != nil {
+			config.warn(site, page.Src, "feed: "+err.Error())
+			continue
+		}
+		entries = append(entries, feedEntry{page, t})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].date.After(entries[j].date) })
+	if len(entries) > site.Feed.Limit {
+		entries = entries[:site.Feed.Limit]
+	}
+	return entries
+}
+
+type atomLink struct {
+	Href     string `xml:"href,attr"`
+	Rel      string `xml:"rel,attr,omitempty"`
+	Hreflang string `xml:"hreflang,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Links   []atomLink `xml:"link"`
+	Updated string     `xml:"updated"`
+	Summary string     `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title,omitempty"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description,omitempty"`
+}
+
+type rssFeed struct {
+	XMLName     xml.Name  `xml:"rss"`
+	Version     string    `xml:"version,attr"`
+	Title       string    `xml:"channel>title"`
+	Link        string    `xml:"channel>link"`
+	Description string    `xml:"channel>description"`
+	Items       []rssItem `xml:"channel>item"`
+}
+
+// writeFeed writes the feed of the site, if it has one, from the entries of
+// its pages.
+func (config *Config) writeFeed(site *Site, pages []IndexEntry, outputs map[string]string) error {
+	feed := site.Feed
+	if feed == nil {
+		return nil
+	}
+	entries := config.feedEntries(site, pages)
+	// The feed is as recent as its most recent entry, so that it does not
+	// depend on the time of the build.
+	var updated time.Time
+	if len(entries) > 0 {
+		updated = entries[0].date
+	}
+	var v any
+	switch feed.Format {
+	case "atom":
+		f := atomFeed{
+			Title: feed.Title,
+			ID:    feed.BaseURL + "/",
+			Links: []atomLink{
+				{Href: feed.BaseURL + "/" + feed.Path, Rel: "self"},
+				{Href: feed.BaseURL + "/"},
+			},
+			Updated: updated.Format(time.RFC3339),
+		}
+		for _, e := range entries {
+			entry := atomEntry{
+				Title:   e.Title,
+				ID:      feed.BaseURL + e.URL,
+				Links:   []atomLink{{Href: feed.BaseURL + e.URL, Hreflang: e.Lang}},
+				Updated: e.date.Format(time.RFC3339),
+				Summary: e.Summary,
+			}
+			// The translations of the entry.
+			for _, alt := range e.Alternates {
+				if alt.URL != e.URL {
+					entry.Links = append(entry.Links, atomLink{Href: feed.BaseURL + alt.URL, Rel: "alternate", Hreflang: alt.Lang})
+				}
+			}
+			f.Entries = append(f.Entries, entry)
+		}
+		v = f
+	case "rss":
+		f := rssFeed{
+			Version:     "2.0",
+			Title:       feed.Title,
+			Link:        feed.BaseURL + "/",
+			Description: feed.Title,
+		}
+		for _, e := range entries {
+			f.Items = append(f.Items, rssItem{
+				Title:       e.Title,
+				Link:        feed.BaseURL + e.URL,
+				GUID:        feed.BaseURL + e.URL,
+				PubDate:     e.date.Format(time.RFC1123Z),
+				Description: e.Summary,
+			})
+		}
+		v = f
+	}
+	b, err := xml.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return config.writeGenerated(site, feed.Path, append([]byte(xml.Header), append(b, '\n')...), outputs)
+}
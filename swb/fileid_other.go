@@ -0,0 +1,11 @@
+//go:build !unix
+
+package swb
+
+import "io/fs"
+
+// fileID returns false, the identity of a file is not part of the
+// information about it on this platform (os.SameFile still compares it).
+func fileID(info fs.FileInfo) ([2]uint64, bool) {
+	return [2]uint64{}, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package swb
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID returns the device and inode numbers of the file described by
+// info, which are the same for all the hard links to this file.
+func fileID(info fs.FileInfo) ([2]uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return [2]uint64{}, false
+	}
+	return [2]uint64{uint64(st.Dev), uint64(st.Ino)}, true
+}
@@ -0,0 +1,131 @@
+package swb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// AssetManifest is the file written at the root of the dst tree, mapping
+// the dst-relative paths of the fingerprinted assets to their hashed paths.
+const AssetManifest = "asset-manifest.json"
+
+// fingerprinted reports whether the linked file at the dst-relative path
+// rel is fingerprinted, i.e. its base name matches one of the site's
+// fingerprint patterns.
+func (site *Site) fingerprinted(rel string) bool {
+	for _, pattern := range site.Fingerprint {
+		if ok, _ := filepath.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hashedName returns rel with the first characters of sum inserted before
+// its extension (e.g. css/style.3f9ab2.css).
+func hashedName(rel string, sum []byte) string {
+	ext := path.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + "." + hex.EncodeToString(sum)[:6] + ext
+}
+
+// fingerprintAssets hashes the content of the fingerprinted assets of the
+// site, to know their dst paths before the pages referencing them are
+// built (or the dst tree is tidied).
+func (site *Site) fingerprintAssets(rules []*rule) error {
+	site.assets = nil
+	site.hashed = nil
+	if len(site.Fingerprint) == 0 {
+		return nil
+	}
+	site.assets = make(map[string]string)
+	site.hashed = make(map[string]string)
+	return site.walkSrc(func(srcPath string, info fs.FileInfo) error {
+		if info.IsDir() || isDirFile(srcPath) {
+			return nil
+		}
+		if r := findRule(rules, filepath.Ext(srcPath)); r != nil && !r.asset {
+			return nil
+		}
+		rel := site.srcRel(srcPath)
+		if !site.fingerprinted(rel) {
+			return nil
+		}
+		f, err := site.open(srcPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		hashed := hashedName(rel, h.Sum(nil))
+		site.assets[rel] = hashed
+		site.hashed[hashed] = rel
+		return nil
+	})
+}
+
+// writeAssetManifest writes the asset manifest of the site, only if it
+// changed, as the pages depend on it: they are rebuilt when an asset they
+// may reference is renamed.
+func (site *Site) writeAssetManifest() error {
+	if site.assets == nil {
+		return nil
+	}
+	b, err := json.MarshalIndent(site.assets, "", "\t")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	manifestPath := filepath.Join(site.DstRoot, AssetManifest)
+	if old, err := site.readFile(manifestPath); err == nil && bytes.Equal(old, b) {
+		return nil
+	}
+	return site.writeFile(manifestPath, b, site.newFileMode())
+}
+
+// assetRefRe matches the URLs referenced by a page, in attributes or CSS.
+var assetRefRe = regexp.MustCompile(`(?i)(\b(?:src|href|poster|data)\s*=\s*["']?|url\(\s*["']?)([^"'\s>)]+)`)
+
+// rewriteAssets rewrites the references of the page at dstPath to the
+// fingerprinted assets, either absolute or relative to the page, to their
+// hashed names.
+func (site *Site) rewriteAssets(dstPath string, page []byte) []byte {
+	if len(site.assets) == 0 {
+		return page
+	}
+	dir := path.Dir(site.rel(dstPath))
+	return assetRefRe.ReplaceAllFunc(page, func(match []byte) []byte {
+		m := assetRefRe.FindSubmatch(match)
+		ref := string(m[2])
+		if strings.Contains(ref, ":") || strings.HasPrefix(ref, "//") {
+			// Not a path on the site (e.g. https://, data: or mailto:).
+			return match
+		}
+		refPath, suffix := ref, ""
+		if i := strings.IndexAny(ref, "?#"); i >= 0 {
+			refPath, suffix = ref[:i], ref[i:]
+		}
+		var rel string
+		if strings.HasPrefix(refPath, "/") {
+			rel = path.Clean(strings.TrimPrefix(refPath, "/"))
+		} else {
+			rel = path.Join(dir, refPath)
+		}
+		hashed, ok := site.assets[rel]
+		if !ok {
+			return match
+		}
+		ref = strings.TrimSuffix(refPath, path.Base(refPath)) + path.Base(hashed) + suffix
+		return append(append([]byte{}, m[1]...), ref...)
+	})
+}
@@ -0,0 +1,209 @@
+package swb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatter splits the front matter at the top of a page, either YAML
+// between "---" lines or TOML between "+++" lines, from its body. The front
+// matter is nil if the page has none.
+func frontMatter(page []byte) (map[string]any, []byte, error) {
+	var delim string
+	switch {
+	case bytes.HasPrefix(page, []byte("---\n")), bytes.HasPrefix(page, []byte("---\r\n")):
+		delim = "---"
+	case bytes.HasPrefix(page, []byte("+++\n")), bytes.HasPrefix(page, []byte("+++\r\n")):
+		delim = "+++"
+	default:
+		return nil, page, nil
+	}
+	_, rest, _ := bytes.Cut(page, []byte("\n"))
+	var lines [][]byte
+	for len(rest) > 0 {
+		var line []byte
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		if strings.TrimRight(string(line), "\r") == delim {
+			fm := make(map[string]any)
+			var err error
+			if delim == "+++" {
+				err = toml.Unmarshal(bytes.Join(lines, []byte("\n")), &fm)
+			} else {
+				err = yaml.Unmarshal(bytes.Join(lines, []byte("\n")), &fm)
+			}
+			return fm, rest, err
+		}
+		lines = append(lines, line)
+	}
+	return nil, page, errors.New("unterminated front matter")
+}
+
+// pageEnv returns the environment specific to the page at srcPath: its
+// front matter fm, and the path of its body stripped of the front matter in
+// src_path (the body is written to a temporary file, removed by removeBody).
+// The body is written as well if the page is a file of the site's Src, for
+// the commands to read it.
+func (site *Site) pageEnv(srcPath string, fm map[string]any, body []byte) ([]string, error) {
+	env := []string{"page_src_path=" + srcPath}
+	if _, ok := site.srcName(srcPath); fm == nil && !ok {
+		return env, nil
+	}
+	// The extension is kept, for the builders guessing the format of
+	// their input from it.
+	f, err := os.CreateTemp("", "swb-body-*"+filepath.Ext(srcPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(body); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return append(append(env, frontMatterEnv(fm)...), bodyVar+f.Name()), nil
+}
+
+const bodyVar = "src_path="
+
+// removeBody removes the body written by pageEnv, if any.
+func removeBody(env []string) {
+	for _, kv := range env {
+		if path, ok := strings.CutPrefix(kv, bodyVar); ok {
+			os.Remove(path)
+		}
+	}
+}
+
+// frontMatterEnv returns the front matter as fm_key environment variables.
+// Lists hold one element per line, and maps are encoded in JSON.
+func frontMatterEnv(fm map[string]any) []string {
+	var env []string
+	for _, key := range slices.Sorted(maps.Keys(fm)) {
+		name := strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, key)
+		env = append(env, "fm_"+name+"="+frontMatterValue(fm[key]))
+	}
+	return env
+}
+
+func frontMatterValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.RFC3339)
+	case []any:
+		values := make([]string, len(v))
+		for i, elem := range v {
+			values[i] = frontMatterValue(elem)
+		}
+		return strings.Join(values, "\n")
+	case map[string]any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// pageTemplate returns the path of the template of the page at srcPath
+// with the front matter fm: the template named by the template key of the
+// front matter, in the directory of the site's template, or else the
+// nearest directory template, or else the site's template.
+func (site *Site) pageTemplate(srcPath string, fm map[string]any) (string, error) {
+	v, ok := fm["template"]
+	if !ok {
+		if tplPath, ok := site.dirTemplate(srcPath); ok {
+			return tplPath, nil
+		}
+		return site.TplPath, nil
+	}
+	name, ok := v.(string)
+	if !ok || name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("front matter: template %v is not the name of a file in the directory of %s", v, site.TplPath)
+	}
+	return filepath.Join(filepath.Dir(site.TplPath), name), nil
+}
+
+// templateDeps returns the template of the page at srcPath and the files
+// it includes, if it is not the site's template (on which every page
+// depends).
+func (site *Site) templateDeps(srcPath string) ([]string, error) {
+	b, err := site.readFile(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	fm, _, err := frontMatter(b)
+	if err != nil {
+		return nil, err
+	}
+	tplPath, err := site.pageTemplate(srcPath, fm)
+	if err != nil || tplPath == site.TplPath {
+		return nil, err
+	}
+	t, err := site.loadTemplate(tplPath)
+	if err != nil {
+		return nil, err
+	}
+	return t.files, nil
+}
+
+// title returns the title of a page, from its front matter.
+func title(fm map[string]any) string {
+	if t, ok := fm["title"].(string); ok {
+		return t
+	}
+	return ""
+}
+
+// date returns the date of a page, from its front matter.
+func date(fm map[string]any) string {
+	if d, ok := fm["date"]; ok {
+		return frontMatterValue(d)
+	}
+	return ""
+}
+
+// summary returns the summary of a page, from its front matter.
+func summary(fm map[string]any) string {
+	if s, ok := fm["summary"].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// tags returns the tags of a page, from its front matter: a list, or a
+// single tag.
+func tags(fm map[string]any) []string {
+	switch v := fm["tags"].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var tags []string
+		for _, tag := range v {
+			if tag := frontMatterValue(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		return tags
+	}
+	return nil
+}
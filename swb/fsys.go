@@ -0,0 +1,604 @@
+package swb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A DstFS is a writable file system, to which the dst tree of a site can be
+// written (see Site.Dst). Its names are the ones of fs.FS: slash-separated
+// paths relative to its root, "." being the root itself.
+type DstFS interface {
+	fs.StatFS
+	fs.ReadDirFS
+	// MkdirAll creates the directory name, and its parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// WriteFile replaces the file name by one holding data, modified at
+	// mtime. Its directory exists.
+	WriteFile(name string, data []byte, perm fs.FileMode, mtime time.Time) error
+	// RemoveAll removes the file or the directory name, and its content.
+	RemoveAll(name string) error
+	// Chmod changes the permissions of the file name to perm.
+	Chmod(name string, perm fs.FileMode) error
+	// Chtimes changes the modification time of the file name to mtime.
+	Chtimes(name string, mtime time.Time) error
+}
+
+// DirFS returns the file system of the directory tree at dir.
+func DirFS(dir string) DstFS {
+	return dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(d.FS, name)
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(d.FS, name)
+}
+
+func (d dirFS) ReadLink(name string) (string, error) {
+	path, err := d.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(path)
+}
+
+// path returns the path of the file name, if it is valid.
+func (d dirFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(name)), nil
+}
+
+func (d dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	p, err := d.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
+}
+
+func (d dirFS) WriteFile(name string, data []byte, perm fs.FileMode, mtime time.Time) error {
+	p, err := d.path("write", name)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(p, data, perm); err != nil {
+		return err
+	}
+	return os.Chtimes(p, time.Now(), mtime)
+}
+
+func (d dirFS) RemoveAll(name string) error {
+	if name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	p, err := d.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+func (d dirFS) Chmod(name string, perm fs.FileMode) error {
+	p, err := d.path("chmod", name)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(p, perm)
+}
+
+func (d dirFS) Chtimes(name string, mtime time.Time) error {
+	p, err := d.path("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(p, time.Now(), mtime)
+}
+
+// A MemFS is a DstFS holding its files in memory (e.g. to serve a site
+// without writing it, or to check the output of a build). It can be read
+// while it is written.
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memFile
+	// Entries of the directories, by name, so that listing a directory
+	// does not go through all the files.
+	dirs map[string]map[string]*memFile
+}
+
+type memFile struct {
+	name  string
+	data  []byte
+	mode  fs.FileMode
+	mtime time.Time
+}
+
+func (f *memFile) Name() string               { return path.Base(f.name) }
+func (f *memFile) Size() int64                { return int64(len(f.data)) }
+func (f *memFile) Mode() fs.FileMode          { return f.mode }
+func (f *memFile) ModTime() time.Time         { return f.mtime }
+func (f *memFile) IsDir() bool                { return f.mode.IsDir() }
+func (f *memFile) Sys() any                   { return nil }
+func (f *memFile) Type() fs.FileMode          { return f.mode.Type() }
+func (f *memFile) Info() (fs.FileInfo, error) { return f, nil }
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: map[string]*memFile{".": {name: ".", mode: fs.ModeDir | 0755}},
+		dirs:  map[string]map[string]*memFile{".": {}},
+	}
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if f.IsDir() {
+		return &memDir{memFile: f, ents: m.readDir(name)}, nil
+	}
+	// The files are replaced rather than modified, so that the opened
+	// files keep reading the data they had.
+	return &memReader{memFile: f, Reader: bytes.NewReader(f.data)}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lookup("stat", name)
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, err := m.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return m.readDir(name), nil
+}
+
+func (m *MemFS) lookup(op, name string) (*memFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return f, nil
+}
+
+// readDir returns the entries of the directory name, sorted by name.
+func (m *MemFS) readDir(name string) []fs.DirEntry {
+	ents := make([]fs.DirEntry, 0, len(m.dirs[name]))
+	for _, f := range m.dirs[name] {
+		ents = append(ents, f)
+	}
+	slices.SortFunc(ents, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return ents
+}
+
+// put adds the file f to its directory, or replaces the file of its name.
+func (m *MemFS) put(f *memFile) {
+	m.files[f.name] = f
+	if f.name != "." {
+		m.dirs[path.Dir(f.name)][path.Base(f.name)] = f
+	}
+	if f.IsDir() && m.dirs[f.name] == nil {
+		m.dirs[f.name] = make(map[string]*memFile)
+	}
+}
+
+// remove removes the file name, and the content of the directory name.
+func (m *MemFS) remove(name string) {
+	for base := range m.dirs[name] {
+		m.remove(path.Join(name, base))
+	}
+	delete(m.dirs, name)
+	delete(m.files, name)
+	delete(m.dirs[path.Dir(name)], path.Base(name))
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	// The missing directories are created from the top.
+	var missing []string
+	for p := name; p != "."; p = path.Dir(p) {
+		if f, ok := m.files[p]; ok {
+			if !f.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: errors.New("not a directory")}
+			}
+			break
+		}
+		missing = append(missing, p)
+	}
+	for _, p := range slices.Backward(missing) {
+		m.put(&memFile{name: p, mode: fs.ModeDir | perm.Perm(), mtime: time.Now()})
+	}
+	return nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if dir, ok := m.files[path.Dir(name)]; !ok || !dir.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrNotExist}
+	}
+	if f, ok := m.files[name]; ok && f.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+	}
+	m.put(&memFile{name: name, data: slices.Clone(data), mode: perm.Perm(), mtime: mtime})
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, ok := m.files[name]; ok {
+		m.remove(name)
+	}
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("chmod", name)
+	if err != nil {
+		return err
+	}
+	c := *f
+	c.mode = f.mode.Type() | perm.Perm()
+	m.put(&c)
+	return nil
+}
+
+func (m *MemFS) Chtimes(name string, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	c := *f
+	c.mtime = mtime
+	m.put(&c)
+	return nil
+}
+
+// A memReader is an opened file of a MemFS.
+type memReader struct {
+	*memFile
+	*bytes.Reader
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) { return r.memFile, nil }
+func (r *memReader) Close() error               { return nil }
+
+// A memDir is an opened directory of a MemFS.
+type memDir struct {
+	*memFile
+	ents []fs.DirEntry
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.memFile, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		ents := d.ents
+		d.ents = nil
+		return ents, nil
+	}
+	if len(d.ents) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.ents))
+	ents := d.ents[:n]
+	d.ents = d.ents[n:]
+	return ents, nil
+}
+
+// The builds name the files of the trees of a site by their paths under
+// SrcRoot and DstRoot, whether the trees are directories or the site's Src
+// and Dst. The methods below do the file operations of the builds on such
+// paths: through Src and Dst for the files of the trees the site has them
+// for, and on the files at the paths otherwise (e.g. the templates).
+
+// srcName returns the name in the site's Src of the file at path, if the
+// site has a Src and path is in its src tree.
+func (site *Site) srcName(path string) (string, bool) {
+	if site.Src == nil {
+		return "", false
+	}
+	return treeName(site.SrcRoot, path)
+}
+
+// dstName returns the name in the site's Dst of the file at path, if the
+// site has a Dst and path is in its dst tree.
+func (site *Site) dstName(path string) (string, bool) {
+	if site.Dst == nil {
+		return "", false
+	}
+	return treeName(site.DstRoot, path)
+}
+
+// treeName returns the name of the file at path in the file system of the
+// tree at root, if path is in the tree.
+func treeName(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// treeError names the file of err, an error of the file system of the tree
+// at root, by its path.
+func treeError(root string, err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return &fs.PathError{Op: pe.Op, Path: filepath.Join(root, filepath.FromSlash(pe.Path)), Err: pe.Err}
+	}
+	return err
+}
+
+func (site *Site) stat(path string) (fs.FileInfo, error) {
+	if name, ok := site.srcName(path); ok {
+		info, err := fs.Stat(site.Src, name)
+		return info, treeError(site.SrcRoot, err)
+	}
+	if name, ok := site.dstName(path); ok {
+		info, err := site.Dst.Stat(name)
+		return info, treeError(site.DstRoot, err)
+	}
+	return os.Stat(path)
+}
+
+// lstatFS is implemented by the file systems reporting their symbolic
+// links (e.g. an os.DirFS).
+type lstatFS interface {
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// lstat is stat, not following the symbolic links. The files of a Dst are
+// never links, and the ones of a Src are followed unless it is an lstatFS.
+func (site *Site) lstat(path string) (fs.FileInfo, error) {
+	if name, ok := site.srcName(path); ok {
+		if l, ok := site.Src.(lstatFS); ok {
+			info, err := l.Lstat(name)
+			return info, treeError(site.SrcRoot, err)
+		}
+		return site.stat(path)
+	}
+	if _, ok := site.dstName(path); ok {
+		return site.stat(path)
+	}
+	return os.Lstat(path)
+}
+
+// readlinkFS is implemented by the file systems which can hold symbolic
+// links (like fs.ReadLinkFS).
+type readlinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// readlink returns the target of the symbolic link at path.
+func (site *Site) readlink(path string) (string, error) {
+	if name, ok := site.srcName(path); ok {
+		if l, ok := site.Src.(readlinkFS); ok {
+			target, err := l.ReadLink(name)
+			return target, treeError(site.SrcRoot, err)
+		}
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
+	}
+	if name, ok := site.dstName(path); ok {
+		if l, ok := site.Dst.(readlinkFS); ok {
+			target, err := l.ReadLink(name)
+			return target, treeError(site.DstRoot, err)
+		}
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(path)
+}
+
+func (site *Site) readFile(path string) ([]byte, error) {
+	if name, ok := site.srcName(path); ok {
+		b, err := fs.ReadFile(site.Src, name)
+		return b, treeError(site.SrcRoot, err)
+	}
+	if name, ok := site.dstName(path); ok {
+		b, err := fs.ReadFile(site.Dst, name)
+		return b, treeError(site.DstRoot, err)
+	}
+	return os.ReadFile(path)
+}
+
+func (site *Site) readDir(path string) ([]fs.DirEntry, error) {
+	if name, ok := site.srcName(path); ok {
+		ents, err := fs.ReadDir(site.Src, name)
+		return ents, treeError(site.SrcRoot, err)
+	}
+	if name, ok := site.dstName(path); ok {
+		ents, err := site.Dst.ReadDir(name)
+		return ents, treeError(site.DstRoot, err)
+	}
+	return os.ReadDir(path)
+}
+
+func (site *Site) open(path string) (fs.File, error) {
+	if name, ok := site.srcName(path); ok {
+		f, err := site.Src.Open(name)
+		return f, treeError(site.SrcRoot, err)
+	}
+	if name, ok := site.dstName(path); ok {
+		f, err := site.Dst.Open(name)
+		return f, treeError(site.DstRoot, err)
+	}
+	return os.Open(path)
+}
+
+// walkDst walks the dst tree of the site like filepath.WalkDir.
+func (site *Site) walkDst(fn fs.WalkDirFunc) error {
+	if site.Dst == nil {
+		return filepath.WalkDir(site.DstRoot, fn)
+	}
+	return fs.WalkDir(site.Dst, ".", func(name string, ent fs.DirEntry, err error) error {
+		return fn(filepath.Join(site.DstRoot, filepath.FromSlash(name)), ent, treeError(site.DstRoot, err))
+	})
+}
+
+// writeFile writes b to the file at path with the permissions perm, never
+// leaving it partially written (see writeFile).
+func (site *Site) writeFile(path string, b []byte, perm fs.FileMode) error {
+	if name, ok := site.dstName(path); ok {
+		return treeError(site.DstRoot, site.Dst.WriteFile(name, b, perm, time.Now()))
+	}
+	return writeFile(path, b, perm)
+}
+
+// writeReader is writeFile, with the content read from r.
+func (site *Site) writeReader(path string, r io.Reader, perm fs.FileMode) error {
+	if _, ok := site.dstName(path); ok {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return site.writeFile(path, b, perm)
+	}
+	return writeAtomic(path, r, perm)
+}
+
+func (site *Site) mkdirAll(path string, perm fs.FileMode) error {
+	if name, ok := site.dstName(path); ok {
+		return treeError(site.DstRoot, site.Dst.MkdirAll(name, perm))
+	}
+	return os.MkdirAll(path, perm)
+}
+
+// remove removes the file or the empty directory at path, like os.Remove.
+func (site *Site) remove(path string) error {
+	if name, ok := site.dstName(path); ok {
+		if _, err := site.Dst.Stat(name); err != nil {
+			return treeError(site.DstRoot, err)
+		}
+		if ents, err := site.Dst.ReadDir(name); err == nil && len(ents) > 0 {
+			return &fs.PathError{Op: "remove", Path: path, Err: errors.New("directory not empty")}
+		}
+		return treeError(site.DstRoot, site.Dst.RemoveAll(name))
+	}
+	return os.Remove(path)
+}
+
+func (site *Site) removeAll(path string) error {
+	if name, ok := site.dstName(path); ok {
+		return treeError(site.DstRoot, site.Dst.RemoveAll(name))
+	}
+	return os.RemoveAll(path)
+}
+
+func (site *Site) chmod(path string, perm fs.FileMode) error {
+	if name, ok := site.dstName(path); ok {
+		return treeError(site.DstRoot, site.Dst.Chmod(name, perm))
+	}
+	return os.Chmod(path, perm)
+}
+
+// chtimes changes the modification time of the file at path to mtime.
+func (site *Site) chtimes(path string, mtime time.Time) error {
+	if name, ok := site.dstName(path); ok {
+		return treeError(site.DstRoot, site.Dst.Chtimes(name, mtime))
+	}
+	return os.Chtimes(path, time.Now(), mtime)
+}
+
+// localFile returns the path of a file holding the file at path, for the
+// commands reading it: path itself, or a temporary copy for the files of
+// Src and Dst, with the same name (the commands may guess the format of
+// the file from its extension). The copy is removed by calling done.
+func (site *Site) localFile(path string) (local string, done func(), err error) {
+	_, inSrc := site.srcName(path)
+	_, inDst := site.dstName(path)
+	if !inSrc && !inDst {
+		return path, func() {}, nil
+	}
+	b, err := site.readFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp("", "swb-file-*")
+	if err != nil {
+		return "", nil, err
+	}
+	local = filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(local, b, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return local, func() { os.RemoveAll(dir) }, nil
+}
+
+// tempDir returns the directory of the temporary files moved to dstPath
+// once written (see moveFile): the one of dstPath, so that they can be
+// renamed, or the default one for the files of Dst.
+func (site *Site) tempDir(dstPath string) string {
+	if _, ok := site.dstName(dstPath); ok {
+		return ""
+	}
+	return filepath.Dir(dstPath)
+}
+
+// moveFile moves the file at tmpPath, in the directory returned by tempDir,
+// to dstPath.
+func (site *Site) moveFile(tmpPath, dstPath string) error {
+	if _, ok := site.dstName(dstPath); !ok {
+		return os.Rename(tmpPath, dstPath)
+	}
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return err
+	}
+	return site.writeFile(dstPath, b, info.Mode().Perm())
+}
@@ -0,0 +1,99 @@
+package swb
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// TestBuildFS checks that a site is built from a Src to a Dst without
+// touching the directories at its roots, incrementally, and that the
+// outputs of the files removed from Src are removed from Dst.
+func TestBuildFS(t *testing.T) {
+	config := tinySites(t, 1, false)
+	site := config.Sites[0]
+	site.Transforms = []Transform{{Ext: ".scss", OutExt: ".css", Cmd: []string{"cp", "$src_path", "$dst_path"}}}
+	// The directory at SrcRoot is not the src tree anymore.
+	writeFiles(t, site.SrcRoot, map[string]string{"notes.txt": "not a source\n"})
+	src := fstest.MapFS{
+		"index.md":       {Data: []byte("# Home\n")},
+		"about/index.md": {Data: []byte("# About\n")},
+		"style.scss":     {Data: []byte("body { margin: 0 }\n")},
+		"logo.svg":       {Data: []byte("<svg/>\n")},
+	}
+	dst := NewMemFS()
+	site.Src, site.Dst = src, dst
+	ctx := context.Background()
+	report, err := config.BuildSite(ctx, site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Built) != 3 || len(report.Linked) != 1 {
+		t.Errorf("built %v and linked %v, want 3 files and 1", report.Built, report.Linked)
+	}
+	for name, want := range map[string]string{
+		"index.html":       "<html>\n<h1>Home</h1>\n\n</html>\n",
+		"about/index.html": "<html>\n<h1>About</h1>\n\n</html>\n",
+		"style.css":        "body { margin: 0 }\n",
+		"logo.svg":         "<svg/>\n",
+	} {
+		b, err := fs.ReadFile(dst, name)
+		if err != nil {
+			t.Error(err)
+		} else if string(b) != want {
+			t.Errorf("%s = %q, want %q", name, b, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(site.SrcRoot, "notes.txt")); err != nil {
+		t.Errorf("file of the directory at SrcRoot: %v", err)
+	}
+	if _, err := os.Stat(site.DstRoot); !os.IsNotExist(err) {
+		t.Errorf("directory at DstRoot written: %v", err)
+	}
+	if report, err = config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Built)+len(report.Linked)+len(report.Removed) > 0 {
+		t.Errorf("up to date site built again: %+v", report)
+	}
+	delete(src, "about/index.md")
+	if report, err = config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(site.DstRoot, "about")}
+	if !slices.Equal(report.Removed, want) {
+		t.Errorf("removed %v, want %v", report.Removed, want)
+	}
+	if _, err := fs.Stat(dst, "about"); err == nil {
+		t.Error("output of a removed source left in Dst")
+	}
+}
+
+// TestMemFS checks the listings and the removals of a MemFS.
+func TestMemFS(t *testing.T) {
+	m := NewMemFS()
+	for _, name := range []string{"b/y", "a", "b/x", "b/c/z"} {
+		if err := m.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.WriteFile(name, []byte(name), 0644, now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fstest.TestFS(m, "a", "b/x", "b/y", "b/c/z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveAll("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(m, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Stat("b/c/z"); err == nil {
+		t.Error("file of a removed directory left")
+	}
+}
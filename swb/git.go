@@ -0,0 +1,75 @@
+package swb
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A GitCommit is the last commit of a page, when its src tree is in a git
+// repository.
+type GitCommit struct {
+	Hash string `json:"hash"`
+	// Date of the commit, in ISO 8601 (e.g. 2024-03-01T12:00:00+01:00).
+	Date   string `json:"date"`
+	Author string `json:"author"`
+}
+
+// gitLog returns the last commit of every file of the tree at dir, by path
+// relative to it, or nil if dir is not in a git repository. The history is
+// read at once, rather than file by file.
+func gitLog(dir string) map[string]*GitCommit {
+	out, err := exec.Command("git", "-C", dir, "-c", "core.quotePath=off",
+		"log", "--format=\x1e%H\x1f%aI\x1f%an", "--name-only", "--relative", "--no-renames", "--", ".").Output()
+	if err != nil {
+		return nil
+	}
+	commits := make(map[string]*GitCommit)
+	var commit *GitCommit
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if header, ok := strings.CutPrefix(line, "\x1e"); ok {
+			fields := strings.SplitN(header, "\x1f", 3)
+			if len(fields) != 3 {
+				return nil
+			}
+			commit = &GitCommit{Hash: fields[0], Date: fields[1], Author: fields[2]}
+			continue
+		}
+		// The history is read from the last commit.
+		if line != "" && commit != nil && commits[line] == nil {
+			commits[line] = commit
+		}
+	}
+	return commits
+}
+
+// lastCommit returns the last commit of the file of the src tree at
+// srcPath, or nil if it has none.
+func (site *Site) lastCommit(srcPath string) *GitCommit {
+	rel, err := filepath.Rel(site.SrcRoot, srcPath)
+	if err != nil {
+		return nil
+	}
+	return site.commits[filepath.ToSlash(rel)]
+}
+
+// gitEnv returns the variables of the last commit of a page, if it has
+// one. The lastmod key of its front matter fm defaults to its date.
+func gitEnv(commit *GitCommit, fm map[string]any) []string {
+	if commit == nil {
+		return nil
+	}
+	env := []string{
+		"git_last_commit_hash=" + commit.Hash,
+		"git_last_commit_date=" + commit.Date,
+		"git_author=" + commit.Author,
+	}
+	if _, ok := fm["lastmod"]; !ok {
+		env = append(env, "fm_lastmod="+commit.Date)
+	}
+	return env
+}
@@ -0,0 +1,96 @@
+package swb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// markerFiles are the files written by swb at the root of the dst trees,
+// which tell that a directory is one of them.
+var markerFiles = []string{ManifestFile, StateFile, ProvenanceFile}
+
+// checkCleanable checks that the dst tree of the site can safely be
+// cleaned: it must not overlap the src tree, and unless it is empty (but
+// for its lock file) it must hold one of the files swb writes in the dst
+// trees, so that a mistaken dstRoot (e.g. the home directory) is not wiped
+// out.
+func (site *Site) checkCleanable() error {
+	if err := site.checkOverlap(); err != nil {
+		return err
+	}
+	ents, err := site.readDir(site.DstRoot)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(ents, func(ent fs.DirEntry) bool { return ent.Name() != LockFile }) {
+		return nil
+	}
+	for _, name := range markerFiles {
+		if _, err := site.stat(filepath.Join(site.DstRoot, name)); err == nil {
+			return nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return fmt.Errorf("%s does not look like a dst tree built by swb, it holds no %s",
+		site.DstRoot, strings.Join(markerFiles, ", "))
+}
+
+// checkOverlap checks that the src and dst trees of the site do not
+// overlap, unless the dst tree is not in the file system.
+func (site *Site) checkOverlap() error {
+	if site.Dst != nil {
+		return nil
+	}
+	src, err := realPath(site.SrcRoot)
+	if err != nil {
+		return err
+	}
+	dst, err := realPath(site.DstRoot)
+	if err != nil {
+		return err
+	}
+	switch {
+	case within(src, dst):
+		return fmt.Errorf("dstRoot %s is inside srcRoot %s, its outputs would be built as sources (move it out, e.g. next to it)", site.DstRoot, site.SrcRoot)
+	case within(dst, src):
+		return fmt.Errorf("srcRoot %s is inside dstRoot %s, it would be removed as a stale output (move it out, e.g. next to it)", site.SrcRoot, site.DstRoot)
+	}
+	return nil
+}
+
+// checkTidy checks, before the tidy pass of a build removes a file from the
+// dst tree of the site, that the tree can safely be cleaned (see
+// checkCleanable), unless config.ForceClean is set. A tree holding only
+// outputs of the src tree is built over even without the files marking it
+// (e.g. one built by an older swb), since nothing is removed from it.
+func (config *Config) checkTidy(site *Site) error {
+	if config.ForceClean || site.cleanable {
+		return nil
+	}
+	if err := site.checkCleanable(); err != nil {
+		return fmt.Errorf("%w (clean it with swb clean -force to build it anyway)", err)
+	}
+	site.cleanable = true
+	return nil
+}
+
+// realPath returns the absolute path of path, with its symbolic links
+// resolved if it exists.
+func realPath(path string) (string, error) {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	return filepath.Abs(path)
+}
+
+// within reports whether the absolute path is dir or is under dir.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,352 @@
+package swb
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A Highlight is the syntax highlighting of the fenced code blocks of the
+// pages whose body is built by swb (see Builder.Stdin).
+type Highlight struct {
+	// Style of the highlighting, github by default.
+	Style string `json:"style,omitempty" toml:"style,omitempty" yaml:"style,omitempty"`
+	// CSS is the path, relative to the root of the dst tree, of the style
+	// sheet written after each build. If set, the tokens of the code get
+	// classes styled by it rather than inline styles.
+	CSS string `json:"css,omitempty" toml:"css,omitempty" yaml:"css,omitempty"`
+}
+
+// Kinds of the tokens of the highlighted code, which are their classes.
+const (
+	tokenComment = "c"
+	tokenKeyword = "k"
+	tokenString  = "s"
+	tokenNumber  = "m"
+)
+
+// A highlightStyle maps the kinds of tokens to their CSS declarations, the
+// empty kind being the code block itself.
+type highlightStyle map[string]string
+
+// highlightStyles are the styles of the highlighting, by name.
+var highlightStyles = map[string]highlightStyle{
+	"github": {
+		"":           "background-color: #f6f8fa; color: #24292e",
+		tokenComment: "color: #6a737d; font-style: italic",
+		tokenKeyword: "color: #d73a49",
+		tokenString:  "color: #032f62",
+		tokenNumber:  "color: #005cc5",
+	},
+	"monokai": {
+		"":           "background-color: #272822; color: #f8f8f2",
+		tokenComment: "color: #75715e",
+		tokenKeyword: "color: #f92672",
+		tokenString:  "color: #e6db74",
+		tokenNumber:  "color: #ae81ff",
+	},
+	"solarized-light": {
+		"":           "background-color: #fdf6e3; color: #657b83",
+		tokenComment: "color: #93a1a1; font-style: italic",
+		tokenKeyword: "color: #859900",
+		tokenString:  "color: #2aa198",
+		tokenNumber:  "color: #d33682",
+	},
+	"bw": {
+		"":           "background-color: #ffffff; color: #000000",
+		tokenComment: "font-style: italic",
+		tokenKeyword: "font-weight: bold",
+	},
+}
+
+// A lexer tells how to split the code of a language into tokens.
+type lexer struct {
+	// Prefixes of the line comments, and delimiters of the block ones.
+	lineComments  []string
+	blockComments [][2]string
+	// Quotes of the strings, and whether they can be tripled (e.g. Python
+	// docstrings).
+	quotes  string
+	triple  bool
+	keyword map[string]bool
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cLexer = &lexer{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		keyword: words(`auto break case char const continue default do double else enum extern float for goto
+			if inline int long register return short signed sizeof static struct switch typedef union
+			unsigned void volatile while bool true false NULL class namespace template typename public
+			private protected virtual new delete this nullptr using try catch throw`),
+	}
+	goLexer = &lexer{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"'`",
+		keyword: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var true false nil iota
+			bool byte error int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr
+			float32 float64 any`),
+	}
+	javaLexer = &lexer{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		keyword: words(`abstract boolean break byte case catch char class const continue default do double
+			else enum extends final finally float for if implements import instanceof int interface long
+			new package private protected public return short static super switch this throw throws try
+			void while true false null var record`),
+	}
+	jsLexer = &lexer{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        "\"'`",
+		keyword: words(`async await break case catch class const continue default delete do else export
+			extends finally for from function if import in instanceof let new of return static super
+			switch this throw try typeof var void while yield true false null undefined interface type
+			enum implements`),
+	}
+	pythonLexer = &lexer{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		triple:       true,
+		keyword: words(`and as assert async await break class continue def del elif else except finally
+			for from global if import in is lambda nonlocal not or pass raise return try while with yield
+			True False None self`),
+	}
+	rustLexer = &lexer{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"`,
+		keyword: words(`as async await break const continue crate dyn else enum extern false fn for if impl
+			in let loop match mod move mut pub ref return self Self static struct super trait true type
+			unsafe use where while bool char str i8 i16 i32 i64 u8 u16 u32 u64 usize isize f32 f64`),
+	}
+	shLexer = &lexer{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keyword: words(`if then else elif fi for while until do done case esac in function return local
+			export readonly shift exit break continue`),
+	}
+	cssLexer = &lexer{
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		keyword:       words(`@media @import @font-face @keyframes !important`),
+	}
+	dataLexer = &lexer{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keyword:      words(`true false null yes no`),
+	}
+)
+
+// lexers are the lexers of the languages, by the names given to fenced
+// code blocks.
+var lexers = map[string]*lexer{
+	"c": cLexer, "h": cLexer, "cpp": cLexer, "c++": cLexer, "cc": cLexer,
+	"go": goLexer, "golang": goLexer,
+	"java": javaLexer, "kotlin": javaLexer,
+	"js": jsLexer, "javascript": jsLexer, "ts": jsLexer, "typescript": jsLexer,
+	"py": pythonLexer, "python": pythonLexer,
+	"rs": rustLexer, "rust": rustLexer,
+	"sh": shLexer, "bash": shLexer, "shell": shLexer, "zsh": shLexer,
+	"css": cssLexer, "scss": cssLexer,
+	"json": dataLexer, "yaml": dataLexer, "yml": dataLexer, "toml": dataLexer,
+}
+
+// codeBlockRe matches the code blocks of a language in HTML, as written by
+// the internal builder and most Markdown converters.
+var codeBlockRe = regexp.MustCompile(`(?s)<pre><code class="language-([^"\s]+)">(.*?)</code></pre>`)
+
+// validateHighlight checks the site's highlighting, and sets its defaults.
+func (site *Site) validateHighlight() error {
+	hl := site.Highlight
+	if hl == nil {
+		return nil
+	}
+	if hl.Style == "" {
+		hl.Style = "github"
+	}
+	if _, ok := highlightStyles[hl.Style]; !ok {
+		return fmt.Errorf("site %s: highlight: unknown style %q", site.Name, hl.Style)
+	}
+	if hl.CSS != "" {
+		hl.CSS = path.Clean(filepath.ToSlash(hl.CSS))
+		if path.IsAbs(hl.CSS) || hl.CSS == ".." || strings.HasPrefix(hl.CSS, "../") {
+			return fmt.Errorf("site %s: highlight: css %s is not in the dst tree", site.Name, hl.CSS)
+		}
+	}
+	return nil
+}
+
+// highlightCode highlights the code blocks of the HTML body of a page
+// whose language is known, if the site highlights them.
+func (site *Site) highlightCode(body []byte) []byte {
+	hl := site.Highlight
+	if hl == nil {
+		return body
+	}
+	style := highlightStyles[hl.Style]
+	return codeBlockRe.ReplaceAllFunc(body, func(block []byte) []byte {
+		m := codeBlockRe.FindSubmatch(block)
+		lx, ok := lexers[strings.ToLower(string(m[1]))]
+		if !ok {
+			return block
+		}
+		var b strings.Builder
+		if hl.CSS != "" {
+			b.WriteString(`<pre class="highlight">`)
+		} else {
+			fmt.Fprintf(&b, `<pre style="%s">`, style[""])
+		}
+		fmt.Fprintf(&b, `<code class="language-%s">`, m[1])
+		for _, tok := range lx.tokens(html.UnescapeString(string(m[2]))) {
+			text := html.EscapeString(tok.text)
+			switch {
+			case tok.kind == "" || style[tok.kind] == "":
+				b.WriteString(text)
+			case hl.CSS != "":
+				fmt.Fprintf(&b, `<span class="%s">%s</span>`, tok.kind, text)
+			default:
+				fmt.Fprintf(&b, `<span style="%s">%s</span>`, style[tok.kind], text)
+			}
+		}
+		b.WriteString("</code></pre>")
+		return []byte(b.String())
+	})
+}
+
+type token struct {
+	kind, text string
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || isAlnum(c)
+}
+
+// tokens splits code into tokens.
+func (lx *lexer) tokens(code string) []token {
+	var toks []token
+	emit := func(kind, text string) {
+		if n := len(toks); n > 0 && toks[n-1].kind == kind {
+			toks[n-1].text += text
+		} else {
+			toks = append(toks, token{kind, text})
+		}
+	}
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		n, kind := lx.token(rest)
+		if n == 0 {
+			n = 1
+			if isIdent(code[i]) {
+				for n < len(rest) && isIdent(rest[n]) {
+					n++
+				}
+			}
+		}
+		emit(kind, rest[:n])
+		i += n
+	}
+	return toks
+}
+
+// token returns the length and the kind of the comment, string, number or
+// keyword starting s, or 0 if it starts none of them.
+func (lx *lexer) token(s string) (int, string) {
+	for _, prefix := range lx.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			if n := strings.IndexByte(s, '\n'); n >= 0 {
+				return n, tokenComment
+			}
+			return len(s), tokenComment
+		}
+	}
+	for _, delims := range lx.blockComments {
+		if strings.HasPrefix(s, delims[0]) {
+			if n := strings.Index(s[len(delims[0]):], delims[1]); n >= 0 {
+				return len(delims[0]) + n + len(delims[1]), tokenComment
+			}
+			return len(s), tokenComment
+		}
+	}
+	if c := s[0]; strings.IndexByte(lx.quotes, c) >= 0 {
+		if q := strings.Repeat(string(c), 3); lx.triple && strings.HasPrefix(s, q) {
+			if n := strings.Index(s[3:], q); n >= 0 {
+				return n + 6, tokenString
+			}
+			return len(s), tokenString
+		}
+		for n := 1; n < len(s); n++ {
+			switch s[n] {
+			case '\\':
+				n++
+			case c:
+				return n + 1, tokenString
+			case '\n':
+				if c != '`' {
+					return n, tokenString
+				}
+			}
+		}
+		return len(s), tokenString
+	}
+	if c := s[0]; c >= '0' && c <= '9' {
+		n := 1
+		for n < len(s) && (isIdent(s[n]) || s[n] == '.') {
+			n++
+		}
+		return n, tokenNumber
+	}
+	n := 0
+	for n < len(s) && (isIdent(s[n]) || n == 0 && strings.IndexByte("@!", s[n]) >= 0) {
+		n++
+	}
+	if n > 0 && lx.keyword[s[:n]] {
+		return n, tokenKeyword
+	}
+	return 0, ""
+}
+
+// highlightCSS returns the style sheet of the highlighted code blocks of
+// the style.
+func highlightCSS(style highlightStyle) []byte {
+	kinds := make([]string, 0, len(style))
+	for kind := range style {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	var b strings.Builder
+	for _, kind := range kinds {
+		if kind == "" {
+			fmt.Fprintf(&b, "pre.highlight { %s; }\n", style[kind])
+		} else {
+			fmt.Fprintf(&b, ".highlight .%s { %s; }\n", kind, style[kind])
+		}
+	}
+	return []byte(b.String())
+}
+
+// writeHighlightCSS writes the style sheet of the highlighted code blocks
+// of the site, if it has one.
+func (config *Config) writeHighlightCSS(site *Site, outputs map[string]string) error {
+	hl := site.Highlight
+	if hl == nil || hl.CSS == "" {
+		return nil
+	}
+	return config.writeGenerated(site, hl.CSS, highlightCSS(highlightStyles[hl.Style]), outputs)
+}
@@ -0,0 +1,91 @@
+package swb
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestLexerTokens checks the tokens the code of a few languages is split
+// into.
+func TestLexerTokens(t *testing.T) {
+	tests := []struct {
+		lx   *lexer
+		code string
+		toks []token
+	}{
+		{
+			goLexer,
+			"// hi\nfunc f() int { return len(\"a\\\"b\") + 0x2a /* x */ }",
+			[]token{
+				{tokenComment, "// hi"}, {"", "\n"},
+				{tokenKeyword, "func"}, {"", " f() "}, {tokenKeyword, "int"}, {"", " { "},
+				{tokenKeyword, "return"}, {"", " len("}, {tokenString, `"a\"b"`}, {"", ") + "},
+				{tokenNumber, "0x2a"}, {"", " "}, {tokenComment, "/* x */"}, {"", " }"},
+			},
+		},
+		{
+			pythonLexer,
+			"def f():\n    '''doc'''\n    return 1 # one",
+			[]token{
+				{tokenKeyword, "def"}, {"", " f():\n    "}, {tokenString, "'''doc'''"}, {"", "\n    "},
+				{tokenKeyword, "return"}, {"", " "}, {tokenNumber, "1"}, {"", " "}, {tokenComment, "# one"},
+			},
+		},
+		{
+			goLexer,
+			"s := \"unterminated\nx",
+			[]token{{"", "s := "}, {tokenString, "\"unterminated"}, {"", "\nx"}},
+		},
+		{
+			goLexer,
+			"returned",
+			[]token{{"", "returned"}},
+		},
+	}
+	for _, tt := range tests {
+		if toks := tt.lx.tokens(tt.code); !slices.Equal(toks, tt.toks) {
+			t.Errorf("%q: tokens %q, want %q", tt.code, toks, tt.toks)
+		}
+	}
+}
+
+// TestHighlightCode checks the code blocks highlighted with inline styles
+// and with classes, and that the blocks of unknown languages are left as
+// they are.
+func TestHighlightCode(t *testing.T) {
+	const body = "<pre><code class=\"language-go\">return &quot;&lt;&quot;</code></pre>\n" +
+		"<pre><code class=\"language-cobol\">return</code></pre>"
+	tests := []struct {
+		hl   Highlight
+		want string
+	}{
+		{
+			Highlight{Style: "github"},
+			"<pre style=\"background-color: #f6f8fa; color: #24292e\"><code class=\"language-go\">" +
+				"<span style=\"color: #d73a49\">return</span> <span style=\"color: #032f62\">&#34;&lt;&#34;</span></code></pre>\n" +
+				"<pre><code class=\"language-cobol\">return</code></pre>",
+		},
+		{
+			Highlight{Style: "github", CSS: "hl.css"},
+			"<pre class=\"highlight\"><code class=\"language-go\">" +
+				"<span class=\"k\">return</span> <span class=\"s\">&#34;&lt;&#34;</span></code></pre>\n" +
+				"<pre><code class=\"language-cobol\">return</code></pre>",
+		},
+	}
+	for _, tt := range tests {
+		site := &Site{Name: "site", Highlight: &tt.hl}
+		if got := string(site.highlightCode([]byte(body))); got != tt.want {
+			t.Errorf("highlight %+v: %q, want %q", tt.hl, got, tt.want)
+		}
+	}
+}
+
+// TestHighlightCSS checks the style sheet of a style.
+func TestHighlightCSS(t *testing.T) {
+	const want = "pre.highlight { background-color: #ffffff; color: #000000; }\n" +
+		".highlight .c { font-style: italic; }\n" +
+		".highlight .k { font-weight: bold; }\n"
+	if got := string(highlightCSS(highlightStyles["bw"])); got != want {
+		t.Errorf("bw style sheet %q, want %q", got, want)
+	}
+}
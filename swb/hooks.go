@@ -0,0 +1,100 @@
+package swb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Hooks are the commands run around the builds and the deployments of a
+// site, from the directory of the configuration file.
+type Hooks struct {
+	// PreBuild hooks run before every build, before the src tree is
+	// walked, so that the files they write in it are built (e.g. a Sass
+	// compiler).
+	PreBuild []Hook `json:"preBuild,omitempty" toml:"preBuild,omitempty" yaml:"preBuild,omitempty"`
+	// PostBuild hooks run after every build which changed the dst tree
+	// (e.g. a link checker). The build is not recorded until they succeed.
+	PostBuild []Hook `json:"postBuild,omitempty" toml:"postBuild,omitempty" yaml:"postBuild,omitempty"`
+	// PostDeploy hooks run after every successful deployment (e.g. to purge
+	// the cache of a CDN).
+	PostDeploy []Hook `json:"postDeploy,omitempty" toml:"postDeploy,omitempty" yaml:"postDeploy,omitempty"`
+}
+
+// A Hook is a command, whose arguments can refer to the variables of the
+// site's environment (e.g. $dst_root). The failure of a hook fails the
+// build, unless it is optional.
+type Hook struct {
+	Cmd      []string `json:"cmd" toml:"cmd" yaml:"cmd"`
+	Optional bool     `json:"optional,omitempty" toml:"optional,omitempty" yaml:"optional,omitempty"`
+}
+
+// validateHooks checks the site's hooks.
+func (site *Site) validateHooks() error {
+	if site.Hooks == nil {
+		return nil
+	}
+	for _, phase := range []string{PhasePreBuild, PhasePostBuild, PhasePostDeploy} {
+		for i, h := range site.hooks(phase) {
+			if len(h.Cmd) == 0 {
+				return fmt.Errorf("site %s: hooks: %s[%d]: cmd is required", site.Name, phase, i)
+			}
+		}
+	}
+	return nil
+}
+
+// hooks returns the site's hooks of the phase.
+func (site *Site) hooks(phase string) []Hook {
+	if site.Hooks == nil {
+		return nil
+	}
+	switch phase {
+	case PhasePreBuild:
+		return site.Hooks.PreBuild
+	case PhasePostBuild:
+		return site.Hooks.PostBuild
+	case PhasePostDeploy:
+		return site.Hooks.PostDeploy
+	}
+	return nil
+}
+
+// runHooks runs the site's hooks of the phase in order, stopping at the
+// first failing one unless it is optional, whose failure is only reported
+// as a warning. The hooks are not run by a dry run.
+func (config *Config) runHooks(ctx context.Context, site *Site, phase string, env ...string) error {
+	if config.DryRun || len(site.hooks(phase)) == 0 {
+		return nil
+	}
+	env = append(append(os.Environ(),
+		"site_name="+site.Name,
+		"src_root="+site.SrcRoot,
+		"dst_root="+site.DstRoot,
+	), append(env, site.Env...)...)
+	for i, h := range site.hooks(phase) {
+		argv := expandArgs(h.Cmd, env)
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Env = env
+		t := time.Now()
+		out, err := cmd.CombinedOutput()
+		config.command(site, Command{Argv: cmd.Args, Duration: time.Since(t)})
+		if err == nil {
+			continue
+		}
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			err = fmt.Errorf("%s: %w: %s", argv[0], err, msg)
+		} else {
+			err = fmt.Errorf("%s: %w", argv[0], err)
+		}
+		if h.Optional && ctx.Err() == nil {
+			config.warn(site, fmt.Sprintf("%s[%d]", phase, i), err.Error())
+			continue
+		}
+		return err
+	}
+	return nil
+}
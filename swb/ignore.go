@@ -0,0 +1,102 @@
+package swb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the file at the root of a src tree listing, one per line,
+// more patterns of the files to ignore than the ones of the configuration.
+// The empty lines and the lines starting with # are skipped.
+const IgnoreFile = ".swbignore"
+
+// validateIgnore checks the site's ignore patterns.
+func (site *Site) validateIgnore() error {
+	for i, pattern := range site.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("site %s: ignore[%d]: %s: %v", site.Name, i, pattern, err)
+		}
+	}
+	return nil
+}
+
+// loadIgnore loads the ignore patterns of the site, from its configuration
+// and its ignore file. The ignore file itself is always ignored.
+func (site *Site) loadIgnore() error {
+	site.ignores = append([]string{IgnoreFile}, site.Ignore...)
+	ignorePath := filepath.Join(site.SrcRoot, IgnoreFile)
+	b, err := site.readFile(ignorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", ignorePath, i+1, line, err)
+		}
+		site.ignores = append(site.ignores, line)
+	}
+	return nil
+}
+
+// ignored reports whether the file at srcPath in the src tree, or one of its
+// directories, matches an ignore pattern. A pattern without a slash is
+// matched against the base name of the files, and a pattern with a slash
+// against their path relative to the src tree root, where ** matches any
+// number of directories (e.g. *.swp, .git or drafts/**).
+func (site *Site) ignored(srcPath string) bool {
+	return site.matchRel(site.ignores, srcPath)
+}
+
+// matchRel reports whether the file at srcPath in the src tree, or one of
+// its directories, matches one of the patterns, as described for ignored.
+func (site *Site) matchRel(patterns []string, srcPath string) bool {
+	rel := site.srcRel(srcPath)
+	if rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		if !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		patParts := strings.Split(pattern, "/")
+		for i := range parts {
+			if matchParts(patParts, parts[:i+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchParts reports whether the slash separated parts of a path match the
+// ones of a pattern.
+func matchParts(patParts, parts []string) bool {
+	if len(patParts) == 0 {
+		return len(parts) == 0
+	}
+	if patParts[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchParts(patParts[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(patParts[0], parts[0])
+	return ok && matchParts(patParts[1:], parts[1:])
+}
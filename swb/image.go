@@ -0,0 +1,201 @@
+package swb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// An Image tells how the images with a given extension are processed when
+// they are placed in the dst tree, rather than linked.
+type Image struct {
+	// Extension of the images, .jpg, .jpeg or .png.
+	Ext string `json:"ext" toml:"ext" yaml:"ext"`
+	// Maximum width of the images, which are scaled down to it.
+	MaxWidth int `json:"maxWidth,omitempty" toml:"maxWidth,omitempty" yaml:"maxWidth,omitempty"`
+	// Quality of the JPEG images, from 1 to 100 (75 by default).
+	Quality int `json:"quality,omitempty" toml:"quality,omitempty" yaml:"quality,omitempty"`
+	// Widths of the variants of the images, written next to them as
+	// name-width.ext (e.g. photo-800.jpg). The images are never scaled up.
+	Widths []int `json:"widths,omitempty" toml:"widths,omitempty" yaml:"widths,omitempty"`
+	// WebP is the command writing the WebP version of the image and of
+	// each of its variants, like the command of a transform.
+	WebP []string `json:"webp,omitempty" toml:"webp,omitempty" yaml:"webp,omitempty"`
+}
+
+// imageExts are the extensions of the images which can be processed.
+var imageExts = []string{".jpg", ".jpeg", ".png"}
+
+// validateImages checks the site's image processing.
+func (site *Site) validateImages() error {
+	exts := make(map[string]bool)
+	for i, img := range site.Images {
+		if !slices.Contains(imageExts, img.Ext) {
+			return fmt.Errorf("site %s: images[%d]: cannot process %q images", site.Name, i, img.Ext)
+		}
+		if exts[img.Ext] {
+			return fmt.Errorf("site %s: images[%d]: %s images are already processed", site.Name, i, img.Ext)
+		}
+		exts[img.Ext] = true
+		if img.MaxWidth < 0 {
+			return fmt.Errorf("site %s: images[%d]: negative maxWidth %d", site.Name, i, img.MaxWidth)
+		}
+		if img.Quality < 0 || img.Quality > 100 {
+			return fmt.Errorf("site %s: images[%d]: quality %d is not between 1 and 100", site.Name, i, img.Quality)
+		}
+		for _, w := range img.Widths {
+			if w <= 0 {
+				return fmt.Errorf("site %s: images[%d]: invalid width %d", site.Name, i, w)
+			}
+		}
+	}
+	return nil
+}
+
+// imageRules returns the rules processing the images of the site which
+// would otherwise be linked.
+func (config *Config) imageRules(site *Site, rules []*rule) []*rule {
+	var images []*rule
+	for _, img := range site.Images {
+		if findRule(rules, img.Ext) != nil {
+			continue
+		}
+		images = append(images, &rule{
+			ext:    img.Ext,
+			outExt: img.Ext,
+			asset:  true,
+			variants: func(dstPath string) []string {
+				return img.variants(dstPath)
+			},
+			build: func(ctx context.Context, srcPath, dstPath string) error {
+				return config.processImage(ctx, site, img, srcPath, dstPath)
+			},
+		})
+	}
+	return images
+}
+
+// widthPath returns the path of the variant of width w of the image at
+// dstPath.
+func widthPath(dstPath string, w int) string {
+	ext := filepath.Ext(dstPath)
+	return strings.TrimSuffix(dstPath, ext) + "-" + strconv.Itoa(w) + ext
+}
+
+// webpPath returns the path of the WebP version of the image at dstPath.
+func webpPath(dstPath string) string {
+	return strings.TrimSuffix(dstPath, filepath.Ext(dstPath)) + ".webp"
+}
+
+// variants returns the paths of the variants of the image at dstPath.
+func (img Image) variants(dstPath string) []string {
+	var paths []string
+	for _, w := range img.Widths {
+		paths = append(paths, widthPath(dstPath, w))
+	}
+	if len(img.WebP) > 0 {
+		for _, p := range append([]string{dstPath}, paths...) {
+			paths = append(paths, webpPath(p))
+		}
+	}
+	return paths
+}
+
+// processImage writes the image at srcPath, scaled down to the maximum
+// width, to dstPath, and its variants next to it.
+func (config *Config) processImage(ctx context.Context, site *Site, img Image, srcPath, dstPath string) error {
+	f, err := site.open(srcPath)
+	if err != nil {
+		return err
+	}
+	m, format, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	outputs := []string{dstPath}
+	if err := site.writeImage(dstPath, scaleImage(m, img.MaxWidth), format, img.Quality); err != nil {
+		return err
+	}
+	for _, w := range img.Widths {
+		p := widthPath(dstPath, w)
+		if err := site.writeImage(p, scaleImage(m, w), format, img.Quality); err != nil {
+			return err
+		}
+		outputs = append(outputs, p)
+	}
+	if len(img.WebP) > 0 {
+		t := Transform{Ext: img.Ext, OutExt: ".webp", Cmd: img.WebP}
+		for _, p := range outputs {
+			if err := config.transform(ctx, site, t, p, webpPath(p)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeImage encodes m in the format to the file at path.
+func (site *Site) writeImage(path string, m image.Image, format string, quality int) error {
+	var b bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		if quality == 0 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&b, m, &jpeg.Options{Quality: quality})
+	case "png":
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&b, m)
+	default:
+		err = fmt.Errorf("cannot encode %s images", format)
+	}
+	if err != nil {
+		return err
+	}
+	return site.writeFile(path, b.Bytes(), 0644)
+}
+
+// scaleImage returns m scaled down to the width w, keeping its aspect
+// ratio, or m itself if it is not wider. Every pixel of the scaled image
+// is the average of the pixels of m it covers.
+func scaleImage(m image.Image, w int) image.Image {
+	b := m.Bounds()
+	if w <= 0 || b.Dx() <= w {
+		return m
+	}
+	h := max(1, (b.Dy()*w+b.Dx()/2)/b.Dx())
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), m, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		y0, y1 := y*b.Dy()/h, max((y+1)*b.Dy()/h, y*b.Dy()/h+1)
+		for x := range w {
+			x0, x1 := x*b.Dx()/w, max((x+1)*b.Dx()/w, x*b.Dx()/w+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			i := y*dst.Stride + x*4
+			for c := range sum {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
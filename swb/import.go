@@ -0,0 +1,175 @@
+package swb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// An importer converts an existing static HTML site into a swb src tree and
+// a template. It is heuristic: the template is made of the leading and
+// trailing lines shared by the pages, and each page's source holds the lines
+// in between.
+type importer struct {
+	from, to, tplOut string
+	ext              string
+	force            bool
+	w                io.Writer
+}
+
+type importedPage struct {
+	path  string
+	lines []string
+	// Number of leading and trailing lines shared with the reference page.
+	prefix, suffix int
+}
+
+// An importedFile is a file to be written by the import.
+type importedFile struct {
+	path    string
+	content []byte
+	note    string
+}
+
+// Import converts the existing static HTML site in the from directory into
+// a src tree in the to directory and a template at tplOut, the sources of
+// the pages having the ext extension. It never overwrites existing files
+// unless force is set, and reports every file written to w.
+func Import(from, to, tplOut, ext string, force bool, w io.Writer) error {
+	imp := &importer{from: from, to: to, tplOut: tplOut, ext: ext, force: force, w: w}
+	return imp.run()
+}
+
+func (imp *importer) run() error {
+	var pages []*importedPage
+	var files []importedFile
+	err := filepath.WalkDir(imp.from, func(path string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ent.IsDir() {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(path) == ".html" {
+			pages = append(pages, &importedPage{path: path, lines: strings.SplitAfter(string(b), "\n")})
+			return nil
+		}
+		// Resources are copied as is.
+		rel, err := filepath.Rel(imp.from, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, importedFile{path: filepath.Join(imp.to, rel), content: b})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(pages) < 2 {
+		return fmt.Errorf("at least two HTML pages are needed to find a template")
+	}
+	prefix, suffix := boilerplate(pages)
+	if prefix+suffix == 0 {
+		return fmt.Errorf("the pages have nothing in common")
+	}
+	ref := pages[0]
+	var tpl strings.Builder
+	tpl.WriteString(strings.Join(ref.lines[:prefix], ""))
+	if prefix > 0 && !strings.HasSuffix(ref.lines[prefix-1], "\n") {
+		tpl.WriteString("\n")
+	}
+	tpl.WriteString("%{\n\tcat \"$src_path\"\n}%\n")
+	tpl.WriteString(strings.Join(ref.lines[len(ref.lines)-suffix:], ""))
+	files = append(files, importedFile{
+		path:    imp.tplOut,
+		content: []byte(tpl.String()),
+		note:    fmt.Sprintf("template: %d leading and %d trailing lines", prefix, suffix),
+	})
+	for _, page := range pages {
+		rel, err := filepath.Rel(imp.from, page.path)
+		if err != nil {
+			return err
+		}
+		if page.prefix < prefix || page.suffix < suffix {
+			// The page does not fit the template, it is kept as is.
+			files = append(files, importedFile{
+				path:    filepath.Join(imp.to, rel),
+				content: []byte(strings.Join(page.lines, "")),
+				note:    "too divergent, copied verbatim",
+			})
+			continue
+		}
+		files = append(files, importedFile{
+			path:    filepath.Join(imp.to, strings.TrimSuffix(rel, ".html")+imp.ext),
+			content: []byte(strings.Join(page.lines[prefix:len(page.lines)-suffix], "")),
+			note:    fmt.Sprintf("%d lines of content", len(page.lines)-prefix-suffix),
+		})
+	}
+	// Nothing is written unless every file can be.
+	if !imp.force {
+		for _, f := range files {
+			if _, err := os.Stat(f.path); err == nil {
+				return fmt.Errorf("%s already exists (use -force to overwrite)", f.path)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.path, f.content, 0644); err != nil {
+			return err
+		}
+		if f.note != "" {
+			fmt.Fprintf(imp.w, " + %s (%s)\n", f.path, f.note)
+		} else {
+			fmt.Fprintf(imp.w, " + %s\n", f.path)
+		}
+	}
+	return nil
+}
+
+// boilerplate computes the number of leading and trailing lines of the
+// template. Every page is compared to the first one (the reference), and
+// the pages sharing less than half as many lines with it as the median page
+// are considered too divergent to be taken into account.
+func boilerplate(pages []*importedPage) (int, int) {
+	ref := pages[0]
+	var prefixes, suffixes []int
+	for _, page := range pages[1:] {
+		n := min(len(page.lines), len(ref.lines))
+		for page.prefix < n && page.lines[page.prefix] == ref.lines[page.prefix] {
+			page.prefix++
+		}
+		for page.suffix < n-page.prefix && page.lines[len(page.lines)-1-page.suffix] == ref.lines[len(ref.lines)-1-page.suffix] {
+			page.suffix++
+		}
+		prefixes = append(prefixes, page.prefix)
+		suffixes = append(suffixes, page.suffix)
+	}
+	slices.Sort(prefixes)
+	slices.Sort(suffixes)
+	medPrefix, medSuffix := prefixes[len(prefixes)/2], suffixes[len(suffixes)/2]
+	prefix, suffix := medPrefix, medSuffix
+	for _, page := range pages[1:] {
+		if page.prefix*2 < medPrefix || page.suffix*2 < medSuffix {
+			continue
+		}
+		prefix = min(prefix, page.prefix)
+		suffix = min(suffix, page.suffix)
+	}
+	// The reference fits its own template.
+	ref.prefix, ref.suffix = prefix, suffix
+	return prefix, suffix
+}
@@ -0,0 +1,68 @@
+package swb
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// includeRe returns the regexp matching the include directives of the
+// site's templates: the opening delimiter with an i after its first
+// character, the path of the included file and the closing delimiter, on a
+// single line (e.g. %i{partials/nav.html}%).
+func (site *Site) includeRe() *regexp.Regexp {
+	if site.includes == nil {
+		open, close := site.delimiters()
+		// The delimiter is split after its first character, not byte.
+		_, n := utf8.DecodeRuneInString(open)
+		site.includes = regexp.MustCompile(regexp.QuoteMeta(open[:n]) + "i" + regexp.QuoteMeta(open[n:]) + `([^\n]*?)` + regexp.QuoteMeta(close))
+	}
+	return site.includes
+}
+
+// readTemplate reads the template at tplPath with its includes inlined, and
+// returns the paths of all the files it is made of, tplPath first.
+func (site *Site) readTemplate(tplPath string) (string, []string, error) {
+	var files []string
+	tpl, err := site.inline(tplPath, nil, &files)
+	return tpl, files, err
+}
+
+// inline reads the file at path and recursively inlines its includes,
+// whose paths are relative to the directory of the including file. stack
+// holds the including files, to detect cycles.
+func (site *Site) inline(path string, stack []string, files *[]string) (string, error) {
+	if slices.Contains(stack, path) {
+		return "", fmt.Errorf("include cycle: %s", strings.Join(append(stack, path), " -> "))
+	}
+	b, err := site.readFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(*files, path) {
+		*files = append(*files, path)
+	}
+	stack = append(slices.Clone(stack), path)
+	includeRe := site.includeRe()
+	var inlineErr error
+	tpl := includeRe.ReplaceAllStringFunc(string(b), func(match string) string {
+		if inlineErr != nil {
+			return match
+		}
+		name := strings.TrimSpace(includeRe.FindStringSubmatch(match)[1])
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(path), name)
+		}
+		included, err := site.inline(name, stack, files)
+		if err != nil {
+			inlineErr = err
+			return match
+		}
+		// A directive alone on its line does not add an empty line.
+		return strings.TrimSuffix(included, "\n")
+	})
+	return tpl, inlineErr
+}
@@ -0,0 +1,29 @@
+package swb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestIncludeDelimiters checks the includes and the blocks of templates
+// whose delimiters are not ASCII.
+func TestIncludeDelimiters(t *testing.T) {
+	config := fixtureSite(t, map[string]string{
+		"site.tpl":          "⟦i partials/nav.html⟧\n%content%\n",
+		"partials/nav.html": "<nav>\n⟦\necho \"home\"\n⟧\n</nav>\n",
+		"src/index.md":      "# Home\n",
+	}, map[string]any{"delimiters": []string{"⟦", "⟧"}})
+	site := config.Sites[0]
+	if _, err := config.BuildSite(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(site.DstRoot, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<nav>\nhome\n\n</nav>\n<h1>Home</h1>\n\n"; string(b) != want {
+		t.Errorf("index.html = %q, want %q", b, want)
+	}
+}
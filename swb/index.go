@@ -0,0 +1,142 @@
+package swb
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An IndexEntry describes a page of a site, in the site index exported to
+// the template commands.
+type IndexEntry struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+	Rel string `json:"rel"`
+	// URL of the page, relative to the root of the site.
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	// Date and summary of the page, from its front matter.
+	Date    string    `json:"date,omitempty"`
+	Summary string    `json:"summary,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Mtime   time.Time `json:"mtime"`
+	// Last commit of the page, if its src tree is in a git repository.
+	Git *GitCommit `json:"git,omitempty"`
+	// Language of the page, if the site has languages, and its versions in
+	// every language if it is translated.
+	Lang       string      `json:"lang,omitempty"`
+	Alternates []Alternate `json:"alternates,omitempty"`
+	// Pages linking to the page, and pages sharing its tags.
+	Backlinks []PageRef `json:"backlinks,omitempty"`
+	Related   []PageRef `json:"related,omitempty"`
+	// Former URLs of the page, redirecting to it (see Redirects).
+	Aliases []string `json:"aliases,omitempty"`
+	// URLs linked by the source of the page.
+	links []string
+	// listing is set if the page is a paginated listing of the pages of
+	// the dst directory section (see writeListings).
+	listing bool
+	section string
+}
+
+// pages returns the entries of all the pages of the site, sorted by source
+// path so that they do not depend on the order in which they are built.
+func (site *Site) pages(rules []*rule) ([]IndexEntry, error) {
+	entries := []IndexEntry{}
+	err := site.walkSrc(func(path string, info fs.FileInfo) error {
+		if info.IsDir() || isDirFile(path) {
+			return nil
+		}
+		dstPath, r := site.output(rules, path)
+		if r == nil || !r.page || r.skipped(path) {
+			return nil
+		}
+		b, err := site.readFile(path)
+		if err != nil {
+			return err
+		}
+		// A page with an invalid front matter fails when built.
+		fm, body, _ := frontMatter(b)
+		section, listing := listing(fm, site.rel(dstPath))
+		var urls []string
+		for _, alias := range aliases(fm) {
+			if u, ok := aliasURL(site.rel(dstPath), alias); ok {
+				urls = append(urls, u)
+			}
+		}
+		entries = append(entries, IndexEntry{
+			Src:     path,
+			Dst:     dstPath,
+			Rel:     site.rel(dstPath),
+			URL:     site.url(site.rel(dstPath)),
+			Title:   title(fm),
+			Date:    date(fm),
+			Summary: summary(fm),
+			Tags:    tags(fm),
+			Mtime:   info.ModTime().UTC(),
+			Git:     site.lastCommit(path),
+			Aliases: urls,
+			links:   srcLinks(body),
+			listing: listing,
+			section: section,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Src < entries[j].Src })
+	site.setAlternates(entries)
+	site.setRelations(entries)
+	return entries, nil
+}
+
+// writeIndex writes the index of the pages entries to a temporary file, and
+// returns its path.
+func writeIndex(entries []IndexEntry) (string, error) {
+	return writeTempJSON("swb-index-*.json", entries)
+}
+
+// writeTempJSON writes v in JSON to a new temporary file named after
+// pattern, and returns its path.
+func writeTempJSON(pattern string, v any) (string, error) {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return writeTemp(pattern, append(b, '\n'))
+}
+
+// writeTemp writes b to a new temporary file named after pattern, and
+// returns its path.
+func writeTemp(pattern string, b []byte) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// url returns the URL of the page at the dst-relative path rel: with clean
+// URLs, the one of its directory rather than of its index.
+func (site *Site) url(rel string) string {
+	if site.CleanURLs && path.Base(rel) == "index.html" {
+		return "/" + strings.TrimSuffix(rel, "index.html")
+	}
+	return "/" + rel
+}
+
+// rel returns the path of dstPath relative to the root of the dst tree.
+func (site *Site) rel(dstPath string) string {
+	return filepath.ToSlash(strings.TrimPrefix(strings.TrimPrefix(dstPath, site.DstRoot), string(filepath.Separator)))
+}
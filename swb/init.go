@@ -0,0 +1,95 @@
+package swb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// initConfig is the configuration written by Init, where %[1]s is the name
+// of the site.
+const initConfig = `{
+    "runCmd": ["bash", "-c"],
+    "builder": {
+        "ext": ".md",
+        "bin": "internal"
+    },
+    "sites": [
+        {
+            "name": "%[1]s",
+            "srcRoot": "src/%[1]s",
+            "dstRoot": "dst/%[1]s",
+            "tplPath": "tpl/%[1]s.tpl"
+        }
+    ]
+}
+`
+
+// initTemplate is the template written by Init.
+const initTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>
+%{
+	# The commands between the delimiters are run by runCmd, and the
+	# page is made of their output. The body of the page, built by its
+	# builder, replaces the content token.
+	echo "$page_name - $site_name"
+}%
+</title>
+</head>
+<body>
+%content%
+</body>
+</html>
+`
+
+// initPage is the example page written by Init.
+const initPage = `# Hello
+
+This page is built from *src/%s/index.md*: edit it, then run ` + "`swb build`" + `.
+`
+
+// Init creates a new project in dir, made of a configuration for the site
+// name, a template, a src tree holding an example page, and an empty dst
+// tree. It never overwrites existing files unless force is set, and reports
+// every file written to w.
+func Init(dir, name string, force bool, w io.Writer) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid site name %q", name)
+	}
+	files := []importedFile{
+		{path: filepath.Join(dir, "config.json"), content: fmt.Appendf(nil, initConfig, name)},
+		{path: filepath.Join(dir, "tpl", name+".tpl"), content: []byte(initTemplate)},
+		{path: filepath.Join(dir, "src", name, "index.md"), content: fmt.Appendf(nil, initPage, name)},
+	}
+	// Nothing is written unless every file can be.
+	if !force {
+		for _, f := range files {
+			if _, err := os.Stat(f.path); err == nil {
+				return fmt.Errorf("%s already exists (use -force to overwrite)", f.path)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.path, f.content, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, " + %s\n", f.path)
+	}
+	dstRoot := filepath.Join(dir, "dst", name)
+	if err := os.MkdirAll(dstRoot, 0755); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, " + %s%c\n", dstRoot, filepath.Separator)
+	return nil
+}
@@ -0,0 +1,95 @@
+package swb
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// kept reports whether the dst-relative path rel matches one of the site's
+// keep patterns, or one of the artifacts generated by swb itself.
+func (site *Site) kept(rel string) bool {
+	return matchAny(site.keepPatterns(), rel)
+}
+
+// matchAny reports whether the dst-relative path rel matches one of the
+// patterns.
+func matchAny(patterns []string, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keepsUnder reports whether a keep pattern may match something below the
+// dst-relative directory rel, in which case the directory cannot be removed
+// as a whole.
+func (site *Site) keepsUnder(rel string) bool {
+	relParts := strings.Split(filepath.ToSlash(rel), "/")
+	for _, pattern := range site.keepPatterns() {
+		patParts := strings.Split(pattern, "/")
+		if len(patParts) <= len(relParts) {
+			continue
+		}
+		under := true
+		for i, part := range relParts {
+			if ok, _ := filepath.Match(patParts[i], part); !ok {
+				under = false
+				break
+			}
+		}
+		if under {
+			return true
+		}
+	}
+	return false
+}
+
+func (site *Site) keepPatterns() []string {
+	return append(append([]string{}, site.Keep...), site.generated...)
+}
+
+// generate registers the dst-relative path of a file generated by swb (e.g. a
+// sitemap or a feed), so that it is never considered as an orphan.
+func (site *Site) generate(rel string) {
+	site.generated = append(site.generated, filepath.ToSlash(rel))
+}
+
+// writeGenerated writes b to the file generated by swb at the dst-relative
+// path rel, only if its content changed, so that its modification time is
+// the one of its last change (e.g. the tag pages are left as they are by
+// the builds which do not change them). outputs maps the dst paths of the
+// files of the src tree to them, a generated file cannot replace one of
+// them.
+func (config *Config) writeGenerated(site *Site, rel string, b []byte, outputs map[string]string) error {
+	dstPath := filepath.Join(site.DstRoot, filepath.FromSlash(rel))
+	if src, ok := outputs[dstPath]; ok {
+		return fmt.Errorf("%s is also the output of %s", dstPath, src)
+	}
+	action := ActionBuild
+	if old, err := site.readFile(dstPath); err == nil {
+		if bytes.Equal(old, b) {
+			config.action(site, ActionSkip, dstPath, 0)
+			return nil
+		}
+		action = ActionRebuild
+	}
+	if config.DryRun {
+		config.action(site, action, dstPath, 0)
+		return nil
+	}
+	if err := site.mkdirAll(filepath.Dir(dstPath), site.dirMode()); err != nil {
+		return err
+	}
+	t := time.Now()
+	if err := site.writeFile(dstPath, b, site.newFileMode()); err != nil {
+		return err
+	}
+	config.action(site, action, dstPath, time.Since(t))
+	return nil
+}
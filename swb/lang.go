@@ -0,0 +1,110 @@
+package swb
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// An Alternate is the version of a page in a language.
+type Alternate struct {
+	Lang string `json:"lang"`
+	// URL of the page, relative to the root of the site.
+	URL string `json:"url"`
+}
+
+// langRe matches the language tags (e.g. fr or pt-BR).
+var langRe = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]+)*$`)
+
+// validateLanguages checks the site's languages.
+func (site *Site) validateLanguages() error {
+	for i, lang := range site.Languages {
+		if !langRe.MatchString(lang) {
+			return fmt.Errorf("site %s: languages[%d]: invalid language tag %q (e.g. \"en\" or \"pt-BR\")", site.Name, i, lang)
+		}
+		if slices.Contains(site.Languages[:i], lang) {
+			return fmt.Errorf("site %s: languages[%d]: duplicate language %s", site.Name, i, lang)
+		}
+	}
+	return nil
+}
+
+// language returns the language of the page at the src-relative path rel:
+// the one of its suffix (e.g. about.fr.md), or else the one of its top
+// directory (e.g. fr/about.md), or else the default language of the site.
+// key is the path shared by the versions of the page in every language
+// (e.g. about.md), and suffixed is set if its language is its suffix. The
+// language is empty if the site has none.
+func (site *Site) language(rel string) (lang, key string, suffixed bool) {
+	if len(site.Languages) == 0 {
+		return "", rel, false
+	}
+	dir, base := path.Split(rel)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	if suffix := path.Ext(name); suffix != "" && slices.Contains(site.Languages, suffix[1:]) {
+		return suffix[1:], dir + strings.TrimSuffix(name, suffix) + ext, true
+	}
+	if top, rest, ok := strings.Cut(rel, "/"); ok && slices.Contains(site.Languages, top) {
+		return top, rest, false
+	}
+	return site.Languages[0], rel, false
+}
+
+// langPath returns the src-relative path rel of a page whose language is
+// its suffix as if it were in the directory of its language instead (e.g.
+// about.fr.md as fr/about.md), so that the pages of every language are
+// built to parallel trees. The pages of the default language stay at the
+// root.
+func (site *Site) langPath(rel string) (string, bool) {
+	lang, key, suffixed := site.language(rel)
+	if !suffixed {
+		return "", false
+	}
+	if lang == site.Languages[0] {
+		return key, true
+	}
+	return lang + "/" + key, true
+}
+
+// setAlternates sets the language of the pages entries, and the versions
+// of those translated in other languages, in the order of the languages.
+func (site *Site) setAlternates(entries []IndexEntry) {
+	if len(site.Languages) == 0 {
+		return
+	}
+	byKey := make(map[string][]int)
+	for i := range entries {
+		lang, key, _ := site.language(site.srcRel(entries[i].Src))
+		entries[i].Lang = lang
+		byKey[key] = append(byKey[key], i)
+	}
+	for _, versions := range byKey {
+		if len(versions) < 2 {
+			continue
+		}
+		var alternates []Alternate
+		for _, i := range versions {
+			alternates = append(alternates, Alternate{Lang: entries[i].Lang, URL: entries[i].URL})
+		}
+		sort.SliceStable(alternates, func(i, j int) bool {
+			return slices.Index(site.Languages, alternates[i].Lang) < slices.Index(site.Languages, alternates[j].Lang)
+		})
+		for _, i := range versions {
+			entries[i].Alternates = alternates
+		}
+	}
+}
+
+// entry returns the entry of the page at srcPath among the entries of the
+// build, or nil if there is none.
+func (site *Site) entry(srcPath string) *IndexEntry {
+	i := sort.Search(len(site.entries), func(i int) bool { return site.entries[i].Src >= srcPath })
+	if i < len(site.entries) && site.entries[i].Src == srcPath {
+		return &site.entries[i]
+	}
+	return nil
+}
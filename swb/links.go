@@ -0,0 +1,208 @@
+package swb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A LinkCheck is the check of the internal links of the pages of a site,
+// run after every build: the links and the assets referenced by the HTML
+// files of the dst tree must resolve to files of the dst tree.
+type LinkCheck struct {
+	// Strict, if true, makes the build fail on broken links, rather than
+	// reporting them as warnings.
+	Strict bool `json:"strict,omitempty" toml:"strict,omitempty" yaml:"strict,omitempty"`
+	// Ignore are the patterns of the paths of the links left unchecked
+	// (e.g. /api/*), as for path.Match.
+	Ignore []string `json:"ignore,omitempty" toml:"ignore,omitempty" yaml:"ignore,omitempty"`
+}
+
+// validateLinkCheck checks the patterns of the site's link check.
+func (site *Site) validateLinkCheck() error {
+	if site.LinkCheck == nil {
+		return nil
+	}
+	for i, pattern := range site.LinkCheck.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("site %s: linkCheck: ignore[%d]: invalid pattern %q", site.Name, i, pattern)
+		}
+	}
+	return nil
+}
+
+// A BrokenLink is a link of a page of the dst tree to a file which does
+// not exist.
+type BrokenLink struct {
+	// Page is the path of the page holding the link, and Line the line of
+	// the link.
+	Page string
+	Line int
+	URL  string
+}
+
+func (l BrokenLink) String() string {
+	return fmt.Sprintf("%s:%d: broken link %s", l.Page, l.Line, l.URL)
+}
+
+var (
+	// linkSkipRe matches the parts of the pages whose links are not
+	// checked: the comments, scripts and styles.
+	linkSkipRe = regexp.MustCompile(`(?is)<!--.*?-->|<script\b.*?</script>|<style\b.*?</style>`)
+	linkTagRe  = regexp.MustCompile(`<[A-Za-z][^>]*>`)
+	linkAttrRe = regexp.MustCompile(`(?i)\s(href|src|srcset|poster)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	schemeRe   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+)
+
+// pageLinks returns the URLs referenced by the attributes of the tags of
+// the HTML page b, with the offsets of the attributes.
+func pageLinks(b []byte) (urls []string, offsets []int) {
+	// The skipped parts are blanked, so that the offsets are kept.
+	b = linkSkipRe.ReplaceAllFunc(b, func(m []byte) []byte {
+		return bytes.Map(func(r rune) rune {
+			if r == '\n' {
+				return r
+			}
+			return ' '
+		}, m)
+	})
+	for _, tag := range linkTagRe.FindAllIndex(b, -1) {
+		for _, m := range linkAttrRe.FindAllSubmatchIndex(b[tag[0]:tag[1]], -1) {
+			var value string
+			for i := 4; i < len(m); i += 2 {
+				if m[i] >= 0 {
+					value = string(b[tag[0]+m[i] : tag[0]+m[i+1]])
+				}
+			}
+			if strings.EqualFold(string(b[tag[0]+m[2]:tag[0]+m[3]]), "srcset") {
+				// The candidates are separated by commas, followed by
+				// their size.
+				for _, candidate := range strings.Split(value, ",") {
+					if fields := strings.Fields(candidate); len(fields) > 0 {
+						urls, offsets = append(urls, fields[0]), append(offsets, tag[0]+m[0])
+					}
+				}
+				continue
+			}
+			urls, offsets = append(urls, value), append(offsets, tag[0]+m[0])
+		}
+	}
+	return urls, offsets
+}
+
+// linkTarget returns the path relative to the dst tree root of the file
+// linked by rawURL from the page at rel, or false if it is not an internal
+// link.
+func (site *Site) linkTarget(rel, rawURL string) (string, bool) {
+	rawURL = strings.TrimSpace(rawURL)
+	if site.BaseURL != "" && strings.HasPrefix(rawURL, site.BaseURL+"/") {
+		rawURL = strings.TrimPrefix(rawURL, site.BaseURL)
+	} else if schemeRe.MatchString(rawURL) || strings.HasPrefix(rawURL, "//") {
+		return "", false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		// A link to the page itself (e.g. #top).
+		return "", false
+	}
+	p := u.Path
+	if strings.HasPrefix(p, "/") {
+		// The root of the site may be published under a path (e.g.
+		// https://example.com/blog).
+		if base, err := url.Parse(site.BaseURL); err == nil && base.Path != "" && base.Path != "/" {
+			p = strings.TrimPrefix(p, strings.TrimSuffix(base.Path, "/"))
+		}
+	} else {
+		p = path.Join("/", path.Dir(rel), p)
+	}
+	if strings.HasSuffix(u.Path, "/") {
+		p += "/"
+	}
+	return p, true
+}
+
+// linkExists reports whether the dst tree has a file at the link path p:
+// the file itself, or the index.html of the directory, or the .html file
+// of a clean URL.
+func (site *Site) linkExists(p string) bool {
+	dstPath := filepath.Join(site.DstRoot, filepath.FromSlash(p))
+	info, err := site.stat(dstPath)
+	if err == nil && !info.IsDir() {
+		return !strings.HasSuffix(p, "/")
+	}
+	if err == nil {
+		_, err = site.stat(filepath.Join(dstPath, "index.html"))
+		return err == nil
+	}
+	if path.Ext(p) == "" {
+		_, err = site.stat(dstPath + ".html")
+		return err == nil
+	}
+	return false
+}
+
+// CheckLinks returns the links of the HTML pages of the dst tree of the
+// site, and of their assets, which do not resolve to a file of the dst
+// tree. The links to other hosts are not checked.
+func (config *Config) CheckLinks(site *Site) ([]BrokenLink, error) {
+	var broken []BrokenLink
+	var ignore []string
+	if site.LinkCheck != nil {
+		ignore = site.LinkCheck.Ignore
+	}
+	err := site.walkDst(func(dstPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(dstPath) != ".html" {
+			return nil
+		}
+		b, err := site.readFile(dstPath)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(site.DstRoot, dstPath)
+		if err != nil {
+			return err
+		}
+		urls, offsets := pageLinks(b)
+		for i, rawURL := range urls {
+			p, ok := site.linkTarget(filepath.ToSlash(rel), rawURL)
+			if !ok || matchAny(ignore, p) || site.linkExists(p) {
+				continue
+			}
+			broken = append(broken, BrokenLink{Page: dstPath, Line: line(b, int64(offsets[i])), URL: rawURL})
+		}
+		return nil
+	})
+	return broken, err
+}
+
+// checkLinks checks the links of the site after a build, if it has a link
+// check. The broken links are reported as warnings, or returned if the
+// check is strict.
+func (config *Config) checkLinks(site *Site) error {
+	if site.LinkCheck == nil || config.DryRun {
+		return nil
+	}
+	broken, err := config.CheckLinks(site)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, l := range broken {
+		msg := "broken link " + l.URL
+		if site.LinkCheck.Strict {
+			errs = append(errs, fmt.Errorf("%s:%d: %s", l.Page, l.Line, msg))
+		} else {
+			config.warn(site, fmt.Sprintf("%s:%d", l.Page, l.Line), msg)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockFile is the name of the lock file written at the root of every dst
+// tree, locked while the site is built, cleaned or deployed, so that two
+// swb processes (e.g. a manual build and the one of a webhook) never
+// modify the same dst tree at once.
+const LockFile = ".swb-lock"
+
+// lockPoll is the interval at which a locked dst tree is checked again,
+// when waiting for it.
+const lockPoll = 100 * time.Millisecond
+
+// ErrLocked is the error of a site whose dst tree is locked by another
+// process, unless Config.Wait is set.
+var ErrLocked = errors.New("dst tree locked by another swb process")
+
+// lock locks the dst tree of the site, creating it if needed, or waits for
+// the other process holding its lock if config.Wait is set, until ctx is
+// done. It returns the function unlocking it. Dry runs do not lock, since
+// they do not modify the dst tree, nor do the builds to a Dst, since the
+// lock is a file of the directory at DstRoot.
+func (config *Config) lock(ctx context.Context, site *Site) (func(), error) {
+	if config.DryRun || site.Dst != nil {
+		return func() {}, nil
+	}
+	if _, err := os.Stat(site.DstRoot); errors.Is(err, os.ErrNotExist) {
+		config.action(site, ActionMkdir, site.DstRoot, 0)
+		if err := os.MkdirAll(site.DstRoot, site.dirMode()); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(filepath.Join(site.DstRoot, LockFile), os.O_RDWR|os.O_CREATE, site.newFileMode())
+	if err != nil {
+		return nil, err
+	}
+	for waiting := false; ; waiting = true {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		holder := ""
+		if b, err := os.ReadFile(f.Name()); err == nil && len(b) > 0 {
+			holder = " (pid " + strings.TrimSpace(string(b)) + ")"
+		}
+		if !config.Wait {
+			f.Close()
+			return nil, fmt.Errorf("%w%s, use -wait to wait for it", ErrLocked, holder)
+		}
+		if !waiting {
+			config.warn(site, site.DstRoot, "waiting for another swb process"+holder)
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+	// The pid of the holder tells the other processes who they wait for.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	// The lock file is left in place, since removing it would let another
+	// process lock a new file while one still waits for the removed one.
+	return func() { f.Close() }, nil
+}
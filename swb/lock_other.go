@@ -0,0 +1,10 @@
+//go:build !unix
+
+package swb
+
+import "os"
+
+// tryLock reports true, the dst trees are not locked on this platform.
+func tryLock(f *os.File) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,369 @@
+package swb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LevelQuiet = iota
+	LevelNormal
+	LevelVerbose
+	// LevelDebug also reports the files found up to date.
+	LevelDebug
+)
+
+// Actions performed on the dst trees.
+const (
+	ActionMkdir     = "mkdir"
+	ActionBuild     = "build"
+	ActionRebuild   = "rebuild"
+	ActionLink      = "link"
+	ActionRemove    = "remove"
+	ActionRmdir     = "rmdir"
+	ActionVerify    = "verify"
+	ActionUpload    = "upload"
+	ActionUnpublish = "unpublish"
+	ActionSkip      = "skip"
+	ActionWarn      = "warn"
+	ActionError     = "error"
+	ActionInfo      = "info"
+	ActionCommand   = "command"
+	ActionSummary   = "summary"
+	ActionTimings   = "timings"
+	ActionTotal     = "total"
+)
+
+// Stats counts the actions performed on a site.
+type Stats struct {
+	Built   int `json:"built"`
+	Linked  int `json:"linked"`
+	Removed int `json:"removed"`
+	Failed  int `json:"failed"`
+	// Errors of a failed site.
+	Errors []*BuildError `json:"errors,omitempty"`
+
+	start time.Time
+}
+
+// A Logger reports the actions performed on the dst trees, either as the
+// human readable " + path" lines, or as one JSON object per action.
+type Logger struct {
+	w     io.Writer
+	level int
+	json  bool
+
+	start time.Time
+	mu    sync.Mutex
+	stats map[string]*Stats
+	// Number of summaries of sites reported (see Total).
+	summaries int
+}
+
+type event struct {
+	Site       string   `json:"site,omitempty"`
+	Action     string   `json:"action"`
+	Path       string   `json:"path,omitempty"`
+	Command    []string `json:"command,omitempty"`
+	Page       string   `json:"page,omitempty"`
+	Block      string   `json:"block,omitempty"`
+	Stderr     string   `json:"stderr,omitempty"`
+	Message    string   `json:"message,omitempty"`
+	DurationMs *int64   `json:"duration_ms,omitempty"`
+	// Errors of an error event, the ones of a summary being its Stats'.
+	Errors  []*BuildError `json:"errors,omitempty"`
+	Timings *Timings      `json:"timings,omitempty"`
+	*Stats
+}
+
+func NewLogger(w io.Writer, level int, json bool) *Logger {
+	return &Logger{w: w, level: level, json: json, start: time.Now(), stats: make(map[string]*Stats)}
+}
+
+// Start starts counting the actions performed on the site.
+func (l *Logger) Start(site *Site) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats[site.Name] = &Stats{start: time.Now()}
+}
+
+func (l *Logger) siteStats(site *Site) *Stats {
+	stats, ok := l.stats[site.Name]
+	if !ok {
+		stats = &Stats{start: time.Now()}
+		l.stats[site.Name] = stats
+	}
+	return stats
+}
+
+// Action reports an action performed on path, d is the time it took if
+// relevant.
+func (l *Logger) Action(site *Site, action, path string, d time.Duration) {
+	if action == ActionSkip && l.level < LevelDebug {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.siteStats(site)
+	switch action {
+	case ActionBuild, ActionRebuild:
+		stats.Built++
+	case ActionLink:
+		stats.Linked++
+	case ActionRemove, ActionRmdir:
+		stats.Removed++
+	}
+	if l.json {
+		ev := event{Site: site.Name, Action: action, Path: path}
+		if d > 0 {
+			ms := d.Milliseconds()
+			ev.DurationMs = &ms
+		}
+		l.encode(ev)
+		return
+	}
+	if l.level < LevelNormal {
+		return
+	}
+	var line string
+	switch action {
+	case ActionMkdir:
+		line = " + " + path + "/"
+	case ActionBuild, ActionLink:
+		line = " + " + path
+	case ActionRebuild:
+		line = " ^ " + path
+	case ActionRemove:
+		line = " - " + path
+	case ActionRmdir:
+		line = " - " + path + "/*"
+	case ActionVerify:
+		line = " ok " + path
+	case ActionUpload:
+		line = " > " + path
+	case ActionUnpublish:
+		line = " < " + path
+	case ActionSkip:
+		line = " = " + path
+	default:
+		line = " " + action + " " + path
+	}
+	if l.level >= LevelVerbose && d > 0 {
+		line += fmt.Sprintf(" (%v)", d.Round(time.Millisecond))
+	}
+	fmt.Fprintln(l.w, line)
+}
+
+// Command reports a command run to build the site, with its standard
+// error and the page and the block it was run for, in verbose mode only.
+func (l *Logger) Command(site *Site, cmd Command) {
+	if l.level < LevelVerbose {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		ms := cmd.Duration.Milliseconds()
+		l.encode(event{Site: site.Name, Action: ActionCommand, Command: cmd.Argv, DurationMs: &ms, Page: cmd.Page, Block: cmd.Block, Stderr: cmd.Stderr})
+		return
+	}
+	fmt.Fprintf(l.w, "   $ %s (%v)\n", quoteArgv(cmd.Argv), cmd.Duration.Round(time.Millisecond))
+	stderr := strings.TrimRight(cmd.Stderr, "\n")
+	if stderr == "" {
+		return
+	}
+	var from []string
+	for _, s := range []string{cmd.Page, cmd.Block} {
+		if s != "" {
+			from = append(from, s)
+		}
+	}
+	if len(from) > 0 {
+		fmt.Fprintf(l.w, "     stderr (%s):\n", strings.Join(from, ", "))
+	} else {
+		fmt.Fprintln(l.w, "     stderr:")
+	}
+	for _, line := range strings.Split(stderr, "\n") {
+		fmt.Fprintf(l.w, "     | %s\n", line)
+	}
+}
+
+// quoteArgv returns the arguments of a command as they would be typed in a
+// shell.
+func quoteArgv(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Timings reports where the time of the build of the site went (see
+// NewTimings), at every level.
+func (l *Logger) Timings(site *Site, p Timings) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		l.encode(event{Site: site.Name, Action: ActionTimings, Timings: &p})
+		return
+	}
+	ms := func(ms int64) time.Duration { return time.Duration(ms) * time.Millisecond }
+	fmt.Fprintf(l.w, "%s: timings\n", site.Name)
+	for _, t := range p.Phases {
+		if t.DurationMs == 0 {
+			// The phases with nothing to do.
+			continue
+		}
+		fmt.Fprintf(l.w, "   %-12s %v\n", t.Phase, ms(t.DurationMs))
+	}
+	if len(p.Pages) > 0 {
+		fmt.Fprintln(l.w, "   slowest files:")
+		for _, page := range p.Pages {
+			fmt.Fprintf(l.w, "     %-8v %s\n", ms(page.DurationMs), page.Path)
+		}
+	}
+	if len(p.Commands) > 0 {
+		fmt.Fprintln(l.w, "   slowest commands:")
+		for _, cmd := range p.Commands {
+			var from []string
+			for _, s := range []string{cmd.Page, cmd.Block} {
+				if s != "" {
+					from = append(from, s)
+				}
+			}
+			line := quoteArgv(cmd.Command)
+			if len(from) > 0 {
+				line += " (" + strings.Join(from, ", ") + ")"
+			}
+			fmt.Fprintf(l.w, "     %-8v %s\n", ms(cmd.DurationMs), line)
+		}
+	}
+	fmt.Fprintf(l.w, "   %d commands run in %v\n", p.Processes, ms(p.CommandsMs))
+}
+
+// Fail counts a file of the site that failed to build.
+func (l *Logger) Fail(site *Site) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.siteStats(site).Failed++
+}
+
+// Warn reports a problem found on path that does not make it fail, at
+// every level.
+func (l *Logger) Warn(site *Site, path, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		l.encode(event{Site: site.Name, Action: ActionWarn, Path: path, Message: msg})
+		return
+	}
+	fmt.Fprintf(l.w, " ! %s: %s\n", path, msg)
+}
+
+// Error reports the error err, with the message msg (e.g. "site x
+// failed"), at every level. In JSON mode, it is an event listing the
+// BuildErrors of err, on the site if it is not nil.
+func (l *Logger) Error(site *Site, msg string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		ev := event{Action: ActionError, Message: msg, Errors: buildErrors(err)}
+		if site != nil {
+			ev.Site = site.Name
+		}
+		l.encode(ev)
+		return
+	}
+	if err != nil {
+		msg += ": " + FormatErrors(err)
+	}
+	fmt.Fprintln(l.w, msg)
+}
+
+// Info reports a message which is neither an action nor an error (e.g.
+// the address a site is served at), at every level.
+func (l *Logger) Info(site *Site, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		ev := event{Action: ActionInfo, Message: msg}
+		if site != nil {
+			ev.Site = site.Name
+		}
+		l.encode(ev)
+		return
+	}
+	fmt.Fprintln(l.w, msg)
+}
+
+// Summary reports the actions performed on the site since Start, and err,
+// the errors of the site, in JSON mode (they are logged otherwise). In
+// quiet mode, sites on which nothing happened are not reported, so that a
+// large number of up to date sites do not flood the output: Total then
+// reports them.
+func (l *Logger) Summary(site *Site, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.siteStats(site)
+	stats.Errors = buildErrors(err)
+	// A site can fail on none of its files (e.g. on its template).
+	stats.Failed = max(stats.Failed, len(stats.Errors))
+	if l.level == LevelQuiet && stats.Built+stats.Linked+stats.Removed+stats.Failed == 0 && err == nil {
+		return
+	}
+	l.summaries++
+	d := time.Since(stats.start)
+	if l.json {
+		ms := d.Milliseconds()
+		l.encode(event{Site: site.Name, Action: ActionSummary, DurationMs: &ms, Stats: stats})
+		return
+	}
+	fmt.Fprintf(l.w, "%s: %d built, %d linked, %d removed, %d failed in %v\n",
+		site.Name, stats.Built, stats.Linked, stats.Removed, stats.Failed, d.Round(time.Millisecond))
+}
+
+func (l *Logger) encode(ev event) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	l.w.Write(append(b, '\n'))
+}
+
+// Total reports the actions performed on all the sites, when more than one
+// site has been processed, or when the summary of none was reported, so
+// that the output always ends with one.
+func (l *Logger) Total() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.stats) == 0 || len(l.stats) == 1 && l.summaries > 0 {
+		return
+	}
+	var total Stats
+	for _, stats := range l.stats {
+		total.Built += stats.Built
+		total.Linked += stats.Linked
+		total.Removed += stats.Removed
+		total.Failed += stats.Failed
+	}
+	d := time.Since(l.start)
+	if l.json {
+		ms := d.Milliseconds()
+		l.encode(event{Action: ActionTotal, DurationMs: &ms, Stats: &total})
+		return
+	}
+	sites := "sites"
+	if len(l.stats) == 1 {
+		sites = "site"
+	}
+	fmt.Fprintf(l.w, "%d %s: %d built, %d linked, %d removed, %d failed in %v\n",
+		len(l.stats), sites, total.Built, total.Linked, total.Removed, total.Failed, d.Round(time.Millisecond))
+}
@@ -0,0 +1,24 @@
+package swb
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestLoggerError checks that the errors of a site are written by the
+// logger, like its other lines, and counted by its summary.
+func TestLoggerError(t *testing.T) {
+	var b strings.Builder
+	l := NewLogger(&b, LevelNormal, false)
+	site := &Site{Name: "blog"}
+	l.Start(site)
+	err := errors.New("template site.tpl: unterminated block")
+	l.Summary(site, err)
+	l.Error(site, "site blog failed", err)
+	want := regexp.MustCompile(`^blog: 0 built, 0 linked, 0 removed, 1 failed in \S+\nsite blog failed: template site.tpl: unterminated block\n$`)
+	if !want.MatchString(b.String()) {
+		t.Errorf("output %q, want it to match %s", b.String(), want)
+	}
+}
@@ -0,0 +1,189 @@
+package swb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Modes of detection of the changed sources: by their modification time
+// (the default), or by their hash.
+const (
+	RebuildMtime = "mtime"
+	RebuildHash  = "hash"
+)
+
+// validateRebuild checks the site's rebuild mode.
+func (site *Site) validateRebuild() error {
+	switch site.Rebuild {
+	case "", RebuildMtime, RebuildHash:
+		return nil
+	}
+	return fmt.Errorf("site %s: unknown rebuild mode %q", site.Name, site.Rebuild)
+}
+
+// ManifestFile is the name of the build manifest written at the root of
+// every dst tree after a successful build.
+const ManifestFile = ".swb-manifest.json"
+
+// A ManifestEntry records an output of the src tree, with the size,
+// modification time and hash of its source and of itself when it was
+// built (or placed).
+type ManifestEntry struct {
+	// Path of the source relative to the root of the src tree.
+	Src      string    `json:"src"`
+	SrcHash  string    `json:"srcHash"`
+	SrcSize  int64     `json:"srcSize"`
+	SrcMtime time.Time `json:"srcMtime"`
+	Hash     string    `json:"hash"`
+	Size     int64     `json:"size"`
+	Mtime    time.Time `json:"mtime"`
+}
+
+// A Manifest records the outputs of the src tree in the dst tree, by
+// dst-relative path. It tells which files of the dst tree are outputs
+// without comparing them to the src tree, and whether a source or an
+// output changed since the last build even if its modification time does
+// not tell (e.g. after a checkout or a restore).
+type Manifest map[string]ManifestEntry
+
+// readManifest reads the manifest of the last successful build of the
+// site. It is empty if there is none, or if it cannot be read.
+func (site *Site) readManifest() Manifest {
+	var m Manifest
+	b, err := site.readFile(filepath.Join(site.DstRoot, ManifestFile))
+	if err != nil || json.Unmarshal(b, &m) != nil {
+		return nil
+	}
+	return m
+}
+
+// writeManifest writes the manifest m of the site.
+func (site *Site) writeManifest(m Manifest) error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return site.writeFile(filepath.Join(site.DstRoot, ManifestFile), append(b, '\n'), site.newFileMode())
+}
+
+// unchanged reports whether info matches the recorded size and time.
+func unchanged(info fs.FileInfo, size int64, mtime time.Time) bool {
+	return info.Size() == size && info.ModTime().Equal(mtime)
+}
+
+// manifestEntry returns the manifest entry of the output at dstPath of the
+// file at srcPath. The hashes of the last manifest are reused for the files
+// which did not change.
+func (site *Site) manifestEntry(srcPath string, srcInfo fs.FileInfo, dstPath string) (ManifestEntry, error) {
+	dstInfo, err := site.stat(dstPath)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	e := ManifestEntry{
+		Src:      site.srcRel(srcPath),
+		SrcSize:  srcInfo.Size(),
+		SrcMtime: srcInfo.ModTime(),
+		Size:     dstInfo.Size(),
+		Mtime:    dstInfo.ModTime(),
+	}
+	old, ok := site.manifest[site.rel(dstPath)]
+	if ok && old.Src == e.Src && unchanged(srcInfo, old.SrcSize, old.SrcMtime) {
+		e.SrcHash = old.SrcHash
+	} else if e.SrcHash, err = site.fileHash(srcPath); err != nil {
+		return ManifestEntry{}, err
+	}
+	if ok && old.Src == e.Src && unchanged(dstInfo, old.Size, old.Mtime) {
+		e.Hash = old.Hash
+	} else if e.Hash, err = site.fileHash(dstPath); err != nil {
+		return ManifestEntry{}, err
+	}
+	return e, nil
+}
+
+// changed reports whether the file at srcPath or its output at dstPath
+// changed since they were recorded in the manifest, comparing their
+// hashes when their size or time changed. If they have not been recorded,
+// their times tell, unless the sources are compared by their hash.
+func (site *Site) changed(srcPath string, srcInfo fs.FileInfo, dstPath string, dstInfo fs.FileInfo) (bool, error) {
+	old, ok := site.manifest[site.rel(dstPath)]
+	if !ok || old.Src != site.srcRel(srcPath) {
+		return site.Rebuild == RebuildHash, nil
+	}
+	if !unchanged(srcInfo, old.SrcSize, old.SrcMtime) {
+		sum, err := site.fileHash(srcPath)
+		if err != nil || sum != old.SrcHash {
+			return true, err
+		}
+	}
+	if !unchanged(dstInfo, old.Size, old.Mtime) {
+		sum, err := site.fileHash(dstPath)
+		if err != nil || sum != old.Hash {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// recorded reports whether the file at dstPath in the dst tree is recorded
+// in the manifest as the output of a file which still exists in the src
+// tree, and is still mapped to it. It reports false, false if the file is
+// not recorded.
+func (site *Site) recorded(rules []*rule, dstPath string) (derived, ok bool, err error) {
+	e, ok := site.manifest[site.rel(dstPath)]
+	if !ok {
+		return false, false, nil
+	}
+	srcPath := filepath.Join(site.SrcRoot, filepath.FromSlash(e.Src))
+	srcInfo, err := site.srcStat(srcPath)
+	if err != nil || srcInfo.IsDir() || isDirFile(srcPath) {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return false, true, err
+	}
+	outPath, r := site.output(rules, srcPath)
+	if slices.Contains(r.outputs(outPath), dstPath) {
+		return !r.skipped(srcPath), true, nil
+	}
+	if r == nil || !r.page {
+		return false, true, nil
+	}
+	// A next page of a listing, or the stub page of an alias, as long as
+	// the front matter of the page tells so.
+	b, err := site.readFile(srcPath)
+	if err != nil {
+		return false, true, err
+	}
+	fm, _, _ := frontMatter(b)
+	if site.pageOf(outPath, dstPath) {
+		_, ok := listing(fm, "")
+		return ok && !r.skipped(srcPath), true, nil
+	}
+	return site.aliasOf(fm, site.rel(outPath), site.rel(dstPath)) && !r.skipped(srcPath), true, nil
+}
+
+// forget removes the outputs of the sources which no longer exist in the src
+// tree from outputs, mapping the dst paths of a build to their source, and
+// from its manifest m.
+func (site *Site) forget(outputs map[string]string, m Manifest) {
+	gone := func(srcPath string) bool {
+		_, err := site.srcStat(srcPath)
+		return errors.Is(err, os.ErrNotExist)
+	}
+	for dstPath, srcPath := range outputs {
+		if gone(srcPath) {
+			delete(outputs, dstPath)
+		}
+	}
+	for rel, e := range m {
+		if gone(filepath.Join(site.SrcRoot, filepath.FromSlash(e.Src))) {
+			delete(m, rel)
+		}
+	}
+}
@@ -0,0 +1,629 @@
+package swb
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BuilderInternal is the bin of the builders whose pages are Markdown
+// documents rendered by swb itself, without any external program.
+const BuilderInternal = "internal"
+
+var (
+	mdHeadingRe = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdRuleRe    = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	mdFenceRe   = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^` \t]*)")
+	mdQuoteRe   = regexp.MustCompile(`^ {0,3}> ?`)
+	mdBulletRe  = regexp.MustCompile(`^( {0,3})([-*+])( +|$)`)
+	mdOrderedRe = regexp.MustCompile(`^( {0,3})([0-9]{1,9})([.)])( +|$)`)
+	mdSetextRe  = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	mdRefRe     = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:[ \t]*<?([^\s>]+)>?(?:[ \t]+(?:"([^"]*)"|'([^']*)'|\(([^)]*)\)))?[ \t]*$`)
+	mdBlockRe   = regexp.MustCompile(`^ {0,3}(?:<!--|<(?i:/?(?:address|article|aside|blockquote|details|dialog|div|dl|fieldset|figcaption|figure|footer|form|h[1-6]|header|hr|iframe|main|nav|ol|p|pre|script|section|style|summary|table|ul))(?:[\s/>]|$))`)
+
+	mdAutolinkRe = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.-]{1,31}:[^\s<>]*)>`)
+	mdEmailRe    = regexp.MustCompile(`^<([^\s@<>]+@[^\s@<>]+)>`)
+	mdTagRe      = regexp.MustCompile(`^(?:<!--[\s\S]*?-->|</?[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][\w.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>)`)
+	mdEntityRe   = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	mdAnyTagRe   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// A mdRef is the destination of the reference links of a label.
+type mdRef struct {
+	url, title string
+}
+
+// markdown renders the Markdown document src to HTML, for the internal
+// builder. It handles the common subset of CommonMark: headings, paragraphs,
+// block quotes, lists, code blocks, rules, HTML blocks, and emphasis, code
+// spans, links (inline and by reference), images and autolinks.
+func markdown(src []byte) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	refs := make(map[string]mdRef)
+	lines = mdRefs(lines, refs)
+	var b strings.Builder
+	mdBlocks(&b, lines, refs, false)
+	return []byte(b.String())
+}
+
+// expandTabs replaces the tabs of the indentation of line by spaces, up to
+// the next multiple of 4.
+func expandTabs(line string) string {
+	var b strings.Builder
+	for i, r := range line {
+		switch r {
+		case ' ':
+			b.WriteByte(' ')
+		case '\t':
+			b.WriteString(strings.Repeat(" ", 4-b.Len()%4))
+		default:
+			return b.String() + line[i:]
+		}
+	}
+	return b.String()
+}
+
+// mdRefs returns lines without the definitions of the reference links,
+// which are added to refs.
+func mdRefs(lines []string, refs map[string]mdRef) []string {
+	var kept []string
+	var fence string
+	for _, line := range lines {
+		if m := mdFenceRe.FindStringSubmatch(line); m != nil && (fence == "" || strings.HasPrefix(m[2], fence)) {
+			if fence == "" {
+				fence = m[2]
+			} else {
+				fence = ""
+			}
+		} else if m := mdRefRe.FindStringSubmatch(line); m != nil && fence == "" {
+			label := mdLabel(m[1])
+			if _, ok := refs[label]; !ok {
+				refs[label] = mdRef{url: m[2], title: m[3] + m[4] + m[5]}
+			}
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// mdLabel normalizes the label of a reference link.
+func mdLabel(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// indent returns the number of leading spaces of line.
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func blank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// mdInterrupts reports whether line starts a block which ends a paragraph.
+func mdInterrupts(line string) bool {
+	if mdHeadingRe.MatchString(line) || mdRuleRe.MatchString(line) || mdFenceRe.MatchString(line) ||
+		mdQuoteRe.MatchString(line) || mdBlockRe.MatchString(line) {
+		return true
+	}
+	if m := mdBulletRe.FindStringSubmatch(line); m != nil {
+		return !blank(line[len(m[0]):])
+	}
+	// Only the ordered lists starting at 1 interrupt a paragraph.
+	m := mdOrderedRe.FindStringSubmatch(line)
+	return m != nil && m[2] == "1" && !blank(line[len(m[0]):])
+}
+
+// mdBlocks renders the blocks of lines to b. The paragraphs of tight lists
+// are rendered without their <p> element.
+func mdBlocks(b *strings.Builder, lines []string, refs map[string]mdRef, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case blank(line):
+			i++
+		case indent(line) >= 4:
+			var code []string
+			for ; i < len(lines) && (blank(lines[i]) || indent(lines[i]) >= 4); i++ {
+				code = append(code, strings.TrimPrefix(lines[i], "    "))
+			}
+			for len(code) > 0 && blank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+			}
+			fmt.Fprintf(b, "<pre><code>%s\n</code></pre>\n", html.EscapeString(strings.Join(code, "\n")))
+		case mdFenceRe.MatchString(line):
+			m := mdFenceRe.FindStringSubmatch(line)
+			var code []string
+			for i++; i < len(lines); i++ {
+				if c := strings.TrimSpace(lines[i]); strings.HasPrefix(c, m[2]) && strings.Trim(c, m[2][:1]) == "" && indent(lines[i]) < 4 {
+					i++
+					break
+				}
+				// The indentation of the fence is removed from the code.
+				code = append(code, lines[i][min(indent(lines[i]), len(m[1])):])
+			}
+			class := ""
+			if m[3] != "" {
+				class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(mdUnescape(m[3])))
+			}
+			text := strings.Join(code, "\n")
+			if len(code) > 0 {
+				text += "\n"
+			}
+			fmt.Fprintf(b, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(text))
+		case mdHeadingRe.MatchString(line):
+			m := mdHeadingRe.FindStringSubmatch(line)
+			fmt.Fprintf(b, "<h%d>%s</h%d>\n", len(m[1]), mdInline(m[2], refs), len(m[1]))
+			i++
+		case mdRuleRe.MatchString(line):
+			b.WriteString("<hr />\n")
+			i++
+		case mdQuoteRe.MatchString(line):
+			var quote []string
+			for ; i < len(lines); i++ {
+				if loc := mdQuoteRe.FindStringIndex(lines[i]); loc != nil {
+					quote = append(quote, lines[i][loc[1]:])
+				} else if len(quote) > 0 && !blank(lines[i]) && !blank(quote[len(quote)-1]) && !mdInterrupts(lines[i]) {
+					// A lazy continuation of the paragraph.
+					quote = append(quote, lines[i])
+				} else {
+					break
+				}
+			}
+			b.WriteString("<blockquote>\n")
+			mdBlocks(b, quote, refs, false)
+			b.WriteString("</blockquote>\n")
+		case mdBulletRe.MatchString(line) || mdOrderedRe.MatchString(line):
+			i = mdList(b, lines, i, refs)
+		case mdBlockRe.MatchString(line):
+			for ; i < len(lines) && !blank(lines[i]); i++ {
+				b.WriteString(lines[i])
+				b.WriteByte('\n')
+			}
+		default:
+			para := []string{strings.TrimLeft(line, " ")}
+			level := 0
+			for i++; i < len(lines) && !blank(lines[i]); i++ {
+				if m := mdSetextRe.FindStringSubmatch(lines[i]); m != nil {
+					level = 1
+					if m[1][0] == '-' {
+						level = 2
+					}
+					i++
+					break
+				}
+				if mdInterrupts(lines[i]) {
+					break
+				}
+				para = append(para, strings.TrimLeft(lines[i], " "))
+			}
+			text := mdInline(strings.TrimRight(strings.Join(para, "\n"), " "), refs)
+			switch {
+			case level > 0:
+				fmt.Fprintf(b, "<h%d>%s</h%d>\n", level, text, level)
+			case tight:
+				b.WriteString(text + "\n")
+			default:
+				fmt.Fprintf(b, "<p>%s</p>\n", text)
+			}
+		}
+	}
+}
+
+// mdItem returns the marker of the list item starting line, its kind
+// (the bullet, or the delimiter of the ordered lists) and the width of its
+// indentation, or ok false if line does not start an item.
+func mdItem(line string) (marker, kind string, width int, ok bool) {
+	var spaces string
+	if m := mdBulletRe.FindStringSubmatch(line); m != nil {
+		marker, kind, spaces = m[2], m[2], m[3]
+	} else if m := mdOrderedRe.FindStringSubmatch(line); m != nil {
+		marker, kind, spaces = m[2], m[3], m[4]
+	} else {
+		return "", "", 0, false
+	}
+	width = indent(line) + len(marker) + len(spaces)
+	if kind != marker {
+		width++
+	}
+	if len(spaces) == 0 || len(spaces) > 4 || blank(line[width:]) {
+		// The content of the item is indented by a single space.
+		width -= len(spaces) - 1
+	}
+	return marker, kind, width, true
+}
+
+// mdList renders the list starting at lines[i] to b, and returns the index
+// of the line following it.
+func mdList(b *strings.Builder, lines []string, i int, refs map[string]mdRef) int {
+	marker, kind, _, _ := mdItem(lines[i])
+	ordered := kind == "." || kind == ")"
+	var items [][]string
+	loose := false
+	for i < len(lines) {
+		_, k, width, ok := mdItem(lines[i])
+		if !ok || k != kind {
+			break
+		}
+		// A list is loose if a blank line separates its items.
+		if len(items) > 0 && blank(lines[i-1]) {
+			loose = true
+		}
+		item := []string{""}
+		if len(lines[i]) > width {
+			item[0] = lines[i][width:]
+		}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			switch {
+			case blank(line):
+				item = append(item, "")
+				continue
+			case indent(line) >= width:
+				item = append(item, line[width:])
+				continue
+			case !blank(item[len(item)-1]) && !mdInterrupts(line) && !mdItemStart(line):
+				// A lazy continuation of the paragraph.
+				item = append(item, line)
+				continue
+			}
+			break
+		}
+		// The blank lines ending the item belong to the list.
+		for len(item) > 1 && blank(item[len(item)-1]) {
+			item = item[:len(item)-1]
+		}
+		// So does a blank line between the blocks of an item.
+		for j := 1; j < len(item); j++ {
+			if blank(item[j-1]) && !blank(item[j]) {
+				loose = true
+			}
+		}
+		items = append(items, item)
+		for i < len(lines) && blank(lines[i]) {
+			i++
+		}
+	}
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	if start, _ := strconv.Atoi(marker); ordered && start != 1 {
+		fmt.Fprintf(b, "<ol start=\"%d\">\n", start)
+	} else {
+		fmt.Fprintf(b, "<%s>\n", tag)
+	}
+	for _, item := range items {
+		var content strings.Builder
+		mdBlocks(&content, item, refs, !loose)
+		text := content.String()
+		if !loose {
+			text = strings.TrimSuffix(text, "\n")
+		} else if text != "" {
+			text = "\n" + text
+		}
+		fmt.Fprintf(b, "<li>%s</li>\n", text)
+	}
+	fmt.Fprintf(b, "</%s>\n", tag)
+	return i
+}
+
+// mdItemStart reports whether line starts a list item.
+func mdItemStart(line string) bool {
+	_, _, _, ok := mdItem(line)
+	return ok
+}
+
+// mdUnescape removes the backslashes escaping the punctuation of s.
+func mdUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// mdInline renders the inline content s to HTML.
+func mdInline(s string, refs map[string]mdRef) string {
+	var out []byte
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			out = append(out, "<br />\n"...)
+			i += 2
+			continue
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			out = append(out, html.EscapeString(s[i+1:i+2])...)
+			i += 2
+			continue
+		case c == '`':
+			n := runLen(s, i)
+			if end := closingCode(s, i+n, n); end >= 0 {
+				code := strings.ReplaceAll(s[i+n:end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				out = append(out, "<code>"+html.EscapeString(code)+"</code>"...)
+				i = end + n
+			} else {
+				out = append(out, s[i:i+n]...)
+				i += n
+			}
+			continue
+		case c == '<':
+			if m := mdAutolinkRe.FindStringSubmatch(s[i:]); m != nil {
+				out = append(out, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(m[1]), html.EscapeString(m[1]))...)
+				i += len(m[0])
+				continue
+			}
+			if m := mdEmailRe.FindStringSubmatch(s[i:]); m != nil {
+				out = append(out, fmt.Sprintf(`<a href="mailto:%s">%s</a>`, html.EscapeString(m[1]), html.EscapeString(m[1]))...)
+				i += len(m[0])
+				continue
+			}
+			if tag := mdTagRe.FindString(s[i:]); tag != "" {
+				out = append(out, tag...)
+				i += len(tag)
+				continue
+			}
+		case c == '&':
+			if ent := mdEntityRe.FindString(s[i:]); ent != "" {
+				out = append(out, ent...)
+				i += len(ent)
+				continue
+			}
+		case c == '[' || c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if link, n := mdLink(s[i:], refs); n > 0 {
+				out = append(out, link...)
+				i += n
+				continue
+			}
+		case c == '*' || c == '_':
+			if em, n := mdEmphasis(s, i, refs); n > 0 {
+				out = append(out, em...)
+				i += n
+				continue
+			}
+			// The whole run is literal.
+			n := runLen(s, i)
+			out = append(out, s[i:i+n]...)
+			i += n
+			continue
+		case c == '\n':
+			if trimmed := strings.TrimRight(string(out), " "); len(out)-len(trimmed) >= 2 {
+				out = append([]byte(trimmed), "<br />"...)
+			} else {
+				out = []byte(trimmed)
+			}
+		}
+		out = append(out, html.EscapeString(s[i:i+1])...)
+		i++
+	}
+	return string(out)
+}
+
+// runLen returns the length of the run of the character s[i] starting at i.
+func runLen(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// closingCode returns the index of the run of n backticks closing the code
+// span whose content starts at i, or -1 if there is none.
+func closingCode(s string, i, n int) int {
+	for i < len(s) {
+		j := strings.IndexByte(s[i:], '`')
+		if j < 0 {
+			return -1
+		}
+		i += j
+		m := runLen(s, i)
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
+
+// mdEmphasis renders the emphasis opened by the delimiter run at s[i], and
+// returns its length in s, or 0 if it is not closed.
+func mdEmphasis(s string, i int, refs map[string]mdRef) (string, int) {
+	c := s[i]
+	n := runLen(s, i)
+	if i+n >= len(s) || isSpace(s[i+n]) || c == '_' && i > 0 && isAlnum(s[i-1]) {
+		return "", 0
+	}
+	strong := n >= 2
+	width := 1
+	if strong {
+		width = 2
+	}
+	for j := i + width; j < len(s); {
+		switch s[j] {
+		case '\\':
+			j += 2
+			continue
+		case '`':
+			m := runLen(s, j)
+			if end := closingCode(s, j+m, m); end >= 0 {
+				j = end + m
+			} else {
+				j += m
+			}
+			continue
+		case c:
+			m := runLen(s, j)
+			closes := !isSpace(s[j-1]) && (c != '_' || j+m >= len(s) || !isAlnum(s[j+m]))
+			if closes && (strong && m >= 2 || !strong && m != 2) && j > i+width {
+				// The closer is the end of its run.
+				end := j + m - width
+				inner := mdInline(s[i+width:end], refs)
+				if strong {
+					return "<strong>" + inner + "</strong>", end + width - i
+				}
+				return "<em>" + inner + "</em>", end + width - i
+			}
+			j += m
+			continue
+		}
+		j++
+	}
+	if strong {
+		// Fall back to an emphasis opened by the last delimiter of the run.
+		if em, m := mdEmphasis(s, i+n-1, refs); m > 0 {
+			return s[i:i+n-1] + em, n - 1 + m
+		}
+	}
+	return "", 0
+}
+
+// mdLink renders the link or image starting s, and returns its length in
+// s, or 0 if s does not start a link.
+func mdLink(s string, refs map[string]mdRef) (string, int) {
+	image := s[0] == '!'
+	start := 1
+	if image {
+		start = 2
+	}
+	// The text ends at the matching bracket.
+	end, depth := -1, 0
+	for j := start; j < len(s) && end < 0; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			m := runLen(s, j)
+			if e := closingCode(s, j+m, m); e >= 0 {
+				j = e + m - 1
+			} else {
+				j += m - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				end = j
+			}
+			depth--
+		}
+	}
+	if end < 0 {
+		return "", 0
+	}
+	text := s[start:end]
+	var ref mdRef
+	n := end + 1
+	if rest := s[n:]; strings.HasPrefix(rest, "(") {
+		url, title, m, ok := mdDestination(rest)
+		if !ok {
+			return "", 0
+		}
+		ref, n = mdRef{url, title}, n+m
+	} else {
+		label := text
+		if strings.HasPrefix(rest, "[") {
+			if j := strings.IndexByte(rest, ']'); j > 0 {
+				label, n = rest[1:j], n+j+1
+			} else if j == 1 {
+				n += 2
+			}
+		}
+		var ok bool
+		if ref, ok = refs[mdLabel(label)]; !ok {
+			return "", 0
+		}
+	}
+	title := ""
+	if ref.title != "" {
+		title = fmt.Sprintf(` title="%s"`, html.EscapeString(mdUnescape(ref.title)))
+	}
+	href := html.EscapeString(mdUnescape(ref.url))
+	if image {
+		alt := html.EscapeString(mdText(mdInline(text, refs)))
+		return fmt.Sprintf(`<img src="%s" alt="%s"%s />`, href, alt, title), n
+	}
+	return fmt.Sprintf(`<a href="%s"%s>%s</a>`, href, title, mdInline(text, refs)), n
+}
+
+// mdDestination parses the destination and title of an inline link, in
+// parentheses at the start of s, and returns their length in s.
+func mdDestination(s string) (url, title string, n int, ok bool) {
+	i := 1
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	if i < len(s) && s[i] == '<' {
+		j := strings.IndexAny(s[i:], ">\n")
+		if j < 0 || s[i+j] != '>' {
+			return "", "", 0, false
+		}
+		url, i = s[i+1:i+j], i+j+1
+	} else {
+		start, depth := i, 0
+		for ; i < len(s) && !isSpace(s[i]); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '(' {
+				depth++
+			} else if s[i] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+		url = s[start:min(i, len(s))]
+	}
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	if i < len(s) && strings.IndexByte(`"'(`, s[i]) >= 0 {
+		closer := s[i]
+		if closer == '(' {
+			closer = ')'
+		}
+		j := strings.IndexByte(s[i+1:], closer)
+		if j < 0 {
+			return "", "", 0, false
+		}
+		title, i = s[i+1:i+1+j], i+j+2
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+	}
+	if i >= len(s) || s[i] != ')' {
+		return "", "", 0, false
+	}
+	return url, title, i + 1, true
+}
+
+// mdText returns the text of the HTML s, without its tags.
+func mdText(s string) string {
+	return html.UnescapeString(mdAnyTagRe.ReplaceAllString(s, ""))
+}
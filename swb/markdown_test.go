@@ -0,0 +1,52 @@
+package swb
+
+import "testing"
+
+// TestMarkdown checks the HTML rendered by the internal builder.
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name, md, html string
+	}{
+		// Emphasis.
+		{"emphasis", "*em* and **strong** and ***both***", "<p><em>em</em> and <strong>strong</strong> and <strong><em>both</em></strong></p>\n"},
+		{"intraword underscores", "snake_case_word and _em_", "<p>snake_case_word and <em>em</em></p>\n"},
+		{"spaced stars", "a * b * c", "<p>a * b * c</p>\n"},
+		{"escaped stars", `\*not em\*`, "<p>*not em*</p>\n"},
+
+		// Lists.
+		{"tight list", "- one\n- two\n", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"loose list", "- one\n\n- two\n", "<ul>\n<li>\n<p>one</p>\n</li>\n<li>\n<p>two</p>\n</li>\n</ul>\n"},
+		{"ordered list", "1. one\n2. two\n", "<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{"ordered list start", "3) three\n", "<ol start=\"3\">\n<li>three</li>\n</ol>\n"},
+		{"nested list", "- a\n  - nested\n- b\n", "<ul>\n<li>a\n<ul>\n<li>nested</li>\n</ul></li>\n<li>b</li>\n</ul>\n"},
+
+		// Code.
+		{"fence", "```go\nfmt.Println(\"<hi>\")\n```\n", "<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)\n</code></pre>\n"},
+		{"tilde fence", "~~~\n*not em*\n~~~\n", "<pre><code>*not em*\n</code></pre>\n"},
+		{"indented code", "    indented <code>\n", "<pre><code>indented &lt;code&gt;\n</code></pre>\n"},
+		{"code spans", "`a < b` and ``x ` y``", "<p><code>a &lt; b</code> and <code>x ` y</code></p>\n"},
+
+		// Links.
+		{"inline link", `[swb](https://example.com/ "Home")`, "<p><a href=\"https://example.com/\" title=\"Home\">swb</a></p>\n"},
+		{"reference link", "[ref][1]\n\n[1]: /about", "<p><a href=\"/about\">ref</a></p>\n"},
+		{"image", "![alt *text*](/a.png)", "<p><img src=\"/a.png\" alt=\"alt text\" /></p>\n"},
+		{"autolink", "<https://example.com/?a=1&b=2>", "<p><a href=\"https://example.com/?a=1&amp;b=2\">https://example.com/?a=1&amp;b=2</a></p>\n"},
+		{"link query", "[x](/a?b=1&c=2)", "<p><a href=\"/a?b=1&amp;c=2\">x</a></p>\n"},
+
+		// Escaping.
+		{"special characters", `5 < 6 & "q"`, "<p>5 &lt; 6 &amp; &#34;q&#34;</p>\n"},
+		{"entities", "&amp; &copy; &#35;", "<p>&amp; &copy; &#35;</p>\n"},
+		{"html block", "<div>\n*raw*\n</div>\n", "<div>\n*raw*\n</div>\n"},
+
+		// Blocks.
+		{"quote", "> quote\n> more\n", "<blockquote>\n<p>quote\nmore</p>\n</blockquote>\n"},
+		{"headings", "# Title #\n\nSetext\n===\n", "<h1>Title</h1>\n<h1>Setext</h1>\n"},
+		{"hard break", "line  \nbreak", "<p>line<br />\nbreak</p>\n"},
+		{"rule", "---\n", "<hr />\n"},
+	}
+	for _, tt := range tests {
+		if got := string(markdown([]byte(tt.md))); got != tt.html {
+			t.Errorf("%s: %q renders to %q, want %q", tt.name, tt.md, got, tt.html)
+		}
+	}
+}
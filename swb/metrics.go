@@ -0,0 +1,191 @@
+package swb
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsPath is the path at which Daemon serves its Metrics.
+const metricsPath = "/metrics"
+
+// stopwatch returns a function adding the time elapsed since its last call
+// (or since stopwatch was called) to the time of a phase in the report of
+// the site (see Report.Phases).
+func (site *Site) stopwatch() func(phase string) {
+	last := time.Now()
+	return func(phase string) {
+		now := time.Now()
+		if site.report != nil {
+			if site.report.Phases == nil {
+				site.report.Phases = make(map[string]time.Duration)
+			}
+			site.report.Phases[phase] += now.Sub(last)
+		}
+		last = now
+	}
+}
+
+// Timings tell where the time of the build of a site went, to find out why
+// it takes long.
+type Timings struct {
+	// Phases are the times of the phases, the longest first.
+	Phases []PhaseTime `json:"phases"`
+	// Pages are the files of the dst tree which took the longest to build,
+	// and Commands the longest commands, the longest first.
+	Pages    []PageReport `json:"pages"`
+	Commands []CommandRun `json:"commands"`
+	// Processes is the number of commands run, which took CommandsMs.
+	Processes  int   `json:"processes"`
+	CommandsMs int64 `json:"commands_ms"`
+}
+
+// A PhaseTime is the time a phase of a build took.
+type PhaseTime struct {
+	Phase      string `json:"phase"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// NewTimings returns the timings of the build reported by report, with its
+// n slowest pages and commands.
+func NewTimings(report Report, n int) Timings {
+	p := Timings{Processes: len(report.Commands)}
+	p.Phases = phaseTimes(report.Phases)
+	for path, d := range report.Durations {
+		p.Pages = append(p.Pages, PageReport{Path: path, DurationMs: d.Milliseconds()})
+	}
+	slices.SortFunc(p.Pages, func(a, b PageReport) int {
+		return cmp.Or(cmp.Compare(b.DurationMs, a.DurationMs), cmp.Compare(a.Path, b.Path))
+	})
+	p.Pages = p.Pages[:min(n, len(p.Pages))]
+	cmds := slices.Clone(report.Commands)
+	slices.SortStableFunc(cmds, func(a, b Command) int { return cmp.Compare(b.Duration, a.Duration) })
+	var total time.Duration
+	for i, cmd := range cmds {
+		total += cmd.Duration
+		if i < n {
+			p.Commands = append(p.Commands, CommandRun{Command: cmd.Argv, DurationMs: cmd.Duration.Milliseconds(), Page: cmd.Page, Block: cmd.Block})
+		}
+	}
+	p.CommandsMs = total.Milliseconds()
+	p.Pages, p.Commands = nonNil(p.Pages), nonNil(p.Commands)
+	return p
+}
+
+// phaseTimes returns the times of the phases, the longest first.
+func phaseTimes(phases map[string]time.Duration) []PhaseTime {
+	times := make([]PhaseTime, 0, len(phases))
+	for _, phase := range slices.Sorted(maps.Keys(phases)) {
+		times = append(times, PhaseTime{Phase: phase, DurationMs: phases[phase].Milliseconds()})
+	}
+	slices.SortStableFunc(times, func(a, b PhaseTime) int { return cmp.Compare(b.DurationMs, a.DurationMs) })
+	return times
+}
+
+// Metrics count the builds of the sites, and the time they took, to be
+// scraped by Prometheus (see ServeHTTP).
+type Metrics struct {
+	mu    sync.Mutex
+	sites map[string]*siteMetrics
+}
+
+type siteMetrics struct {
+	builds, failures       int
+	duration, lastDuration time.Duration
+	last                   time.Time
+	lastFailed             bool
+	built, linked, removed int
+	commands               int
+	commandsDuration       time.Duration
+	phases                 map[string]time.Duration
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{sites: make(map[string]*siteMetrics)}
+}
+
+// Add counts the build of a site.
+func (m *Metrics) Add(res SiteResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sites[res.Site.Name]
+	if !ok {
+		s = &siteMetrics{phases: make(map[string]time.Duration)}
+		m.sites[res.Site.Name] = s
+	}
+	s.builds++
+	s.duration += res.Duration
+	s.last = time.Now()
+	s.lastDuration = res.Duration
+	s.lastFailed = res.Err != nil
+	if s.lastFailed {
+		s.failures++
+	}
+	s.built += len(res.Report.Built)
+	s.linked += len(res.Report.Linked)
+	s.removed += len(res.Report.Removed)
+	s.commands += len(res.Report.Commands)
+	for _, cmd := range res.Report.Commands {
+		s.commandsDuration += cmd.Duration
+	}
+	for phase, d := range res.Report.Phases {
+		s.phases[phase] += d
+	}
+}
+
+// ServeHTTP writes the metrics in the text exposition format of
+// Prometheus.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	names := slices.Sorted(maps.Keys(m.sites))
+	metric := func(name, typ, help string, value func(s *siteMetrics) float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, site := range names {
+			fmt.Fprintf(&b, "%s{site=%q} %g\n", name, site, value(m.sites[site]))
+		}
+	}
+	metric("swb_builds_total", "counter", "Number of builds of the site.",
+		func(s *siteMetrics) float64 { return float64(s.builds) })
+	metric("swb_build_failures_total", "counter", "Number of failed builds of the site.",
+		func(s *siteMetrics) float64 { return float64(s.failures) })
+	metric("swb_build_duration_seconds_total", "counter", "Time spent building the site.",
+		func(s *siteMetrics) float64 { return s.duration.Seconds() })
+	metric("swb_last_build_duration_seconds", "gauge", "Time the last build of the site took.",
+		func(s *siteMetrics) float64 { return s.lastDuration.Seconds() })
+	metric("swb_last_build_timestamp_seconds", "gauge", "Time the last build of the site ended at.",
+		func(s *siteMetrics) float64 { return float64(s.last.UnixMilli()) / 1000 })
+	metric("swb_last_build_success", "gauge", "Whether the last build of the site succeeded.",
+		func(s *siteMetrics) float64 {
+			if s.lastFailed {
+				return 0
+			}
+			return 1
+		})
+	metric("swb_commands_total", "counter", "Number of commands run to build the site.",
+		func(s *siteMetrics) float64 { return float64(s.commands) })
+	metric("swb_command_duration_seconds_total", "counter", "Time spent running the commands of the site.",
+		func(s *siteMetrics) float64 { return s.commandsDuration.Seconds() })
+	fmt.Fprintf(&b, "# HELP swb_files_total Number of files of the dst tree of the site built, linked or removed.\n# TYPE swb_files_total counter\n")
+	for _, site := range names {
+		s := m.sites[site]
+		fmt.Fprintf(&b, "swb_files_total{site=%q,action=\"built\"} %d\n", site, s.built)
+		fmt.Fprintf(&b, "swb_files_total{site=%q,action=\"linked\"} %d\n", site, s.linked)
+		fmt.Fprintf(&b, "swb_files_total{site=%q,action=\"removed\"} %d\n", site, s.removed)
+	}
+	fmt.Fprintf(&b, "# HELP swb_phase_duration_seconds_total Time spent in the phases of the builds of the site.\n# TYPE swb_phase_duration_seconds_total counter\n")
+	for _, site := range names {
+		s := m.sites[site]
+		for _, phase := range slices.Sorted(maps.Keys(s.phases)) {
+			fmt.Fprintf(&b, "swb_phase_duration_seconds_total{site=%q,phase=%q} %g\n", site, phase, s.phases[phase].Seconds())
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
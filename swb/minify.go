@@ -0,0 +1,204 @@
+package swb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// minifiers are the minifiers of the assets, by extension.
+var minifiers = map[string]func([]byte) []byte{
+	".css": minifyCSS,
+	".js":  minifyJS,
+}
+
+// validateMinify checks the extensions of the site's minified assets.
+func (site *Site) validateMinify() error {
+	for _, ext := range site.Minify {
+		if _, ok := minifiers[ext]; !ok {
+			return fmt.Errorf("site %s: minify: cannot minify %s files", site.Name, ext)
+		}
+	}
+	return nil
+}
+
+// minifyRules returns the rules minifying the assets of the site which
+// would otherwise be linked.
+func (site *Site) minifyRules(rules []*rule) []*rule {
+	var minified []*rule
+	for _, ext := range site.Minify {
+		if findRule(rules, ext) != nil {
+			continue
+		}
+		minify := minifiers[ext]
+		minified = append(minified, &rule{
+			ext:    ext,
+			outExt: ext,
+			asset:  true,
+			build: func(ctx context.Context, srcPath, dstPath string) error {
+				b, err := site.readFile(srcPath)
+				if err != nil {
+					return err
+				}
+				return site.writeFile(dstPath, minify(b), 0644)
+			},
+		})
+	}
+	return minified
+}
+
+// skipQuoted copies the string literal starting b[i] to out, and returns
+// the index following it. A string ends at the first unescaped quote, or
+// at the end of its line unless it is a template literal.
+func skipQuoted(out *bytes.Buffer, b []byte, i int) int {
+	q := b[i]
+	j := i + 1
+	for ; j < len(b); j++ {
+		if b[j] == '\\' {
+			j++
+		} else if b[j] == q || b[j] == '\n' && q != '`' {
+			j++
+			break
+		}
+	}
+	j = min(j, len(b))
+	out.Write(b[i:j])
+	return j
+}
+
+// skipComment returns the index following the block comment starting
+// b[i], which is kept in out if it is a license (/*! ... */).
+func skipComment(out *bytes.Buffer, b []byte, i int) int {
+	end := bytes.Index(b[i+2:], []byte("*/"))
+	j := len(b)
+	if end >= 0 {
+		j = i + 2 + end + 2
+	}
+	if bytes.HasPrefix(b[i:], []byte("/*!")) {
+		out.Write(b[i:j])
+	}
+	return j
+}
+
+// minifyCSS removes the comments and the superfluous blanks and
+// semicolons of a style sheet.
+func minifyCSS(b []byte) []byte {
+	var out bytes.Buffer
+	space := false
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '/' && i+1 < len(b) && b[i+1] == '*':
+			i = skipComment(&out, b, i)
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			i++
+			continue
+		}
+		last := byte(0)
+		if out.Len() > 0 {
+			last = out.Bytes()[out.Len()-1]
+		}
+		if c == '}' && last == ';' {
+			out.Truncate(out.Len() - 1)
+			last = 0
+		}
+		// The blanks around the punctuation are not needed, but the ones
+		// before a colon are (e.g. in a "div :hover" selector).
+		if space && last != 0 && !strings.ContainsRune("{};,>:(", rune(last)) && !strings.ContainsRune("{};,>)", rune(c)) {
+			out.WriteByte(' ')
+		}
+		space = false
+		if c == '"' || c == '\'' {
+			i = skipQuoted(&out, b, i)
+			continue
+		}
+		out.WriteByte(c)
+		i++
+	}
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// minifyJS removes the comments, the indentation, the blank lines and the
+// repeated blanks of a script. The line breaks are kept, since they may
+// end statements.
+func minifyJS(b []byte) []byte {
+	var out bytes.Buffer
+	// The last significant character, which tells whether a slash is a
+	// division or starts a regular expression.
+	last := byte('\n')
+	space := false
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '/' && i+1 < len(b) && b[i+1] == '/':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && i+1 < len(b) && b[i+1] == '*':
+			i = skipComment(&out, b, i)
+			continue
+		case c == '\n' || c == '\r':
+			if last != '\n' {
+				out.WriteByte('\n')
+				last = '\n'
+			}
+			space = false
+			i++
+			continue
+		case c == ' ' || c == '\t':
+			space = true
+			i++
+			continue
+		}
+		if space && last != '\n' {
+			out.WriteByte(' ')
+		}
+		space = false
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			i = skipQuoted(&out, b, i)
+		case c == '/' && (strings.IndexByte("(,=:[!&|?{};+-*%<>~^\n", last) >= 0 || endsWithKeyword(out.Bytes())):
+			// A regular expression, whose end is the first slash out of
+			// a character class.
+			j, class := i+1, false
+			for ; j < len(b) && b[j] != '\n'; j++ {
+				if b[j] == '\\' {
+					j++
+				} else if b[j] == '[' {
+					class = true
+				} else if b[j] == ']' {
+					class = false
+				} else if b[j] == '/' && !class {
+					j++
+					break
+				}
+			}
+			j = min(j, len(b))
+			out.Write(b[i:j])
+			i = j
+		default:
+			out.WriteByte(c)
+			i++
+		}
+		last = out.Bytes()[out.Len()-1]
+	}
+	return out.Bytes()
+}
+
+// endsWithKeyword reports whether b ends with a keyword which can be
+// followed by a regular expression.
+func endsWithKeyword(b []byte) bool {
+	for _, kw := range []string{"return", "typeof", "case", "do", "else", "in", "of", "void", "yield"} {
+		if bytes.HasSuffix(b, []byte(kw)) && (len(b) == len(kw) || !isIdent(b[len(b)-len(kw)-1])) {
+			return true
+		}
+	}
+	return false
+}
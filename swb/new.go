@@ -0,0 +1,98 @@
+package swb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pageTitle returns the title of a page from its name, without its date
+// prefix and with spaces instead of dashes and underscores (e.g.
+// 2024-03-01-hello-world is "Hello world").
+func pageTitle(name string) string {
+	if m := datedRe.FindStringSubmatch(name); m != nil {
+		name = m[4]
+	}
+	title := strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || unicode.IsSpace(r)
+	}), " ")
+	r, n := utf8.DecodeRuneInString(title)
+	return string(unicode.ToUpper(r)) + title[n:]
+}
+
+// NewPage creates the source of a new page of the site, at the path rel
+// relative to its src tree (with the extension of the builder if it has
+// none), and returns its path. The page is rendered from the site's
+// archetype, like a template whose commands get the title of the page,
+// made from its name, and the date of now. Without an archetype, the page
+// only holds a front matter with its title and date.
+func (config *Config) NewPage(ctx context.Context, site *Site, rel string, now time.Time) (string, error) {
+	rel = path.Clean(filepath.ToSlash(rel))
+	if path.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is not in the src tree", rel)
+	}
+	if path.Ext(rel) == "" {
+		rel += config.Builder.Ext
+	}
+	srcPath := filepath.Join(site.SrcRoot, filepath.FromSlash(rel))
+	base := path.Base(rel)
+	name := strings.TrimSuffix(base, path.Ext(base))
+	title, date := pageTitle(name), now.Format("2006-01-02")
+	var page string
+	if site.Archetype != "" && site.Engine == EngineGo {
+		if err := site.validateTemplate(site.Archetype); err != nil {
+			return "", err
+		}
+		data := goPage{
+			IndexEntry: IndexEntry{Src: srcPath, Title: title, Date: date},
+			Name:       name,
+			Site:       site.goSite(),
+		}
+		var err error
+		if page, err = site.executeGo(site.Archetype, data); err != nil {
+			return "", err
+		}
+	} else if site.Archetype != "" {
+		tpl, err := site.loadTemplate(site.Archetype)
+		if err != nil {
+			return "", err
+		}
+		env := append(os.Environ(),
+			"page_name="+name,
+			"page_title="+title,
+			"page_date="+date,
+			"site_name="+site.Name,
+			"src_path="+srcPath,
+		)
+		if page, err = config.render(ctx, site, tpl, append(env, site.Env...)); err != nil {
+			return "", err
+		}
+	} else {
+		// The title is quoted if needed.
+		b, err := yaml.Marshal(title)
+		if err != nil {
+			return "", err
+		}
+		page = fmt.Sprintf("---\ntitle: %sdate: %s\n---\n", b, date)
+	}
+	if err := os.MkdirAll(filepath.Dir(srcPath), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(srcPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(page); err != nil {
+		f.Close()
+		return "", err
+	}
+	return srcPath, f.Close()
+}
@@ -0,0 +1,27 @@
+package swb
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// selected reports whether the file at srcPath in the src tree of the site
+// is to be built, according to the patterns of config.Only, matched like
+// the ignore patterns. They can also be given relative to the working
+// directory, starting with the src tree root. BuildPage only selects its
+// page.
+func (config *Config) selected(site *Site, srcPath string) bool {
+	if config.page != "" {
+		return filepath.Clean(srcPath) == config.page
+	}
+	if len(config.Only) == 0 {
+		return true
+	}
+	root := filepath.ToSlash(filepath.Clean(site.SrcRoot)) + "/"
+	patterns := make([]string, len(config.Only))
+	for i, pattern := range config.Only {
+		patterns[i] = strings.TrimPrefix(path.Clean(filepath.ToSlash(pattern)), root)
+	}
+	return site.matchRel(patterns, srcPath)
+}
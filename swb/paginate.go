@@ -0,0 +1,259 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A paginator is a page of a paginated listing: a listing page of the src
+// tree (a page with paginate in its front matter) or a tag page, listing
+// the pageSize pages of its section or of its tag from its Items. The
+// first page of a listing is written at its output (e.g. blog/index.html),
+// and the next ones under its page directory (e.g. blog/page/2.html).
+type paginator struct {
+	// Number of the page, from 1, and number of pages of the listing.
+	Page  int
+	Pages int
+	// Number of pages listed by the listing, on every page.
+	Total int
+	Items []IndexEntry
+	// URLs of the pages of the listing, the previous and next ones being
+	// empty on the first and last pages.
+	First, Prev, Next, Last string
+}
+
+// env returns the environment of the commands of the templates rendering
+// the page of the listing, whose items are listed in the file at
+// itemsPath.
+func (pg *paginator) env(itemsPath string) []string {
+	return []string{
+		"paginator_page=" + strconv.Itoa(pg.Page),
+		"paginator_pages=" + strconv.Itoa(pg.Pages),
+		"paginator_total=" + strconv.Itoa(pg.Total),
+		"paginator_items=" + itemsPath,
+		"paginator_first=" + pg.First,
+		"paginator_prev=" + pg.Prev,
+		"paginator_next=" + pg.Next,
+		"paginator_last=" + pg.Last,
+	}
+}
+
+// validatePageSize checks the site's page size.
+func (site *Site) validatePageSize() error {
+	if site.PageSize < 0 {
+		return fmt.Errorf("site %s: pageSize: negative size %d", site.Name, site.PageSize)
+	}
+	return nil
+}
+
+// listing returns the dst directory listed by a page with the front matter
+// fm ("" for the whole site), or false if it is not a listing page. The
+// paginate key is either the directory, or true for the directory of the
+// page at the dst-relative path rel.
+func listing(fm map[string]any, rel string) (string, bool) {
+	var section string
+	switch v := fm["paginate"].(type) {
+	case bool:
+		if !v {
+			return "", false
+		}
+		section = path.Dir(rel)
+	case string:
+		section = v
+	default:
+		return "", false
+	}
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(section)), "/"), true
+}
+
+// pagesDir returns the directory of the next pages of the listing written
+// at the dst-relative path rel: the page directory next to the index of a
+// directory, or else in the directory named after the listing.
+func pagesDir(rel string) string {
+	dir, base := path.Split(rel)
+	if name := strings.TrimSuffix(base, path.Ext(base)); name != "index" {
+		dir = path.Join(dir, name)
+	}
+	return path.Join(dir, "page")
+}
+
+// pagePath returns the dst-relative path of the page n of the listing
+// written at rel.
+func (site *Site) pagePath(rel string, n int) string {
+	if n == 1 {
+		return rel
+	}
+	if site.CleanURLs && path.Ext(rel) == ".html" {
+		return path.Join(pagesDir(rel), strconv.Itoa(n), "index.html")
+	}
+	return path.Join(pagesDir(rel), strconv.Itoa(n)+path.Ext(rel))
+}
+
+// pageOf reports whether dstPath is one of the next pages of the listing
+// written at outPath.
+func (site *Site) pageOf(outPath, dstPath string) bool {
+	outRel := site.rel(outPath)
+	rest, ok := strings.CutPrefix(site.rel(dstPath), pagesDir(outRel)+"/")
+	if !ok {
+		return false
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	n, err := strconv.Atoi(strings.TrimSuffix(name, path.Ext(name)))
+	return err == nil && n > 1 && site.pagePath(outRel, n) == site.rel(dstPath)
+}
+
+// paginate splits the items of the listing written at the dst-relative
+// path rel in pages of the site's pageSize items, or in a single page if
+// it has none. A listing without items has a single empty page.
+func (site *Site) paginate(items []IndexEntry, rel string) []*paginator {
+	size := site.PageSize
+	if size == 0 {
+		size = max(len(items), 1)
+	}
+	n := max((len(items)+size-1)/size, 1)
+	pages := make([]*paginator, n)
+	for i := range pages {
+		lo := min(i*size, len(items))
+		pg := &paginator{
+			Page:  i + 1,
+			Pages: n,
+			Total: len(items),
+			Items: items[lo:min(lo+size, len(items))],
+			First: site.url(rel),
+			Last:  site.url(site.pagePath(rel, n)),
+		}
+		if i > 0 {
+			pg.Prev = site.url(site.pagePath(rel, i))
+		}
+		if i < n-1 {
+			pg.Next = site.url(site.pagePath(rel, i+2))
+		}
+		pages[i] = pg
+	}
+	return pages
+}
+
+// listed returns the pages listed by the listing page, among the pages
+// entries: the pages of its section, the most recent first, the ones
+// without a valid date last.
+func listed(pages []IndexEntry, listing IndexEntry) []IndexEntry {
+	type item struct {
+		IndexEntry
+		date time.Time
+	}
+	var items []item
+	for _, page := range pages {
+		if page.Src == listing.Src || path.Ext(page.Rel) != ".html" {
+			continue
+		}
+		if listing.section != "" && !strings.HasPrefix(page.Rel, listing.section+"/") {
+			continue
+		}
+		t, _ := parseDate(page.Date)
+		items = append(items, item{page, t})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].date.After(items[j].date) })
+	entries := make([]IndexEntry, len(items))
+	for i := range items {
+		entries[i] = items[i].IndexEntry
+	}
+	return entries
+}
+
+// writeListings writes the pages of the listing pages of the site, after
+// the other pages so that they list their last version, records them in
+// the manifest, and removes the pages the listings no longer have. A page
+// is only written if its content changed.
+func (config *Config) writeListings(ctx context.Context, site *Site, pages []IndexEntry, outputs map[string]string, manifest Manifest) error {
+	if config.DryRun {
+		// The commands of the templates are not run in a dry run.
+		return nil
+	}
+	var errs []error
+	for _, e := range pages {
+		if !e.listing {
+			continue
+		}
+		if err := config.writeListing(ctx, site, e, listed(pages, e), outputs, manifest); err != nil {
+			config.fail(site)
+			errs = append(errs, phaseError(PhaseBuild, e.Src, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeListing writes the pages of the listing page e, listing items.
+func (config *Config) writeListing(ctx context.Context, site *Site, e IndexEntry, items []IndexEntry, outputs map[string]string, manifest Manifest) error {
+	srcInfo, err := site.stat(e.Src)
+	if err != nil {
+		return err
+	}
+	written := make(map[string]bool)
+	for _, pg := range site.paginate(items, e.Rel) {
+		rel := site.pagePath(e.Rel, pg.Page)
+		dstPath := filepath.Join(site.DstRoot, filepath.FromSlash(rel))
+		if pg.Page > 1 {
+			if src, ok := outputs[dstPath]; ok {
+				return fmt.Errorf("%s is also the output of %s", dstPath, src)
+			}
+			outputs[dstPath] = e.Src
+		}
+		b, err := config.renderPage(ctx, site, e.Src, dstPath, pg)
+		if err != nil {
+			return err
+		}
+		// The first page is the output of the listing page, the next ones
+		// have been checked above.
+		if err := config.writeGenerated(site, rel, b, nil); err != nil {
+			return err
+		}
+		if manifest[rel], err = site.manifestEntry(e.Src, srcInfo, dstPath); err != nil {
+			return err
+		}
+		written[rel] = true
+	}
+	return config.removePages(site, e.Rel, written, outputs)
+}
+
+// removePages removes the pages of the listing written at the dst-relative
+// path rel which are not written, nor outputs of the src tree.
+func (config *Config) removePages(site *Site, rel string, written map[string]bool, outputs map[string]string) error {
+	dir := filepath.Join(site.DstRoot, filepath.FromSlash(pagesDir(rel)))
+	ents, err := site.readDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, ent := range ents {
+		n, err := strconv.Atoi(strings.TrimSuffix(ent.Name(), path.Ext(ent.Name())))
+		if err != nil || n < 2 || written[site.pagePath(rel, n)] {
+			continue
+		}
+		dstPath := filepath.Join(site.DstRoot, filepath.FromSlash(site.pagePath(rel, n)))
+		if _, ok := outputs[dstPath]; ok {
+			continue
+		}
+		if _, err := site.stat(dstPath); err != nil {
+			continue
+		}
+		config.action(site, ActionRemove, dstPath, 0)
+		if err := site.remove(dstPath); err != nil {
+			return err
+		}
+		if site.CleanURLs {
+			// The directory of the page, if it is empty.
+			site.remove(filepath.Dir(dstPath))
+		}
+	}
+	return nil
+}
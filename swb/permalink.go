@@ -0,0 +1,140 @@
+package swb
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A Permalink maps the derived files of the src tree matching a glob
+// pattern to another path of the dst tree than their own.
+type Permalink struct {
+	// Glob pattern matched against the path of the file relative to the
+	// src tree root, or against its base name if it has no slash (e.g.
+	// posts/*.md or feed.md).
+	Match string `json:"match" toml:"match" yaml:"match"`
+	// Path of the output relative to the dst tree root, where :dir, :name,
+	// :slug, :year, :month, :day and :ext are replaced by the parts of the
+	// path of the file (e.g. :year/:month/:slug:ext).
+	Path string `json:"path" toml:"path" yaml:"path"`
+}
+
+// permalinkVarRe matches the variables of a permalink path.
+var permalinkVarRe = regexp.MustCompile(`:([a-z]+)`)
+
+// datedRe matches the names of files prefixed with a date (e.g.
+// 2024-03-01-hello).
+var datedRe = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})-(.+)$`)
+
+// validatePermalinks checks the patterns and paths of the site's
+// permalinks.
+func (site *Site) validatePermalinks() error {
+	for i, p := range site.Permalinks {
+		if p.Match == "" || p.Path == "" {
+			return fmt.Errorf("site %s: permalinks[%d]: match and path are required", site.Name, i)
+		}
+		if _, err := path.Match(p.Match, ""); err != nil {
+			return fmt.Errorf("site %s: permalinks[%d]: match %s: %v", site.Name, i, p.Match, err)
+		}
+		for _, m := range permalinkVarRe.FindAllStringSubmatch(p.Path, -1) {
+			switch m[1] {
+			case "dir", "name", "slug", "year", "month", "day", "ext":
+			default:
+				return fmt.Errorf("site %s: permalinks[%d]: unknown variable %s in %s", site.Name, i, m[0], p.Path)
+			}
+		}
+		clean := path.Clean(p.Path)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("site %s: permalinks[%d]: path %s is not in the dst tree", site.Name, i, p.Path)
+		}
+	}
+	return nil
+}
+
+// permalink returns the dst-relative path of the output of the file at the
+// src-relative path rel, derived by r, according to the first permalink
+// matching it. The permalinks using the date of the files only match the
+// ones prefixed with a date.
+func (site *Site) permalink(r *rule, rel string) (string, bool) {
+	dir, base := path.Split(rel)
+	name := strings.TrimSuffix(base, path.Ext(base))
+	var date []string
+	if m := datedRe.FindStringSubmatch(name); m != nil {
+		date, name = m[1:4], m[4]
+	}
+	for _, p := range site.Permalinks {
+		target := rel
+		if !strings.Contains(p.Match, "/") {
+			target = base
+		}
+		if ok, _ := path.Match(p.Match, target); !ok {
+			continue
+		}
+		dated := true
+		datePart := func(i int) string {
+			if date == nil {
+				dated = false
+				return ""
+			}
+			return date[i]
+		}
+		out := permalinkVarRe.ReplaceAllStringFunc(p.Path, func(v string) string {
+			switch v {
+			case ":dir":
+				return strings.TrimSuffix(dir, "/")
+			case ":name":
+				return name
+			case ":slug":
+				return slug(name)
+			case ":year":
+				return datePart(0)
+			case ":month":
+				return datePart(1)
+			case ":day":
+				return datePart(2)
+			}
+			return r.outExt
+		})
+		out = strings.TrimPrefix(path.Clean("/"+out), "/")
+		if !dated || out == "" {
+			continue
+		}
+		return out, true
+	}
+	return "", false
+}
+
+// mapPermalinks records the dst paths of the files of the src tree mapped
+// by the site's permalinks, or moved to the directory of their language, to
+// know before the dst tree is tidied that these files are derived.
+func (site *Site) mapPermalinks(rules []*rule) error {
+	site.permalinked = nil
+	if len(site.Permalinks) == 0 && len(site.Languages) == 0 {
+		return nil
+	}
+	site.permalinked = make(map[string]bool)
+	return site.walkSrc(func(srcPath string, info fs.FileInfo) error {
+		if info.IsDir() || isDirFile(srcPath) {
+			return nil
+		}
+		r := findRule(rules, filepath.Ext(srcPath))
+		if r == nil || r.skipped(srcPath) {
+			return nil
+		}
+		if rel, ok := site.permalink(r, site.srcRel(srcPath)); ok {
+			site.permalinked[filepath.Join(site.DstRoot, filepath.FromSlash(rel))] = true
+		} else if _, ok := site.langPath(site.srcRel(srcPath)); ok && r.page {
+			dstPath, _ := site.output(rules, srcPath)
+			site.permalinked[dstPath] = true
+		}
+		return nil
+	})
+}
+
+// srcRel returns the path of srcPath relative to the root of the src tree.
+func (site *Site) srcRel(srcPath string) string {
+	return filepath.ToSlash(strings.TrimPrefix(strings.TrimPrefix(srcPath, site.SrcRoot), string(filepath.Separator)))
+}
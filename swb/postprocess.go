@@ -0,0 +1,82 @@
+package swb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// validatePostProcess checks that the post-processing filters are keyed by
+// extensions and have a command.
+func (config *Config) validatePostProcess() error {
+	for ext, cmd := range config.PostProcess {
+		if !strings.HasPrefix(ext, ".") || len(cmd) == 0 {
+			return fmt.Errorf("postProcess: %q: an extension and a command are required", ext)
+		}
+	}
+	return nil
+}
+
+// copyRules returns the rules copying the files that would otherwise be
+// linked, but whose extension has a post-processing filter: filtering a
+// linked file would modify its source.
+func (config *Config) copyRules(site *Site, rules []*rule) []*rule {
+	var copies []*rule
+	for _, ext := range slices.Sorted(maps.Keys(config.PostProcess)) {
+		if findRule(rules, ext) != nil {
+			continue
+		}
+		copies = append(copies, &rule{ext: ext, outExt: ext, asset: true, build: site.copyFile})
+	}
+	return copies
+}
+
+func (site *Site) copyFile(ctx context.Context, srcPath, dstPath string) error {
+	src, err := site.open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	// The dst file, which may still be a link to the src one, is replaced
+	// rather than written.
+	return site.writeReader(dstPath, src, 0644)
+}
+
+// postProcess runs the post-processing filter of the extension of dstPath,
+// if any, on the file derived from srcPath.
+func (config *Config) postProcess(ctx context.Context, site *Site, srcPath, dstPath string) error {
+	filter, ok := config.PostProcess[filepath.Ext(dstPath)]
+	if !ok {
+		return nil
+	}
+	b, err := site.readFile(dstPath)
+	if err != nil {
+		return err
+	}
+	env := config.env(site, srcPath, dstPath)
+	argv := expandArgs(filter, env)
+	ctx, cancel := config.commandContext(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(b)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	t := time.Now()
+	err = config.runCommand(ctx, cmd)
+	config.command(site, Command{Argv: cmd.Args, Duration: time.Since(t), Page: srcPath, Stderr: stderr.String()})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", argv[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", argv[0], err)
+	}
+	return site.writeFile(dstPath, stdout.Bytes(), 0644)
+}
@@ -0,0 +1,166 @@
+package swb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A Precompress tells which files of the dst tree get compressed copies,
+// written next to them (e.g. index.html.gz) for the servers to serve them
+// as they are (e.g. nginx with gzip_static).
+type Precompress struct {
+	// Extensions of the compressed files, .html, .css and .js by default.
+	Exts []string `json:"exts,omitempty" toml:"exts,omitempty" yaml:"exts,omitempty"`
+	// Gzip, if true, makes swb write the .gz copies.
+	Gzip bool `json:"gzip,omitempty" toml:"gzip,omitempty" yaml:"gzip,omitempty"`
+	// Brotli is the command writing the .br copies, like the command of a
+	// transform.
+	Brotli []string `json:"brotli,omitempty" toml:"brotli,omitempty" yaml:"brotli,omitempty"`
+}
+
+// validatePrecompress checks the site's precompression, and sets its
+// defaults.
+func (site *Site) validatePrecompress() error {
+	pc := site.Precompress
+	if pc == nil {
+		return nil
+	}
+	if !pc.Gzip && len(pc.Brotli) == 0 {
+		return fmt.Errorf("site %s: precompress: gzip or brotli is required", site.Name)
+	}
+	if len(pc.Exts) == 0 {
+		pc.Exts = []string{".html", ".css", ".js"}
+	}
+	return nil
+}
+
+// compressedExts returns the extensions of the compressed copies written
+// for the site.
+func (pc *Precompress) compressedExts() []string {
+	var exts []string
+	if pc.Gzip {
+		exts = append(exts, ".gz")
+	}
+	if len(pc.Brotli) > 0 {
+		exts = append(exts, ".br")
+	}
+	return exts
+}
+
+// compressedOf returns the path of the file the file at path is the
+// compressed copy of, if it is one.
+func (site *Site) compressedOf(path string) (string, bool) {
+	pc := site.Precompress
+	if pc == nil || !slices.Contains(pc.compressedExts(), filepath.Ext(path)) {
+		return "", false
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return base, slices.Contains(pc.Exts, filepath.Ext(base))
+}
+
+// copyKept reports whether the compressed copy at path is the copy of a
+// file of the dst tree which is kept or derived.
+func (site *Site) copyKept(rules []*rule, path string) (bool, error) {
+	base, _ := site.compressedOf(path)
+	info, err := site.stat(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return false, err
+	}
+	if site.kept(site.rel(base)) {
+		return true, nil
+	}
+	return site.derived(rules, base, info)
+}
+
+// precompress writes the compressed copies of the files of the dst tree of
+// the site which have none, or whose copy is older than them. A copy has
+// the modification time of its file, which tells if it is up to date.
+func (config *Config) precompress(ctx context.Context, site *Site) error {
+	pc := site.Precompress
+	if pc == nil {
+		return nil
+	}
+	return site.walkDst(func(path string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == site.DstRoot {
+			return nil
+		}
+		// The files kept in the dst tree are not the site's, unlike the
+		// ones generated by swb.
+		if matchAny(site.Keep, site.rel(path)) {
+			if ent.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !ent.Type().IsRegular() || !slices.Contains(pc.Exts, filepath.Ext(path)) {
+			return nil
+		}
+		info, err := ent.Info()
+		if err != nil {
+			return err
+		}
+		for _, ext := range pc.compressedExts() {
+			outPath := path + ext
+			if outInfo, err := site.stat(outPath); err == nil && outInfo.ModTime().Equal(info.ModTime()) {
+				continue
+			}
+			if config.DryRun {
+				config.action(site, ActionBuild, outPath, 0)
+				continue
+			}
+			t := time.Now()
+			if ext == ".gz" {
+				err = site.gzipFile(path, outPath)
+			} else {
+				t := Transform{Ext: filepath.Ext(path), OutExt: ext, Cmd: pc.Brotli}
+				err = config.transform(ctx, site, t, path, outPath)
+			}
+			if err == nil {
+				// The compressed copy is served like the file.
+				err = site.chmod(outPath, info.Mode().Perm())
+			}
+			if err == nil {
+				err = site.chtimes(outPath, info.ModTime())
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", outPath, err)
+			}
+			config.action(site, ActionBuild, outPath, time.Since(t))
+		}
+		return nil
+	})
+}
+
+// gzipFile writes the gzip compressed copy of the file at path to outPath.
+func (site *Site) gzipFile(path, outPath string) error {
+	b, err := site.readFile(path)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&out, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(b); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return site.writeFile(outPath, out.Bytes(), 0644)
+}
@@ -0,0 +1,65 @@
+package swb
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// A Profile is an overlay of the configuration, applied when it is loaded
+// with LoadProfile (e.g. a "prod" profile setting the baseURL of the sites
+// and minifying their files).
+type Profile struct {
+	// Drafts, if true, builds the draft pages too (see Config.Drafts).
+	Drafts bool `json:"drafts,omitempty" toml:"drafts,omitempty" yaml:"drafts,omitempty"`
+	// Future, if true, builds the pages dated in the future too (see
+	// Config.Future).
+	Future bool `json:"future,omitempty" toml:"future,omitempty" yaml:"future,omitempty"`
+	// Sites are the overlays of the sites of the same name: the fields
+	// they set replace the ones of the sites.
+	Sites []*Site `json:"sites,omitempty" toml:"sites,omitempty" yaml:"sites,omitempty"`
+}
+
+// applyProfile merges the profile called name over the configuration, and
+// drops the profiles, which are only used by LoadProfile.
+func (config *Config) applyProfile(name string) error {
+	profiles := config.Profiles
+	config.Profiles = nil
+	if name == "" {
+		return nil
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("profiles: no profile named %s (profiles: %s)", name, strings.Join(names, ", "))
+	}
+	config.Drafts = config.Drafts || profile.Drafts
+	config.Future = config.Future || profile.Future
+	for i, overlay := range profile.Sites {
+		j := slices.IndexFunc(config.Sites, func(site *Site) bool { return site.Name == overlay.Name })
+		if j < 0 {
+			return fmt.Errorf("profiles: %s: sites[%d]: no site named %s", name, i, overlay.Name)
+		}
+		config.Sites[j].overlay(overlay)
+	}
+	return nil
+}
+
+// overlay replaces the configured fields of the site by the ones set in
+// the overlay o.
+func (site *Site) overlay(o *Site) {
+	dst := reflect.ValueOf(site).Elem()
+	src := reflect.ValueOf(o).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		f := src.Type().Field(i)
+		if !f.IsExported() || f.Tag.Get("json") == "-" || src.Field(i).IsZero() {
+			continue
+		}
+		dst.Field(i).Set(src.Field(i))
+	}
+}
@@ -0,0 +1,253 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// Progress is notified of the progress of the builds, e.g. to report them to
+// the user (see Logger).
+type Progress interface {
+	// Action is called for every action performed on path, d is the time
+	// it took if relevant.
+	Action(site *Site, action, path string, d time.Duration)
+	// Command is called for every command run to build the site.
+	Command(site *Site, cmd Command)
+	// Fail is called for every file of the site that failed to build.
+	Fail(site *Site)
+	// Warn is called for every problem found on path that does not make
+	// it fail (e.g. by a page check).
+	Warn(site *Site, path, msg string)
+}
+
+// A Report lists the paths of the dst tree affected by a build or a clean.
+type Report struct {
+	Built []string
+	// Rebuilt are the paths of Built which replaced an existing file.
+	Rebuilt []string
+	Linked  []string
+	Removed []string
+	// Skipped are the paths found up to date, or the dst tree itself when
+	// the whole site is.
+	Skipped []string
+	// Durations are the times the Built paths took to build.
+	Durations map[string]time.Duration
+	// Phases are the times the phases of the build or the clean took (e.g.
+	// PhaseWalk, which includes the builds of the files), by phase.
+	Phases map[string]time.Duration
+	// Commands are the commands run to build the site.
+	Commands []Command
+	// Warnings are the problems that did not make the build fail, as
+	// "path: message".
+	Warnings []string
+}
+
+// A Command is a command run to build a site, and the time it took.
+type Command struct {
+	Argv     []string
+	Duration time.Duration
+	// Page is the src path of the page the command was run for, and Block
+	// the template block it runs, as path:line, if any.
+	Page  string
+	Block string
+	// Stderr is the standard error of the command, which only makes the
+	// build fail if the command does.
+	Stderr string
+}
+
+// BuildSite builds the dst tree of the site, and tidies it from the files
+// having no counterpart in the src tree.
+func (config *Config) BuildSite(ctx context.Context, site *Site) (report Report, err error) {
+	site.report = &report
+	defer func() { site.report = nil }()
+	lap := site.stopwatch()
+	unlock, err := config.lock(ctx, site)
+	if err != nil {
+		return report, phaseError(PhaseDst, site.DstRoot, err)
+	}
+	defer unlock()
+	// The time waiting for another process to unlock the dst tree.
+	lap(PhaseDst)
+	endLog, err := site.startLog()
+	if err != nil {
+		return report, phaseError(PhaseDst, site.BuildLog, err)
+	}
+	defer func() { endLog(err) }()
+	return report, config.build(ctx, site)
+}
+
+// CleanSite removes the content of the dst tree of the site, except for the
+// kept files.
+func (config *Config) CleanSite(ctx context.Context, site *Site) (Report, error) {
+	var report Report
+	site.report = &report
+	defer func() { site.report = nil }()
+	lap := site.stopwatch()
+	err := phaseError(PhaseClean, site.DstRoot, config.clean(ctx, site))
+	lap(PhaseClean)
+	return report, err
+}
+
+// A SiteResult is the outcome of the build or the clean of a site.
+type SiteResult struct {
+	Site   *Site
+	Report Report
+	// Duration is the time the site took.
+	Duration time.Duration
+	// Err is the error of the site, if it failed (see BuildError).
+	Err error
+}
+
+// Build builds the dst trees of all the sites, like BuildSite, logging
+// their progress to w (if not nil) like the swb command. A failing site
+// does not prevent the next ones from being built: the result of every
+// site is returned, and the errors of the failed ones are joined.
+func (config *Config) Build(ctx context.Context, w io.Writer) ([]SiteResult, error) {
+	return config.runSites(ctx, w, config.Sites, config.BuildSite)
+}
+
+// Clean clears the dst trees of all the sites, like CleanSite, logging
+// their progress to w (if not nil) like Build.
+func (config *Config) Clean(ctx context.Context, w io.Writer) ([]SiteResult, error) {
+	return config.runSites(ctx, w, config.Sites, config.CleanSite)
+}
+
+// BuildPage builds the file of a src tree at srcPath (a page, or any other
+// file), even if it is up to date, logging the progress to w (if not nil)
+// like Build. The other files of its site are left as they are.
+func (config *Config) BuildPage(ctx context.Context, srcPath string, w io.Writer) (SiteResult, error) {
+	site, path, err := config.SiteOf(srcPath)
+	if err != nil {
+		return SiteResult{}, err
+	}
+	config.page = path
+	defer func() { config.page = "" }()
+	force := config.Force
+	config.Force = true
+	defer func() { config.Force = force }()
+	results, err := config.runSites(ctx, w, []*Site{site}, config.BuildSite)
+	if len(results) == 0 {
+		return SiteResult{Site: site, Err: err}, err
+	}
+	return results[0], err
+}
+
+// SiteOf returns the site whose src tree holds the file at path, and the
+// path of the file under its SrcRoot.
+func (config *Config) SiteOf(path string) (*Site, string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, site := range config.Sites {
+		root, err := filepath.Abs(site.SrcRoot)
+		if err != nil {
+			return nil, "", err
+		}
+		if !under(absPath, root) || absPath == root {
+			continue
+		}
+		rel, _ := filepath.Rel(root, absPath)
+		return site, filepath.Join(site.SrcRoot, rel), nil
+	}
+	return nil, "", fmt.Errorf("%s is in no src tree", path)
+}
+
+// runSites runs run on the sites, logging their progress to w if it is not
+// nil, in place of config.Progress.
+func (config *Config) runSites(ctx context.Context, w io.Writer, sites []*Site, run func(context.Context, *Site) (Report, error)) ([]SiteResult, error) {
+	var logger *Logger
+	if w != nil {
+		logger = NewLogger(w, LevelNormal, false)
+		progress := config.Progress
+		config.Progress = logger
+		defer func() { config.Progress = progress }()
+	}
+	results := make([]SiteResult, 0, len(sites))
+	var errs []error
+	for _, site := range sites {
+		if err := ctx.Err(); err != nil {
+			return results, errors.Join(append(errs, err)...)
+		}
+		if logger != nil {
+			logger.Start(site)
+		}
+		start := time.Now()
+		report, err := run(ctx, site)
+		results = append(results, SiteResult{Site: site, Report: report, Duration: time.Since(start), Err: err})
+		if err != nil {
+			if logger != nil {
+				fmt.Fprintf(w, "site %s failed: %s\n", site.Name, FormatErrors(err))
+			}
+			errs = append(errs, fmt.Errorf("site %s: %w", site.Name, err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+func (config *Config) action(site *Site, action, path string, d time.Duration) {
+	if site.report != nil {
+		switch action {
+		case ActionBuild, ActionRebuild:
+			site.report.Built = append(site.report.Built, path)
+			if action == ActionRebuild {
+				site.report.Rebuilt = append(site.report.Rebuilt, path)
+			}
+			if d > 0 {
+				if site.report.Durations == nil {
+					site.report.Durations = make(map[string]time.Duration)
+				}
+				site.report.Durations[path] = d
+			}
+		case ActionLink:
+			site.report.Linked = append(site.report.Linked, path)
+		case ActionRemove, ActionRmdir:
+			site.report.Removed = append(site.report.Removed, path)
+		case ActionSkip:
+			site.report.Skipped = append(site.report.Skipped, path)
+		}
+	}
+	if site.log != nil {
+		site.log.Action(site, action, path, d)
+	}
+	if config.Progress != nil {
+		config.Progress.Action(site, action, path, d)
+	}
+}
+
+func (config *Config) command(site *Site, cmd Command) {
+	if site.report != nil {
+		site.report.Commands = append(site.report.Commands, cmd)
+	}
+	if site.log != nil {
+		site.log.Command(site, cmd)
+	}
+	if config.Progress != nil {
+		config.Progress.Command(site, cmd)
+	}
+}
+
+func (config *Config) fail(site *Site) {
+	if site.log != nil {
+		site.log.Fail(site)
+	}
+	if config.Progress != nil {
+		config.Progress.Fail(site)
+	}
+}
+
+func (config *Config) warn(site *Site, path, msg string) {
+	if site.report != nil {
+		site.report.Warnings = append(site.report.Warnings, path+": "+msg)
+	}
+	if site.log != nil {
+		site.log.Warn(site, path, msg)
+	}
+	if config.Progress != nil {
+		config.Progress.Warn(site, path, msg)
+	}
+}
@@ -0,0 +1,208 @@
+package swb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProvenanceFile is the name of the provenance record written at the root of
+// every dst tree after a successful build.
+const ProvenanceFile = ".swb-provenance.json"
+
+type Binary struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+type Provenance struct {
+	Version      string    `json:"version"`
+	ConfigHash   string    `json:"configHash"`
+	SourceCommit string    `json:"sourceCommit,omitempty"`
+	Binaries     []Binary  `json:"binaries"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	ManifestHash string    `json:"manifestHash"`
+}
+
+// now returns the current time, unless the build is reproducible (i.e.
+// SOURCE_DATE_EPOCH is set), in which case the clock is pinned to the given
+// epoch.
+func now() time.Time {
+	if epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		if sec, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+func (config *Config) writeProvenance(site *Site, start time.Time) error {
+	manifestHash, err := manifestHash(site)
+	if err != nil {
+		return err
+	}
+	p := Provenance{
+		Version:      Version,
+		ConfigHash:   config.hash,
+		SourceCommit: gitCommit(site.SrcRoot),
+		Binaries:     config.binaries(),
+		Start:        start,
+		End:          now(),
+		ManifestHash: manifestHash,
+	}
+	b, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	return site.writeFile(filepath.Join(site.DstRoot, ProvenanceFile), append(b, '\n'), site.newFileMode())
+}
+
+// programs returns the names of the programs involved in the build (the
+// template interpreter and the builders, but the internal one).
+func (config *Config) programs() []string {
+	var names []string
+	if len(config.RunCmd) > 0 {
+		names = append(names, config.RunCmd[0])
+	}
+	for _, b := range config.builders() {
+		if fields := strings.Fields(b.Bin); len(fields) > 0 && b.Bin != BuilderInternal && !slices.Contains(names, fields[0]) {
+			names = append(names, fields[0])
+		}
+	}
+	return names
+}
+
+// binaries resolves the programs involved in the build and hashes their
+// content.
+func (config *Config) binaries() []Binary {
+	var binaries []Binary
+	for _, name := range config.programs() {
+		bin := Binary{Name: name}
+		if path, err := exec.LookPath(name); err == nil {
+			bin.Path, _ = filepath.Abs(path)
+			bin.Hash, _ = fileHash(path)
+		}
+		binaries = append(binaries, bin)
+	}
+	return binaries
+}
+
+// gitCommit returns the commit checked out in the git repository holding
+// dir, or an empty string if dir is not in a git repository.
+func gitCommit(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return contentHash(f)
+}
+
+// fileHash is fileHash for the files of the trees of the site.
+func (site *Site) fileHash(path string) (string, error) {
+	f, err := site.open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return contentHash(f)
+}
+
+// contentHash returns the hash of the content read from r.
+func contentHash(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// records are the files swb writes at the root of the dst trees to keep
+// track of their builds, which are not part of their output.
+var records = []string{ProvenanceFile, StateFile, ManifestFile, DeployFile, LockFile}
+
+// manifestHash hashes the content of the dst tree, i.e. every path relative
+// to DstRoot along with the hash of its content. The records of the builds
+// and the files kept by the site are not part of the build output, so they
+// are left out; the files generated by swb (e.g. the feed) are hashed like
+// the other outputs.
+func manifestHash(site *Site) (string, error) {
+	h := sha256.New()
+	err := site.walkDst(func(path string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == site.DstRoot {
+			return nil
+		}
+		rel := strings.TrimPrefix(path, site.DstRoot+string(filepath.Separator))
+		if slices.Contains(records, filepath.ToSlash(rel)) || matchAny(site.Keep, rel) {
+			if ent.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case ent.IsDir():
+			fmt.Fprintf(h, "%s/\n", filepath.ToSlash(rel))
+		case ent.Type()&fs.ModeSymlink != 0:
+			target, err := site.readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s -> %s\n", filepath.ToSlash(rel), target)
+		default:
+			sum, err := site.fileHash(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s %s\n", filepath.ToSlash(rel), sum)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyProvenance checks that the content of the dst tree of the site
+// matches its provenance record.
+func (config *Config) VerifyProvenance(site *Site) error {
+	b, err := site.readFile(filepath.Join(site.DstRoot, ProvenanceFile))
+	if err != nil {
+		return err
+	}
+	var p Provenance
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	manifestHash, err := manifestHash(site)
+	if err != nil {
+		return err
+	}
+	if manifestHash != p.ManifestHash {
+		return fmt.Errorf("manifest hash mismatch: recorded %s, computed %s", p.ManifestHash, manifestHash)
+	}
+	return nil
+}
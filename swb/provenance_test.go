@@ -0,0 +1,42 @@
+package swb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestVerifyProvenance checks that the outputs swb generates, like the feed,
+// are part of the manifest hash of the provenance record, but not the files
+// the site keeps.
+func TestVerifyProvenance(t *testing.T) {
+	config := fixtureSite(t, map[string]string{
+		"site.tpl":     "%content%\n",
+		"src/index.md": "---\ndate: 2024-01-02\n---\n# Home\n",
+	}, map[string]any{
+		"baseURL": "https://example.com",
+		"feed":    map[string]any{},
+		"keep":    []string{"CNAME"},
+	})
+	site := config.Sites[0]
+	if _, err := config.BuildSite(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.VerifyProvenance(site); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, site.DstRoot, map[string]string{"CNAME": "example.com\n"})
+	if err := config.VerifyProvenance(site); err != nil {
+		t.Errorf("kept file changed: %v", err)
+	}
+	feed := filepath.Join(site.DstRoot, "atom.xml")
+	if _, err := os.Stat(feed); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, site.DstRoot, map[string]string{"atom.xml": "<feed/>\n"})
+	if err := config.VerifyProvenance(site); err == nil || !strings.Contains(err.Error(), "manifest hash mismatch") {
+		t.Errorf("feed changed: error %v, want a manifest hash mismatch", err)
+	}
+}
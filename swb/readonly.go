@@ -0,0 +1,33 @@
+package swb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// probeWritable checks that files can be written in the dst tree of the
+// site, so that a read-only tree fails the site once and for all. A Dst
+// reports its own errors.
+func (site *Site) probeWritable() error {
+	if site.Dst != nil {
+		return nil
+	}
+	f, err := os.CreateTemp(site.DstRoot, ".swb-probe-*")
+	if err != nil {
+		if errors.Is(err, syscall.EROFS) {
+			return fmt.Errorf("dst tree %s is read-only: %w", site.DstRoot, syscall.EROFS)
+		}
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// IsEnvironmental reports whether err is due to the environment of the
+// build (e.g. a read-only dst tree, or one locked by another process)
+// rather than to the content of the site.
+func IsEnvironmental(err error) bool {
+	return errors.Is(err, syscall.EROFS) || errors.Is(err, ErrLocked)
+}
@@ -0,0 +1,226 @@
+package swb
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Formats of the redirects of the aliases of the pages: stub pages
+// refreshing to the pages (the default), or a redirects file for Netlify
+// (and the hosts sharing its format, e.g. Cloudflare Pages) or nginx.
+const (
+	RedirectsHTML    = "html"
+	RedirectsNetlify = "netlify"
+	RedirectsNginx   = "nginx"
+)
+
+// Redirects are the redirects of the former URLs of the pages of a site,
+// listed by the aliases key of their front matter, so that renamed pages
+// do not break the links to them.
+type Redirects struct {
+	// Format of the redirects, html by default.
+	Format string `json:"format,omitempty" toml:"format,omitempty" yaml:"format,omitempty"`
+	// Path of the redirects file relative to the root of the dst tree,
+	// _redirects for netlify and redirects.conf for nginx.
+	Path string `json:"path,omitempty" toml:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// validateRedirects checks the site's redirects, and sets their defaults.
+func (site *Site) validateRedirects() error {
+	r := site.Redirects
+	if r == nil {
+		return nil
+	}
+	switch r.Format {
+	case "", RedirectsHTML:
+		r.Format = RedirectsHTML
+		if r.Path != "" {
+			return fmt.Errorf("site %s: redirects: path requires the netlify or nginx format", site.Name)
+		}
+		return nil
+	case RedirectsNetlify:
+		if r.Path == "" {
+			r.Path = "_redirects"
+		}
+	case RedirectsNginx:
+		if r.Path == "" {
+			r.Path = "redirects.conf"
+		}
+	default:
+		return fmt.Errorf("site %s: redirects: unknown format %q (html, netlify or nginx)", site.Name, r.Format)
+	}
+	r.Path = path.Clean(filepath.ToSlash(r.Path))
+	if path.IsAbs(r.Path) || r.Path == ".." || strings.HasPrefix(r.Path, "../") {
+		return fmt.Errorf("site %s: redirects: path %s is not in the dst tree", site.Name, r.Path)
+	}
+	return nil
+}
+
+// redirectFormat returns the format of the redirects of the site.
+func (site *Site) redirectFormat() string {
+	if site.Redirects == nil {
+		return RedirectsHTML
+	}
+	return site.Redirects.Format
+}
+
+// aliases returns the former URLs of a page from its front matter.
+func aliases(fm map[string]any) []string {
+	switch v := fm["aliases"].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var aliases []string
+		for _, alias := range v {
+			if alias := frontMatterValue(alias); alias != "" {
+				aliases = append(aliases, alias)
+			}
+		}
+		return aliases
+	}
+	return nil
+}
+
+// aliasURL returns the URL of the alias of the page at the dst-relative path
+// rel, relative to the root of the site, or false if it is not a path of
+// the site. A relative alias is relative to the directory of the page, and
+// an alias without an extension is a directory (e.g. /blog/old-post/).
+func aliasURL(rel, alias string) (string, bool) {
+	alias = strings.TrimSpace(alias)
+	if alias == "" || schemeRe.MatchString(alias) || strings.HasPrefix(alias, "//") || strings.ContainsAny(alias, "?#") {
+		return "", false
+	}
+	if !strings.HasPrefix(alias, "/") {
+		alias = path.Join("/", path.Dir(rel), alias)
+	}
+	u := path.Clean(alias)
+	if u != "/" && (strings.HasSuffix(alias, "/") || path.Ext(u) == "") {
+		u += "/"
+	}
+	return u, true
+}
+
+// aliasPath returns the dst-relative path of the stub page of the alias at
+// the URL u.
+func aliasPath(u string) string {
+	if strings.HasSuffix(u, "/") {
+		u += "index.html"
+	}
+	return strings.TrimPrefix(u, "/")
+}
+
+// aliasOf reports whether the file at the dst-relative path rel is the stub
+// page of an alias of the page with the front matter fm, written at outRel.
+func (site *Site) aliasOf(fm map[string]any, outRel, rel string) bool {
+	if site.redirectFormat() != RedirectsHTML {
+		return false
+	}
+	for _, alias := range aliases(fm) {
+		if u, ok := aliasURL(outRel, alias); ok && aliasPath(u) == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectStub is the stub page of an alias, redirecting to the page.
+const redirectStub = `<!DOCTYPE html>
+<html%s>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<link rel="canonical" href="%s">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url=%s">
+</head>
+<body>
+<p>This page has moved to <a href="%s">%s</a>.</p>
+</body>
+</html>
+`
+
+// redirectTarget returns the URL the aliases of the page redirect to, with
+// the site's base URL if it has one.
+func (site *Site) redirectTarget(page IndexEntry) string {
+	return site.BaseURL + page.URL
+}
+
+// stub returns the stub page of an alias of the page.
+func (site *Site) stub(page IndexEntry) []byte {
+	target := html.EscapeString(site.redirectTarget(page))
+	var lang string
+	if page.Lang != "" {
+		lang = ` lang="` + page.Lang + `"`
+	}
+	title := page.Title
+	if title == "" {
+		title = page.URL
+	}
+	return fmt.Appendf(nil, redirectStub, lang, html.EscapeString(title), target, target, target, html.EscapeString(title))
+}
+
+// writeRedirects writes the redirects of the aliases of the pages: their
+// stub pages, recorded in the manifest as outputs of the pages so that they
+// are removed with their alias, or the site's redirects file. A file is
+// only written if its content changed.
+func (config *Config) writeRedirects(site *Site, pages []IndexEntry, outputs map[string]string, manifest Manifest) error {
+	format := site.redirectFormat()
+	aliased := make(map[string]string)
+	var lines []string
+	for _, page := range pages {
+		for _, u := range page.Aliases {
+			if src, ok := aliased[u]; ok {
+				return fmt.Errorf("%s: alias %s is also an alias of %s", page.Src, u, src)
+			}
+			aliased[u] = page.Src
+			switch format {
+			case RedirectsNetlify:
+				lines = append(lines, fmt.Sprintf("%s %s 301", u, site.redirectTarget(page)))
+			case RedirectsNginx:
+				lines = append(lines, nginxRedirect(u, site.redirectTarget(page)))
+			default:
+				if err := config.writeStub(site, page, u, outputs, manifest); err != nil {
+					return fmt.Errorf("%s: %w", page.Src, err)
+				}
+			}
+		}
+	}
+	if format == RedirectsHTML {
+		return nil
+	}
+	header := "# Redirects of the aliases of the pages, generated by swb.\n"
+	if format == RedirectsNginx {
+		header = "# Redirects of the aliases of the pages, generated by swb, to include in a server block.\n"
+	}
+	return config.writeGenerated(site, site.Redirects.Path, []byte(header+strings.Join(append(lines, ""), "\n")), outputs)
+}
+
+// writeStub writes the stub page of the alias at the URL u of the page.
+func (config *Config) writeStub(site *Site, page IndexEntry, u string, outputs map[string]string, manifest Manifest) error {
+	rel := aliasPath(u)
+	if err := config.writeGenerated(site, rel, site.stub(page), outputs); err != nil {
+		return err
+	}
+	if config.DryRun {
+		return nil
+	}
+	srcInfo, err := site.stat(page.Src)
+	if err != nil {
+		return err
+	}
+	manifest[rel], err = site.manifestEntry(page.Src, srcInfo, filepath.Join(site.DstRoot, filepath.FromSlash(rel)))
+	return err
+}
+
+// nginxRedirect returns the nginx location redirecting the alias at the URL
+// u to target, matching the URL of a directory with or without its slash.
+func nginxRedirect(u, target string) string {
+	if u != "/" && strings.HasSuffix(u, "/") {
+		return fmt.Sprintf("location ~ ^%s/?$ { return 301 %s; }", regexp.QuoteMeta(strings.TrimSuffix(u, "/")), target)
+	}
+	return fmt.Sprintf("location = %s { return 301 %s; }", u, target)
+}
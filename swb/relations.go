@@ -0,0 +1,151 @@
+package swb
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A PageRef refers to a page of the site, in the backlinks and the related
+// pages of the pages.
+type PageRef struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// srcLinkRe matches the links of the sources of the pages: the Markdown
+// inline links and reference definitions, and the HTML links.
+var srcLinkRe = regexp.MustCompile(`\]\(\s*<?([^)\s>]+)|(?m)^ {0,3}\[[^\]]+\]:[ \t]*<?([^\s>]+)|(?i)\bhref\s*=\s*["']?([^"'\s>]+)`)
+
+// srcLinks returns the URLs linked by the body of a page.
+func srcLinks(body []byte) []string {
+	var urls []string
+	for _, m := range srcLinkRe.FindAllSubmatch(body, -1) {
+		for _, g := range m[1:] {
+			if g != nil {
+				urls = append(urls, string(g))
+			}
+		}
+	}
+	return urls
+}
+
+// validateRelated checks the site's number of related pages, and sets its
+// default.
+func (site *Site) validateRelated() error {
+	if site.Related < 0 {
+		return fmt.Errorf("site %s: related: negative number %d", site.Name, site.Related)
+	}
+	if site.Related == 0 {
+		site.Related = 5
+	}
+	return nil
+}
+
+// setRelations sets the backlinks of the pages entries, from the links of
+// the sources of the other pages, and their related pages, sharing tags
+// with them.
+func (site *Site) setRelations(entries []IndexEntry) {
+	byPath := make(map[string]int)
+	for i, e := range entries {
+		byPath["/"+e.Rel] = i
+		byPath[e.URL] = i
+		byPath["/"+site.srcRel(e.Src)] = i
+	}
+	// find returns the page linked by rawURL from the page e, or -1.
+	find := func(e IndexEntry, rawURL string) int {
+		for _, rel := range []string{e.Rel, site.srcRel(e.Src)} {
+			p, ok := site.linkTarget(rel, rawURL)
+			if !ok {
+				continue
+			}
+			// The links may leave out the .html extension or the index of
+			// a directory, or not, with clean URLs.
+			dir := strings.TrimSuffix(strings.TrimSuffix(p, ".html"), "/")
+			for _, p := range []string{p, p + ".html", dir + "/index.html"} {
+				if i, ok := byPath[p]; ok {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	for i, e := range entries {
+		seen := map[int]bool{i: true}
+		for _, rawURL := range e.links {
+			j := find(e, rawURL)
+			if j < 0 || seen[j] {
+				continue
+			}
+			seen[j] = true
+			entries[j].Backlinks = append(entries[j].Backlinks, PageRef{Title: e.Title, URL: e.URL})
+		}
+	}
+	for i := range entries {
+		entries[i].Related = site.related(entries, i)
+	}
+}
+
+// related returns the pages sharing the most tags with the page i among
+// the pages entries, the most recent first among the ones sharing as many.
+func (site *Site) related(entries []IndexEntry, i int) []PageRef {
+	tags := make(map[string]bool)
+	for _, tag := range entries[i].Tags {
+		tags[slug(tag)] = true
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	type candidate struct {
+		e      IndexEntry
+		shared int
+	}
+	var candidates []candidate
+	for j, e := range entries {
+		shared := 0
+		seen := make(map[string]bool)
+		for _, tag := range e.Tags {
+			if s := slug(tag); tags[s] && !seen[s] {
+				seen[s] = true
+				shared++
+			}
+		}
+		if j != i && shared > 0 {
+			candidates = append(candidates, candidate{e, shared})
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].shared != candidates[b].shared {
+			return candidates[a].shared > candidates[b].shared
+		}
+		return candidates[a].e.Date > candidates[b].e.Date
+	})
+	var refs []PageRef
+	for _, c := range candidates[:min(len(candidates), site.Related)] {
+		refs = append(refs, PageRef{Title: c.e.Title, URL: c.e.URL})
+	}
+	return refs
+}
+
+// relationsEnv writes the backlinks and the related pages of the page at
+// srcPath to temporary files, and returns the variables of their paths,
+// and a function removing them.
+func (site *Site) relationsEnv(srcPath string) ([]string, func(), error) {
+	var backlinks, related []PageRef
+	if e := site.entry(srcPath); e != nil {
+		backlinks, related = e.Backlinks, e.Related
+	}
+	backlinksPath, err := writeTempJSON("swb-backlinks-*.json", nonNil(backlinks))
+	if err != nil {
+		return nil, nil, err
+	}
+	relatedPath, err := writeTempJSON("swb-related-*.json", nonNil(related))
+	if err != nil {
+		os.Remove(backlinksPath)
+		return nil, nil, err
+	}
+	env := []string{"page_backlinks=" + backlinksPath, "page_related=" + relatedPath}
+	return env, func() { os.Remove(backlinksPath); os.Remove(relatedPath) }, nil
+}
@@ -0,0 +1,152 @@
+package swb
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SelectSite leaves only the site called name in the configuration, unless
+// name is empty. The selection is kept by Reload.
+func (config *Config) SelectSite(name string) error {
+	if name == "" {
+		return nil
+	}
+	i := slices.IndexFunc(config.Sites, func(site *Site) bool { return site.Name == name })
+	if i < 0 {
+		return fmt.Errorf("no site named %s", name)
+	}
+	config.Sites = config.Sites[i : i+1]
+	config.siteName = name
+	return nil
+}
+
+// Reload loads the configuration again from its files, with the same
+// profile and selected site, and returns it with the options of config
+// (e.g. Drafts, Progress), and the changes of its sites (e.g. "site blog
+// added", "site www changed: env, tplPath"). The configuration is
+// validated: if it is not valid, config is left as it is.
+func (config *Config) Reload() (*Config, []string, error) {
+	if config.path == "" {
+		return nil, nil, fmt.Errorf("the configuration was not loaded from a file")
+	}
+	fresh, err := LoadProfile(config.path, config.profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.siteName != "" {
+		// The selected site may have been removed.
+		i := slices.IndexFunc(fresh.Sites, func(site *Site) bool { return site.Name == config.siteName })
+		if i < 0 {
+			fresh.Sites = nil
+		} else {
+			fresh.Sites = fresh.Sites[i : i+1]
+		}
+		fresh.siteName = config.siteName
+	}
+	fresh.Progress, fresh.Drafts, fresh.Future = config.Progress, config.Drafts, config.Future
+	fresh.DryRun, fresh.Wait, fresh.Force = config.DryRun, config.Wait, config.Force
+	fresh.ForceClean, fresh.Only, fresh.Metrics = config.ForceClean, config.Only, config.Metrics
+	return fresh, config.changes(fresh), nil
+}
+
+// changes returns the changes from config to fresh: the fields of the
+// configuration shared by the sites, and the sites added, removed or
+// changed, with their fields.
+func (config *Config) changes(fresh *Config) []string {
+	var changes []string
+	old, cur := *config, *fresh
+	old.Sites, cur.Sites = nil, nil
+	if fields := changedFields(old, cur); len(fields) > 0 {
+		changes = append(changes, "configuration changed: "+strings.Join(fields, ", "))
+	}
+	for _, site := range fresh.Sites {
+		i := slices.IndexFunc(config.Sites, func(s *Site) bool { return s.Name == site.Name })
+		if i < 0 {
+			changes = append(changes, fmt.Sprintf("site %s added", site.Name))
+		} else if fields := changedFields(config.Sites[i], site); len(fields) > 0 {
+			changes = append(changes, fmt.Sprintf("site %s changed: %s", site.Name, strings.Join(fields, ", ")))
+		}
+	}
+	for _, site := range config.Sites {
+		if !slices.ContainsFunc(fresh.Sites, func(s *Site) bool { return s.Name == site.Name }) {
+			changes = append(changes, fmt.Sprintf("site %s removed, its dst tree is left as it is", site.Name))
+		}
+	}
+	return changes
+}
+
+// changedFields returns the names of the fields of the configuration files
+// whose value differs between a and b, sorted.
+func changedFields(a, b any) []string {
+	ma, mb := jsonFields(a), jsonFields(b)
+	var fields []string
+	for name := range ma {
+		if !reflect.DeepEqual(ma[name], mb[name]) {
+			fields = append(fields, name)
+		}
+	}
+	for name := range mb {
+		if _, ok := ma[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// jsonFields returns the fields of v as written in a JSON configuration.
+func jsonFields(v any) map[string]any {
+	m := make(map[string]any)
+	if b, err := json.Marshal(v); err == nil {
+		json.Unmarshal(b, &m)
+	}
+	return m
+}
+
+// reloaded reports whether the site must be built after the reload of the
+// configuration into fresh: it is new or changed, or the fields shared by
+// the sites changed.
+func (config *Config) reloaded(fresh *Config, site *Site) bool {
+	old, cur := *config, *fresh
+	old.Sites, cur.Sites = nil, nil
+	if len(changedFields(old, cur)) > 0 {
+		return true
+	}
+	i := slices.IndexFunc(config.Sites, func(s *Site) bool { return s.Name == site.Name })
+	return i < 0 || len(changedFields(config.Sites[i], site)) > 0
+}
+
+// watchConfig adds the directories of the files of the configuration to w:
+// editors often replace a file rather than writing it.
+func (config *Config) watchConfig(w *fsnotify.Watcher) error {
+	for _, dir := range config.configDirs() {
+		if err := w.Add(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configDirs returns the directories of the files of the configuration.
+func (config *Config) configDirs() []string {
+	dirs := make(map[string]bool)
+	for _, path := range config.files {
+		dirs[filepath.Dir(path)] = true
+	}
+	return slices.Sorted(maps.Keys(dirs))
+}
+
+// isConfigFile reports whether the file at path is one of the files of the
+// configuration.
+func (config *Config) isConfigFile(path string) bool {
+	return slices.ContainsFunc(config.files, func(file string) bool {
+		return filepath.Clean(file) == filepath.Clean(path)
+	})
+}
@@ -0,0 +1,62 @@
+package swb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RenderPage renders the page at srcPath, a path of the src tree of the
+// site, through its template, and returns it as a build would write it
+// (before the postProcess filters), without writing anything to the dst
+// tree: e.g. to preview a page from an editor, or to test a template. If
+// src is not nil, it is the content of the page, in place of the one of the
+// file at srcPath, which need not exist (e.g. an unsaved buffer), and which
+// is by default a file named stdin at the root of the src tree, with the
+// extension of the builder.
+func (config *Config) RenderPage(ctx context.Context, site *Site, srcPath string, src []byte) ([]byte, error) {
+	if srcPath == "" {
+		srcPath = filepath.Join(site.SrcRoot, "stdin"+config.Builder.Ext)
+		if builders := config.builders(); len(builders) > 0 {
+			srcPath = filepath.Join(site.SrcRoot, "stdin"+builders[0].Ext)
+		}
+	}
+	rules := config.rules(site)
+	dstPath, r := site.output(rules, srcPath)
+	if r == nil || !r.page {
+		return nil, fmt.Errorf("%s is not a page of site %s", srcPath, site.Name)
+	}
+	site.templates = make(map[string]*parsedTpl)
+	defer func() { site.templates = nil }()
+	if err := site.validateTemplate(site.TplPath); err != nil {
+		return nil, phaseError(PhaseTemplate, site.TplPath, err)
+	}
+	// The page sees the others, and the assets, as a build does.
+	if err := site.fingerprintAssets(rules); err != nil {
+		return nil, phaseError(PhaseFingerprint, "", err)
+	}
+	if err := site.mapPermalinks(rules); err != nil {
+		return nil, phaseError(PhaseTidy, "", err)
+	}
+	site.commits = gitLog(site.SrcRoot)
+	defer func() { site.commits = nil }()
+	pages, err := site.pages(rules)
+	if err != nil {
+		return nil, phaseError(PhaseIndex, "", err)
+	}
+	index, err := writeIndex(pages)
+	if err != nil {
+		return nil, phaseError(PhaseIndex, "", err)
+	}
+	site.index = index
+	site.entries = pages
+	defer func() {
+		os.Remove(index)
+		site.index = ""
+		site.entries = nil
+	}()
+	config.pageSrc = src
+	defer func() { config.pageSrc = nil }()
+	return config.renderPage(ctx, site, srcPath, dstPath, nil)
+}
@@ -0,0 +1,102 @@
+package swb
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// A BuildReport is the summary of the builds of the sites, written by
+// WriteReport for CI jobs (e.g. to post it, or to compare it with the one
+// of a previous build).
+type BuildReport struct {
+	Version string       `json:"version"`
+	Sites   []SiteReport `json:"sites"`
+}
+
+// A SiteReport is the part of a BuildReport about a site.
+type SiteReport struct {
+	Name       string `json:"name"`
+	DurationMs int64  `json:"duration_ms"`
+	// Failed is set if the site failed, its Errors being the ones found.
+	Failed   bool          `json:"failed"`
+	Added    []string      `json:"added"`
+	Updated  []string      `json:"updated"`
+	Linked   []string      `json:"linked"`
+	Removed  []string      `json:"removed"`
+	Skipped  []string      `json:"skipped"`
+	Pages    []PageReport  `json:"pages"`
+	Commands []CommandRun  `json:"commands"`
+	Phases   []PhaseTime   `json:"phases"`
+	Warnings []string      `json:"warnings"`
+	Errors   []*BuildError `json:"errors"`
+}
+
+// A PageReport is the time a file of the dst tree took to build.
+type PageReport struct {
+	Path       string `json:"path"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// A CommandRun is a command run to build a site, and the time it took.
+type CommandRun struct {
+	Command    []string `json:"command"`
+	DurationMs int64    `json:"duration_ms"`
+	Page       string   `json:"page,omitempty"`
+	Block      string   `json:"block,omitempty"`
+	Stderr     string   `json:"stderr,omitempty"`
+}
+
+// NewBuildReport returns the report of the results of the sites.
+func NewBuildReport(results []SiteResult) BuildReport {
+	report := BuildReport{Version: Version, Sites: make([]SiteReport, 0, len(results))}
+	for _, res := range results {
+		r := res.Report
+		s := SiteReport{
+			Name:       res.Site.Name,
+			DurationMs: res.Duration.Milliseconds(),
+			Failed:     res.Err != nil,
+			Added:      make([]string, 0, len(r.Built)),
+			Updated:    nonNil(r.Rebuilt),
+			Linked:     nonNil(r.Linked),
+			Removed:    nonNil(r.Removed),
+			Skipped:    nonNil(r.Skipped),
+			Pages:      make([]PageReport, 0, len(r.Durations)),
+			Commands:   make([]CommandRun, 0, len(r.Commands)),
+			Phases:     phaseTimes(r.Phases),
+			Warnings:   nonNil(r.Warnings),
+			Errors:     nonNil(buildErrors(res.Err)),
+		}
+		for _, path := range r.Built {
+			if !slices.Contains(r.Rebuilt, path) {
+				s.Added = append(s.Added, path)
+			}
+			if d, ok := r.Durations[path]; ok {
+				s.Pages = append(s.Pages, PageReport{Path: path, DurationMs: d.Milliseconds()})
+			}
+		}
+		for _, cmd := range r.Commands {
+			s.Commands = append(s.Commands, CommandRun{Command: cmd.Argv, DurationMs: cmd.Duration.Milliseconds(), Page: cmd.Page, Block: cmd.Block, Stderr: cmd.Stderr})
+		}
+		report.Sites = append(report.Sites, s)
+	}
+	return report
+}
+
+// nonNil returns s, or an empty slice if it is nil, so that it is encoded
+// as an empty JSON array rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// WriteReport writes the report of the results of the sites to the file at
+// path, in JSON.
+func WriteReport(path string, results []SiteResult) error {
+	b, err := json.MarshalIndent(NewBuildReport(results), "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(b, '\n'), 0644)
+}
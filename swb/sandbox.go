@@ -0,0 +1,95 @@
+package swb
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// sandboxPromises are the pledge(2) promises of swb building and cleaning
+// the sites: reading and writing files, locking the dst trees, and running
+// the commands of the templates, the builders and the hooks.
+const sandboxPromises = "stdio rpath wpath cpath fattr flock proc exec"
+
+// An unveiled path is a path swb can reach once sandboxed, with the
+// permissions of unveil(2).
+type unveiled struct {
+	path  string
+	perms string
+}
+
+// sandboxPaths returns the paths swb needs to build and clean the sites:
+// the files of the configuration, the src trees and the directories of the
+// templates to read, the dst trees and the temporary directory to write,
+// and the programs to run. The missing dst trees are created, unless it is
+// a dry run. If network is set, the files needed to listen on the network
+// are added.
+func (config *Config) sandboxPaths(network bool) ([]unveiled, error) {
+	var paths []unveiled
+	for _, path := range config.files {
+		paths = append(paths, unveiled{path, "r"})
+	}
+	for _, site := range config.Sites {
+		paths = append(paths, unveiled{site.SrcRoot, "r"}, unveiled{filepath.Dir(site.TplPath), "r"})
+		if _, files, err := site.readTemplate(site.TplPath); err == nil {
+			for _, path := range files {
+				paths = append(paths, unveiled{filepath.Dir(path), "r"})
+			}
+		}
+		if site.Taxonomy != nil && site.Taxonomy.TplPath != "" {
+			paths = append(paths, unveiled{filepath.Dir(site.Taxonomy.TplPath), "r"})
+		}
+		if !config.DryRun {
+			if err := os.MkdirAll(site.DstRoot, site.dirMode()); err != nil {
+				return nil, err
+			}
+		}
+		paths = append(paths, unveiled{site.DstRoot, "rwc"})
+	}
+	for _, name := range config.sandboxPrograms() {
+		if path, err := exec.LookPath(name); err == nil {
+			paths = append(paths, unveiled{path, "rx"})
+		}
+	}
+	paths = append(paths,
+		unveiled{os.TempDir(), "rwc"},
+		unveiled{os.DevNull, "rw"},
+		// The local time zone is loaded on its first use.
+		unveiled{"/etc/localtime", "r"},
+		unveiled{"/usr/share/zoneinfo", "r"},
+	)
+	if network {
+		paths = append(paths, unveiled{"/etc/hosts", "r"}, unveiled{"/etc/resolv.conf", "r"})
+	}
+	return paths, nil
+}
+
+// sandboxPrograms returns the names of the programs swb runs itself to
+// build the sites: the ones of the toolchain (see programs), git, the
+// post-processing filters, and the transforms, the build hooks and the
+// allowed commands of the sites. The commands run by these programs, e.g.
+// by the template snippets, are not restricted by the sandbox.
+func (config *Config) sandboxPrograms() []string {
+	names := append(config.programs(), "git")
+	for _, filter := range config.PostProcess {
+		if len(filter) > 0 {
+			names = append(names, filter[0])
+		}
+	}
+	for _, site := range config.Sites {
+		for _, t := range site.Transforms {
+			names = append(names, t.Cmd[0])
+		}
+		if site.Hooks != nil {
+			for _, h := range append(slices.Clip(site.Hooks.PreBuild), site.Hooks.PostBuild...) {
+				if len(h.Cmd) > 0 {
+					names = append(names, h.Cmd[0])
+				}
+			}
+		}
+		names = append(names, site.AllowedCommands...)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
@@ -0,0 +1,42 @@
+//go:build openbsd
+
+package swb
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Sandbox restricts swb to building and cleaning the sites of the
+// configuration: it unveils (see unveil(2)) the paths it needs (see
+// sandboxPaths) and pledges (see pledge(2)) the promises it needs, and the
+// network ones if network is set (e.g. to serve a site). The configuration
+// must not be reloaded afterwards, since the paths of the new sites would
+// be out of reach.
+func (config *Config) Sandbox(network bool) error {
+	paths, err := config.sandboxPaths(network)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		// The missing optional files (e.g. /etc/localtime) are left out.
+		if err := unix.Unveil(p.path, p.perms); err != nil && !errors.Is(err, unix.ENOENT) {
+			return fmt.Errorf("unveil %s: %w", p.path, err)
+		}
+	}
+	if err := unix.UnveilBlock(); err != nil {
+		return fmt.Errorf("unveil: %w", err)
+	}
+	promises := sandboxPromises
+	if network {
+		promises += " inet dns"
+	}
+	// The programs run are not pledged, their execpromises being left
+	// unset.
+	if err := unix.PledgePromises(promises); err != nil {
+		return fmt.Errorf("pledge: %w", err)
+	}
+	return nil
+}
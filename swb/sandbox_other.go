@@ -0,0 +1,8 @@
+//go:build !openbsd
+
+package swb
+
+// Sandbox does nothing, swb is only sandboxed on OpenBSD.
+func (config *Config) Sandbox(network bool) error {
+	return nil
+}
@@ -0,0 +1,143 @@
+package swb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Search is the search index of a site: a JSON file listing its pages
+// with their text, loaded by client-side search libraries (e.g. lunr or
+// Fuse.js).
+type Search struct {
+	// Path of the index relative to the root of the dst tree, search.json
+	// by default.
+	Path string `json:"path,omitempty" toml:"path,omitempty" yaml:"path,omitempty"`
+	// Section restricts the index to the pages under this dst directory.
+	Section string `json:"section,omitempty" toml:"section,omitempty" yaml:"section,omitempty"`
+	// Maximum length of the excerpts of the pages, in characters, 300 by
+	// default.
+	Excerpt int `json:"excerpt,omitempty" toml:"excerpt,omitempty" yaml:"excerpt,omitempty"`
+}
+
+// validateSearch checks the site's search index, and sets its defaults.
+func (site *Site) validateSearch() error {
+	search := site.Search
+	if search == nil {
+		return nil
+	}
+	if search.Path == "" {
+		search.Path = "search.json"
+	}
+	search.Path = path.Clean(filepath.ToSlash(search.Path))
+	if path.IsAbs(search.Path) || search.Path == ".." || strings.HasPrefix(search.Path, "../") {
+		return fmt.Errorf("site %s: search: path %s is not in the dst tree", site.Name, search.Path)
+	}
+	search.Section = strings.Trim(path.Clean("/"+filepath.ToSlash(search.Section)), "/")
+	if search.Excerpt < 0 {
+		return fmt.Errorf("site %s: search: negative excerpt %d", site.Name, search.Excerpt)
+	}
+	if search.Excerpt == 0 {
+		search.Excerpt = 300
+	}
+	return nil
+}
+
+// A searchEntry is a page of a search index.
+type searchEntry struct {
+	Title    string   `json:"title"`
+	URL      string   `json:"url"`
+	Lang     string   `json:"lang,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Headings []string `json:"headings"`
+	Excerpt  string   `json:"excerpt"`
+}
+
+var (
+	// searchSkipRe matches the elements of the pages whose text is not
+	// indexed: the scripts and styles, and the parts the template repeats
+	// on every page.
+	searchSkipRe    = regexp.MustCompile(`(?is)<!--.*?-->|<script\b.*?</script>|<style\b.*?</style>|<nav\b.*?</nav>|<header\b.*?</header>|<footer\b.*?</footer>`)
+	searchHeadingRe = regexp.MustCompile(`(?is)<h[1-6]\b[^>]*>(.*?)</h[1-6]>`)
+	searchTitleRe   = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title>`)
+)
+
+// plainText returns the text of the HTML fragment s, with its blanks
+// collapsed.
+func plainText(s string) string {
+	s = mdAnyTagRe.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// excerpt returns the first n characters of text, cut at a word boundary.
+func excerpt(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	cut := []rune(text)[:n]
+	if i := strings.LastIndexByte(string(cut), ' '); i > 0 {
+		return string(cut)[:i] + "…"
+	}
+	return string(cut) + "…"
+}
+
+// searchEntry returns the entry of the built HTML page b in the search
+// index.
+func (site *Site) searchEntry(page IndexEntry, b []byte) searchEntry {
+	s := string(b)
+	title := page.Title
+	if m := searchTitleRe.FindStringSubmatch(s); m != nil && title == "" {
+		title = plainText(m[1])
+	}
+	if _, body, ok := strings.Cut(s, "<body"); ok {
+		_, s, _ = strings.Cut(body, ">")
+	}
+	s = searchSkipRe.ReplaceAllString(s, " ")
+	entry := searchEntry{Title: title, URL: page.URL, Lang: page.Lang, Tags: page.Tags, Headings: []string{}}
+	for _, m := range searchHeadingRe.FindAllStringSubmatch(s, -1) {
+		if h := plainText(m[1]); h != "" {
+			entry.Headings = append(entry.Headings, h)
+		}
+	}
+	entry.Excerpt = excerpt(plainText(s), site.Search.Excerpt)
+	return entry
+}
+
+// writeSearchIndex writes the search index of the site, if it has one, from
+// the built HTML pages of its section.
+func (config *Config) writeSearchIndex(site *Site, pages []IndexEntry, outputs map[string]string) error {
+	search := site.Search
+	if search == nil {
+		return nil
+	}
+	entries := []searchEntry{}
+	for _, page := range pages {
+		if path.Ext(page.Rel) != ".html" {
+			continue
+		}
+		if search.Section != "" && !strings.HasPrefix(page.Rel, search.Section+"/") {
+			continue
+		}
+		b, err := site.readFile(page.Dst)
+		if errors.Is(err, fs.ErrNotExist) && config.DryRun {
+			// The page has not been built.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		entries = append(entries, site.searchEntry(page, b))
+	}
+	b, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	return config.writeGenerated(site, search.Path, append(b, '\n'), outputs)
+}
@@ -0,0 +1,144 @@
+package swb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadPath is the path of the server-sent events endpoint notifying the
+// pages served by Serve that the site has been rebuilt.
+const reloadPath = "/_swb/reload"
+
+// reloadScript is injected in the HTML pages served by Serve, to reload
+// them whenever the site is rebuilt.
+var reloadScript = []byte(`<script>new EventSource("` + reloadPath + `").onmessage = function() { location.reload(); };</script>`)
+
+// Serve serves the dst tree of the site over HTTP at addr, rebuilding it
+// whenever its sources change (see Watch) and reloading the pages opened in
+// a browser after each successful build, until ctx is done.
+func (config *Config) Serve(ctx context.Context, site *Site, addr string, built func(site *Site, report Report, err error)) error {
+	r := &reloader{clients: make(map[chan struct{}]bool)}
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, r)
+	fsys := fs.FS(site.Dst)
+	if site.Dst == nil {
+		fsys = os.DirFS(site.DstRoot)
+	}
+	mux.Handle("/", &pageServer{fsys: fsys})
+	srv := &http.Server{Addr: addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	// The site alone is watched.
+	watched := *config
+	watched.Sites = []*Site{site}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		errc <- watched.Watch(ctx, func(site *Site, report Report, err error) {
+			built(site, report, err)
+			if err == nil {
+				r.reload()
+			}
+		}, nil)
+	}()
+	err := <-errc
+	// The reload connections never end by themselves, so the server is
+	// closed rather than shut down.
+	srv.Close()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// A pageServer serves the files of fsys, injecting the reload script in the
+// HTML pages.
+type pageServer struct {
+	fsys fs.FS
+}
+
+func (s *pageServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(s.fsys, name)
+	if err == nil && info.IsDir() {
+		name = path.Join(name, "index.html")
+		info, err = fs.Stat(s.fsys, name)
+	}
+	if err != nil || path.Ext(name) != ".html" {
+		http.FileServerFS(s.fsys).ServeHTTP(w, req)
+		return
+	}
+	b, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if i := bytes.LastIndex(bytes.ToLower(b), []byte("</body>")); i >= 0 {
+		b = append(b[:i:i], append(reloadScript, b[i:]...)...)
+	} else {
+		b = append(b, reloadScript...)
+	}
+	http.ServeContent(w, req, name, info.ModTime(), bytes.NewReader(b))
+}
+
+// A reloader notifies its clients, as server-sent events, that the site
+// has been rebuilt.
+type reloader struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.clients[c] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, c)
+		r.mu.Unlock()
+	}()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-c:
+			fmt.Fprintf(w, "data: reload %d\n\n", time.Now().UnixMilli())
+			flusher.Flush()
+		}
+	}
+}
+
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+			// A reload is already pending.
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package swb
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// SitemapFile is the sitemap written at the root of the dst tree of the
+	// sites with sitemap set.
+	SitemapFile = "sitemap.xml"
+	// RobotsFile is the robots.txt written at the root of the dst tree of
+	// the sites with robots set, referencing their sitemap.
+	RobotsFile = "robots.txt"
+)
+
+// validateSitemap checks that the site has a base URL if it needs one for
+// its sitemap.
+func (site *Site) validateSitemap() error {
+	site.BaseURL = strings.TrimSuffix(site.BaseURL, "/")
+	if site.Robots && !site.Sitemap {
+		return fmt.Errorf("site %s: robots requires sitemap", site.Name)
+	}
+	if site.Sitemap && site.BaseURL == "" {
+		return fmt.Errorf("site %s: sitemap requires baseURL", site.Name)
+	}
+	return nil
+}
+
+// xhtmlNS is the namespace of the links to the translations of the pages
+// in the sitemaps.
+const xhtmlNS = "http://www.w3.org/1999/xhtml"
+
+type sitemapLink struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+type sitemapURL struct {
+	Loc     string        `xml:"loc"`
+	LastMod string        `xml:"lastmod"`
+	Links   []sitemapLink `xml:"xhtml:link"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	XHTML   string       `xml:"xmlns:xhtml,attr,omitempty"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// writeSitemap writes the sitemap of the site, if it has one, listing its
+// HTML pages with the date of the last commit of their source, or else its
+// modification time, and the versions of the translated ones in the other
+// languages, and its robots.txt.
+func (config *Config) writeSitemap(site *Site, pages []IndexEntry, outputs map[string]string) error {
+	if !site.Sitemap {
+		return nil
+	}
+	var set sitemapURLSet
+	for _, page := range pages {
+		if path.Ext(page.Rel) != ".html" {
+			continue
+		}
+		lastMod := page.Mtime.Format(time.RFC3339)
+		if page.Git != nil {
+			lastMod = page.Git.Date
+		}
+		u := sitemapURL{Loc: site.BaseURL + page.URL, LastMod: lastMod}
+		for _, alt := range page.Alternates {
+			u.Links = append(u.Links, sitemapLink{Rel: "alternate", Hreflang: alt.Lang, Href: site.BaseURL + alt.URL})
+		}
+		if len(u.Links) > 0 {
+			set.XHTML = xhtmlNS
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	b, err := xml.MarshalIndent(set, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = config.writeGenerated(site, SitemapFile, append([]byte(xml.Header), append(b, '\n')...), outputs)
+	if err != nil || !site.Robots {
+		return err
+	}
+	robots := "User-agent: *\nAllow: /\n\nSitemap: " + site.BaseURL + "/" + SitemapFile + "\n"
+	return config.writeGenerated(site, RobotsFile, []byte(robots), outputs)
+}
@@ -0,0 +1,213 @@
+package swb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A Snapshot records the shape of the trees of a site (but not the content
+// of their files) and its sanitized configuration, so that the decisions of
+// swb on these trees can be replayed elsewhere.
+type Snapshot struct {
+	Config   Config          `json:"config"`
+	Template SnapshotEntry   `json:"template"`
+	Src      []SnapshotEntry `json:"src"`
+	Dst      []SnapshotEntry `json:"dst"`
+}
+
+// A SnapshotEntry records a file of a tree, by its slash separated path
+// relative to the root of the tree.
+type SnapshotEntry struct {
+	Path string `json:"path"`
+	// Either "dir", "file" or "symlink".
+	Type   string    `json:"type"`
+	Size   int64     `json:"size,omitempty"`
+	Mtime  time.Time `json:"mtime"`
+	Target string    `json:"target,omitempty"`
+	// The files having the same inode number, in both trees, are hard
+	// links to the same file.
+	Inode int `json:"inode,omitempty"`
+}
+
+// Snapshot records the shape of the trees of the site. Its configuration
+// is sanitized: the environment and the commands of the site are dropped.
+func (config *Config) Snapshot(site *Site) (*Snapshot, error) {
+	sanitized := &Site{
+		Name:          site.Name,
+		Keep:          site.Keep,
+		Symlinks:      site.Symlinks,
+		Delimiters:    site.Delimiters,
+		PageChecks:    site.PageChecks,
+		Fingerprint:   site.Fingerprint,
+		PreserveTimes: site.PreserveTimes,
+	}
+	for _, t := range site.Transforms {
+		sanitized.Transforms = append(sanitized.Transforms, Transform{Ext: t.Ext, OutExt: t.OutExt})
+	}
+	snap := &Snapshot{Config: Config{
+		Sites:   []*Site{sanitized},
+		Builder: Builder{Ext: config.Builder.Ext, OutExt: config.Builder.OutExt},
+	}}
+	for _, b := range config.Builders {
+		snap.Config.Builders = append(snap.Config.Builders, Builder{Ext: b.Ext, OutExt: b.OutExt})
+	}
+	for ext := range config.PostProcess {
+		if snap.Config.PostProcess == nil {
+			snap.Config.PostProcess = make(map[string][]string)
+		}
+		// The files are still copied rather than linked.
+		snap.Config.PostProcess[ext] = []string{"cat"}
+	}
+	info, err := os.Stat(site.TplPath)
+	if err != nil {
+		return nil, err
+	}
+	snap.Template = SnapshotEntry{Path: filepath.Base(site.TplPath), Type: "file", Size: info.Size(), Mtime: info.ModTime()}
+	inodes := make(map[[2]uint64]int)
+	if snap.Src, err = snapshotTree(site.SrcRoot, inodes); err != nil {
+		return nil, err
+	}
+	if snap.Dst, err = snapshotTree(site.DstRoot, inodes); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// snapshotTree records the entries of the tree at root, numbering their
+// inodes in inodes.
+func snapshotTree(root string, inodes map[[2]uint64]int) ([]SnapshotEntry, error) {
+	var entries []SnapshotEntry
+	err := filepath.WalkDir(root, func(path string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		info, err := ent.Info()
+		if err != nil {
+			return err
+		}
+		e := SnapshotEntry{
+			Path:  filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator))),
+			Mtime: info.ModTime(),
+		}
+		switch {
+		case info.IsDir():
+			e.Type = "dir"
+		case info.Mode()&fs.ModeSymlink != 0:
+			e.Type = "symlink"
+			if e.Target, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			e.Type = "file"
+			e.Size = info.Size()
+			// The hard links to the same file are only recorded where
+			// the files can be identified.
+			if key, ok := fileID(info); ok {
+				if _, ok := inodes[key]; !ok {
+					inodes[key] = len(inodes) + 1
+				}
+				e.Inode = inodes[key]
+			}
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// Replay reconstructs the trees of the snapshot in dir, with files of the
+// recorded sizes filled with zeros, and a template without any block. It
+// returns the path of the configuration of the reconstructed site, in which
+// the transforms copy their source.
+func (snap *Snapshot) Replay(dir string) (string, error) {
+	if len(snap.Config.Sites) != 1 {
+		return "", fmt.Errorf("the snapshot holds %d sites, want 1", len(snap.Config.Sites))
+	}
+	config := snap.Config
+	site := *config.Sites[0]
+	site.SrcRoot = filepath.Join(dir, "src")
+	site.DstRoot = filepath.Join(dir, "dst")
+	site.TplPath = filepath.Join(dir, "template.tpl")
+	site.Transforms = slices.Clone(site.Transforms)
+	for i := range site.Transforms {
+		site.Transforms[i].Cmd = []string{"cp", "$src_path", "$dst_path"}
+	}
+	config.Sites = []*Site{&site}
+	config.RunCmd = []string{"sh", "-c"}
+	if err := os.WriteFile(site.TplPath, []byte("<html></html>\n"), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Chtimes(site.TplPath, snap.Template.Mtime, snap.Template.Mtime); err != nil {
+		return "", err
+	}
+	inodes := make(map[int]string)
+	if err := replayTree(site.SrcRoot, snap.Src, inodes); err != nil {
+		return "", err
+	}
+	if len(snap.Dst) > 0 {
+		if err := replayTree(site.DstRoot, snap.Dst, inodes); err != nil {
+			return "", err
+		}
+	}
+	b, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	configPath := filepath.Join(dir, "config.json")
+	return configPath, os.WriteFile(configPath, append(b, '\n'), 0644)
+}
+
+// replayTree reconstructs the entries of a tree at root, linking the files
+// whose inode is already in inodes.
+func replayTree(root string, entries []SnapshotEntry, inodes map[int]string) error {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(root, filepath.FromSlash(e.Path))
+		switch e.Type {
+		case "dir":
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case "symlink":
+			if err := os.Symlink(e.Target, path); err != nil {
+				return err
+			}
+		case "file":
+			if target, ok := inodes[e.Inode]; ok && e.Inode != 0 {
+				if err := os.Link(target, path); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := os.WriteFile(path, make([]byte, e.Size), 0644); err != nil {
+				return err
+			}
+			inodes[e.Inode] = path
+		default:
+			return fmt.Errorf("%s: unknown type %q", e.Path, e.Type)
+		}
+	}
+	// The times are set once every entry exists, deepest first, so that
+	// creating an entry does not change the time of its directory.
+	for _, e := range slices.Backward(entries) {
+		if e.Type == "symlink" {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(e.Path))
+		if err := os.Chtimes(path, e.Mtime, e.Mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
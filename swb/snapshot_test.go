@@ -0,0 +1,90 @@
+package swb
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// TestReplay replays the snapshots of testdata/replay, and checks the
+// decisions of a build of their trees against the golden files next to
+// them (written by go test -update).
+func TestReplay(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "replay", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var snap Snapshot
+			if err := json.Unmarshal(b, &snap); err != nil {
+				t.Fatal(err)
+			}
+			configPath, err := snap.Replay(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			site := config.Sites[0]
+			report, err := config.BuildSite(context.Background(), site)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := decisions(t, site, report)
+			golden := strings.TrimSuffix(path, ".json") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("decisions:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// decisions returns the decisions of the report, one per line as the
+// symbol of the logger and a path relative to the dst tree, by kind.
+func decisions(t *testing.T, site *Site, report Report) string {
+	var b strings.Builder
+	for _, kind := range []struct {
+		symbol string
+		paths  []string
+	}{
+		{"-", report.Removed},
+		{"^", report.Rebuilt},
+		{"+", slices.Concat(slices.DeleteFunc(slices.Clone(report.Built), func(path string) bool {
+			return slices.Contains(report.Rebuilt, path)
+		}), report.Linked)},
+	} {
+		for _, path := range slices.Sorted(slices.Values(kind.paths)) {
+			rel, err := filepath.Rel(site.DstRoot, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintf(&b, "%s %s\n", kind.symbol, filepath.ToSlash(rel))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,332 @@
+package swb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// StateFile is the name of the file recording, at the root of every dst
+// tree, the state of the src and dst trees after the last build.
+const StateFile = ".swb-state.json"
+
+// A state holds stamps of the src and dst trees. The stamps only depend on
+// the metadata of the files (not their content), so they are cheap to
+// compute, and a site whose stamps did not change since its last build does
+// not need to be tidied nor built again.
+type state struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+	// Hash of the content of the template the pages were built with, with
+	// its includes inlined.
+	Template string `json:"template,omitempty"`
+	// Stamp of the programs the pages were built with, and of their
+	// configuration.
+	Toolchain string `json:"toolchain,omitempty"`
+	// Date of the next page to be published, skipped by the build because
+	// it is dated in the future.
+	Publish time.Time `json:"publish,omitzero"`
+	// Quick stamp of the site, and the directories of its src tree it
+	// stamps, with Config.QuickCheck (see quickStamp).
+	Quick string   `json:"quick,omitempty"`
+	Dirs  []string `json:"dirs,omitempty"`
+}
+
+// srcStamp stamps the configuration, the templates and the src tree of the
+// site.
+func (config *Config) srcStamp(site *Site) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, config.hash)
+	fmt.Fprintln(h, site.toolchain)
+	if config.Drafts {
+		fmt.Fprintln(h, "drafts")
+	}
+	if config.Future {
+		fmt.Fprintln(h, "future")
+	}
+	tplInfo, err := site.stat(site.TplPath)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(h, stampLine(site.TplPath, tplInfo))
+	// The pages can use the other templates of the same directory, and the
+	// directory templates of the src tree, with the files they include.
+	stamped := make(map[string]bool)
+	tplEnts, err := site.readDir(filepath.Dir(site.TplPath))
+	if err != nil {
+		return "", err
+	}
+	for _, ent := range tplEnts {
+		if !ent.IsDir() {
+			site.stampTemplate(h, filepath.Join(filepath.Dir(site.TplPath), ent.Name()), stamped)
+		}
+	}
+	if site.Taxonomy != nil {
+		site.stampTemplate(h, site.Taxonomy.TplPath, stamped)
+	}
+	// The ignore file is ignored by the walk.
+	if info, err := site.stat(filepath.Join(site.SrcRoot, IgnoreFile)); err == nil {
+		fmt.Fprintln(h, stampLine(IgnoreFile, info))
+	}
+	err = site.walkSrc(func(path string, info fs.FileInfo) error {
+		fmt.Fprintln(h, stampLine(strings.TrimPrefix(path, site.SrcRoot), info))
+		if isDirTemplate(path) {
+			site.stampTemplate(h, path, stamped)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stampTemplate stamps the files included by the template at tplPath, and
+// the template itself, unless they are in stamped. A file that cannot be
+// read is left out: the build reports it.
+func (site *Site) stampTemplate(w io.Writer, tplPath string, stamped map[string]bool) {
+	_, files, _ := site.readTemplate(tplPath)
+	for _, path := range files {
+		if stamped[path] {
+			continue
+		}
+		stamped[path] = true
+		if info, err := site.stat(path); err == nil {
+			fmt.Fprintln(w, stampLine(path, info))
+		}
+	}
+}
+
+// dstStamp stamps the dst tree of the site, except for the kept and
+// generated files.
+func dstStamp(site *Site) (string, error) {
+	h := sha256.New()
+	err := site.walkDst(func(path string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(path, site.DstRoot)
+		if path != site.DstRoot && site.kept(strings.TrimPrefix(rel, string(filepath.Separator))) {
+			if ent.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := ent.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(h, stampLine(rel, info))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stampLine stamps a file. The modification time of the directories changes
+// whenever an entry (e.g. the state file itself) is added to them, it is
+// left out of the stamp.
+func stampLine(name string, info fs.FileInfo) string {
+	if info.IsDir() {
+		return fmt.Sprintf("%s %v", filepath.ToSlash(name), info.Mode())
+	}
+	return fmt.Sprintf("%s %v %d %d", filepath.ToSlash(name), info.Mode(), info.Size(), info.ModTime().UnixNano())
+}
+
+// readState reads the state of the site recorded by its last build.
+func (site *Site) readState() (state, error) {
+	var st state
+	b, err := site.readFile(filepath.Join(site.DstRoot, StateFile))
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(b, &st)
+	return st, err
+}
+
+// upToDate reports whether the site has not changed since its last build,
+// srcStamp being the current stamp of its src tree, and has no page to be
+// published since.
+func (site *Site) upToDate(srcStamp string) bool {
+	st, err := site.readState()
+	if err != nil || st.Src != srcStamp {
+		return false
+	}
+	if !st.Publish.IsZero() && !now().Before(st.Publish) {
+		return false
+	}
+	dst, err := dstStamp(site)
+	return err == nil && dst == st.Dst
+}
+
+// quickStamp stamps the configuration and the templates of the site, the
+// directories dirs of its src tree (all of them if nil), relative to its
+// root, and the manifest of its last build, without walking its trees: the
+// modification time of a directory changes when an entry is added to it,
+// removed from it or renamed, not when a file is modified in place. It
+// returns the directories stamped.
+func (config *Config) quickStamp(site *Site, dirs []string) (string, []string, error) {
+	if dirs == nil {
+		dirs = []string{"."}
+		err := site.walkSrc(func(path string, info fs.FileInfo) error {
+			if info.IsDir() {
+				dirs = append(dirs, filepath.ToSlash(strings.TrimPrefix(path, site.SrcRoot+string(filepath.Separator))))
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	h := sha256.New()
+	fmt.Fprintln(h, config.hash)
+	fmt.Fprintln(h, site.toolchain)
+	fmt.Fprintln(h, config.Drafts, config.Future)
+	stamped := make(map[string]bool)
+	tplEnts, err := site.readDir(filepath.Dir(site.TplPath))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, ent := range tplEnts {
+		if !ent.IsDir() {
+			site.stampTemplate(h, filepath.Join(filepath.Dir(site.TplPath), ent.Name()), stamped)
+		}
+	}
+	if site.Taxonomy != nil {
+		site.stampTemplate(h, site.Taxonomy.TplPath, stamped)
+	}
+	for _, dir := range dirs {
+		info, err := site.stat(filepath.Join(site.SrcRoot, filepath.FromSlash(dir)))
+		if err != nil {
+			return "", nil, err
+		}
+		fmt.Fprintf(h, "%s %d\n", dir, info.ModTime().UnixNano())
+	}
+	manifest, err := site.readFile(filepath.Join(site.DstRoot, ManifestFile))
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(manifest)
+	fmt.Fprintln(h, hex.EncodeToString(sum[:]))
+	return hex.EncodeToString(h.Sum(nil)), dirs, nil
+}
+
+// quickUpToDate reports whether the quick stamp of the site did not change
+// since its last build, with Config.QuickCheck, and it has no page to be
+// published since.
+func (config *Config) quickUpToDate(site *Site) bool {
+	st, err := site.readState()
+	if err != nil || st.Quick == "" {
+		return false
+	}
+	if !st.Publish.IsZero() && !now().Before(st.Publish) {
+		return false
+	}
+	quick, _, err := config.quickStamp(site, st.Dirs)
+	return err == nil && quick == st.Quick
+}
+
+// trackTemplate makes the pages depend on the content of the template
+// rather than on its modification time, when the state of the last build
+// records it: all the pages are rebuilt if the template changed, even if
+// it is older than them (e.g. restored from a backup), and none is if it
+// has only been touched.
+func (site *Site) trackTemplate(rules []*rule) error {
+	t, err := site.loadTemplate(site.TplPath)
+	if err != nil {
+		return err
+	}
+	files := t.files
+	sum := sha256.Sum256([]byte(t.text))
+	hash := "sha256:" + hex.EncodeToString(sum[:])
+	site.tplHash = hash
+	st, err := site.readState()
+	if err != nil || st.Template == "" {
+		return nil
+	}
+	for _, r := range rules {
+		if !r.page {
+			continue
+		}
+		r.deps = slices.DeleteFunc(r.deps, func(dep string) bool { return slices.Contains(files, dep) })
+		if st.Template != hash {
+			r.force = true
+		}
+	}
+	return nil
+}
+
+// stampToolchain stamps the programs building the pages of the site (the
+// run command and the builders, with their arguments, and the binaries
+// they resolve to), the environment of the site and its highlighting, so
+// that the pages are rebuilt when one of them changes (e.g. the builder is
+// upgraded). Like the trees, the binaries are stamped by their metadata.
+func (config *Config) stampToolchain(site *Site) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n", config.RunCmd)
+	for _, b := range config.builders() {
+		fmt.Fprintf(h, "%q %q %q %v\n", b.Ext, b.Bin, b.OutExt, b.Stdin)
+	}
+	fmt.Fprintf(h, "%q\n", site.Env)
+	if hl := site.Highlight; hl != nil {
+		fmt.Fprintf(h, "highlight %q %q\n", hl.Style, hl.CSS)
+	}
+	for _, name := range config.programs() {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			fmt.Fprintln(h, name)
+			continue
+		}
+		if path, err = filepath.Abs(path); err == nil {
+			if info, err := os.Stat(path); err == nil {
+				fmt.Fprintln(h, stampLine(path, info))
+			}
+		}
+	}
+	site.toolchain = hex.EncodeToString(h.Sum(nil))
+}
+
+// trackToolchain makes every page stale if the toolchain of the site
+// changed since its last build.
+func (site *Site) trackToolchain(rules []*rule) {
+	st, err := site.readState()
+	if err != nil || st.Toolchain == "" || st.Toolchain == site.toolchain {
+		return
+	}
+	for _, r := range rules {
+		if r.page {
+			r.force = true
+		}
+	}
+}
+
+// writeState records the state of the site after a build, srcStamp being
+// the stamp of its src tree, and its quick stamp with Config.QuickCheck.
+func (config *Config) writeState(site *Site, srcStamp string) error {
+	dst, err := dstStamp(site)
+	if err != nil {
+		return err
+	}
+	st := state{Src: srcStamp, Dst: dst, Template: site.tplHash, Toolchain: site.toolchain, Publish: site.publish}
+	if config.QuickCheck {
+		if st.Quick, st.Dirs, err = config.quickStamp(site, nil); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return site.writeFile(filepath.Join(site.DstRoot, StateFile), append(b, '\n'), site.newFileMode())
+}
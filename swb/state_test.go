@@ -0,0 +1,85 @@
+package swb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// BenchmarkUpToDate measures a build of hundreds of sites which did not
+// change since their last build, with and without the quick check.
+func BenchmarkUpToDate(b *testing.B) {
+	for _, quick := range []bool{false, true} {
+		b.Run(fmt.Sprintf("quick=%v", quick), func(b *testing.B) {
+			config := tinySites(b, 400, quick)
+			ctx := context.Background()
+			if _, err := config.Build(ctx, nil); err != nil {
+				b.Fatal(err)
+			}
+			for b.Loop() {
+				results, err := config.Build(ctx, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, res := range results {
+					if len(res.Report.Built)+len(res.Report.Linked)+len(res.Report.Removed) > 0 {
+						b.Fatalf("site %s is not up to date: %+v", res.Site.Name, res.Report)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestQuickCheck checks that the quick check skips a site whose
+// directories did not change, without walking its src tree (a file
+// modified in place is missed), and builds it again when a file is added.
+func TestQuickCheck(t *testing.T) {
+	config := tinySites(t, 1, true)
+	site := config.Sites[0]
+	ctx := context.Background()
+	if _, err := config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, site.SrcRoot, map[string]string{"index.md": "# Home page\n"})
+	report, err := config.BuildSite(ctx, site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Built) > 0 {
+		t.Errorf("up to date site built again: %v", report.Built)
+	}
+	// The added file fails the quick check, the full one finds the modified
+	// file too.
+	writeFiles(t, site.SrcRoot, map[string]string{"about/team.md": "# Team\n"})
+	if report, err = config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(site.DstRoot, "about", "team.html"), filepath.Join(site.DstRoot, "index.html")}
+	if !slices.Equal(report.Built, want) {
+		t.Errorf("built %v, want %v", report.Built, want)
+	}
+}
+
+// TestQuickCheckClean checks that a site cleaned since its last build is
+// built again with the quick check.
+func TestQuickCheckClean(t *testing.T) {
+	config := tinySites(t, 1, true)
+	site := config.Sites[0]
+	ctx := context.Background()
+	if _, err := config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.CleanSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(site.DstRoot, "index.html")); err != nil {
+		t.Errorf("cleaned site not built again: %v", err)
+	}
+}
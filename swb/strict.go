@@ -0,0 +1,175 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// TemplateStrict is the template mode in which template blocks cannot use
+// any shell feature: every block is a plain argv introduced by "exec:", run
+// without RunCmd, and only the site's allowed commands can be invoked.
+const TemplateStrict = "strict"
+
+// The shell features rejected in strict templates: the substitutions
+// anywhere, and the operators in the arguments which are not URLs (whose
+// queries hold & and ; characters).
+var (
+	strictSubstitutions = []string{"`", "$("}
+	strictOperators     = []string{";", "|", ">", "<", "&"}
+)
+
+// strictToken returns the shell feature used by the argument word of a
+// strict block, if any.
+func strictToken(word string) string {
+	for _, token := range strictSubstitutions {
+		if strings.Contains(word, token) {
+			return token
+		}
+	}
+	if u, err := url.Parse(word); err == nil && u.Scheme != "" && u.Host != "" {
+		return ""
+	}
+	for _, token := range strictOperators {
+		if strings.Contains(word, token) {
+			return token
+		}
+	}
+	return ""
+}
+
+// validateStrict checks the mode of the site's template and, if it is
+// strict, the blocks of its templates and of the files they include, with
+// the rest of the configuration, so that they are reported before any
+// site is built. A missing template is reported by the build.
+func (site *Site) validateStrict() error {
+	if site.TemplateMode == "" {
+		return nil
+	}
+	if site.TemplateMode != TemplateStrict {
+		return fmt.Errorf("site %s: templateMode: %q is not a template mode (%s)", site.Name, site.TemplateMode, TemplateStrict)
+	}
+	if site.Engine == EngineGo {
+		return nil
+	}
+	tplPaths := []string{site.TplPath}
+	if site.Taxonomy != nil {
+		tplPaths = append(tplPaths, site.Taxonomy.TplPath)
+	}
+	var errs []error
+	for _, tplPath := range tplPaths {
+		_, files, err := site.readTemplate(tplPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = site.validateFiles(files)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("site %s: %w", site.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateTemplate checks the template at tplPath by loading it: for a
+// strict site, the blocks of the template and of the files it includes are
+// statically checked, reporting every offending line. With the Go engine,
+// the template is parsed instead.
+func (site *Site) validateTemplate(tplPath string) error {
+	_, err := site.loadTemplate(tplPath)
+	return err
+}
+
+// validateFiles checks the blocks of the files a template is made of, for
+// a strict site.
+func (site *Site) validateFiles(files []string) error {
+	var errs []error
+	for _, path := range files {
+		b, err := site.readFile(path)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, site.validateBlocks(path, string(b)))
+	}
+	return errors.Join(errs...)
+}
+
+// validateBlocks checks the blocks of the template file at tplPath, whose
+// content is tpl.
+func (site *Site) validateBlocks(tplPath, tpl string) error {
+	open, close := site.delimiters()
+	var errs []error
+	chunks, err := site.scanTemplate(tplPath, tpl)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if !c.block {
+			continue
+		}
+		line := c.line
+		var (
+			argv []string
+			seen bool
+		)
+		block, _ := blockMarker(c.text)
+		for i, l := range strings.Split(block, "\n") {
+			l = strings.TrimSpace(l)
+			if l == "" {
+				continue
+			}
+			for _, word := range strings.Fields(l) {
+				if token := strictToken(word); token != "" {
+					errs = append(errs, fmt.Errorf("%s:%d: %q is not allowed in strict mode", tplPath, line+i, token))
+				}
+			}
+			if seen {
+				errs = append(errs, fmt.Errorf("%s:%d: a strict %s %s block holds a single command", tplPath, line+i, open, close))
+				continue
+			}
+			seen = true
+			rest, ok := strings.CutPrefix(l, "exec:")
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s:%d: strict %s %s block must start with \"exec:\"", tplPath, line+i, open, close))
+				continue
+			}
+			argv = strings.Fields(rest)
+			if len(argv) == 0 {
+				errs = append(errs, fmt.Errorf("%s:%d: empty command", tplPath, line+i))
+			} else if strings.Contains(argv[0], "$") {
+				// The command must be known to be allowed before the build.
+				errs = append(errs, fmt.Errorf("%s:%d: command %q cannot be a variable in strict mode", tplPath, line+i, argv[0]))
+			} else if !slices.Contains(site.AllowedCommands, argv[0]) {
+				errs = append(errs, fmt.Errorf("%s:%d: command %q is not allowed", tplPath, line+i, argv[0]))
+			}
+		}
+		if !seen {
+			errs = append(errs, fmt.Errorf("%s:%d: empty %s %s block", tplPath, line, open, close))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// strictCommand builds the command of a strict template block. Variables of
+// env are expanded in every argument, without any word splitting.
+func (site *Site) strictCommand(ctx context.Context, block string, env []string) (*exec.Cmd, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(block), "exec:")
+	if !ok {
+		return nil, fmt.Errorf("strict block must start with \"exec:\"")
+	}
+	argv := strings.Fields(rest)
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	argv = expandArgs(argv, env)
+	if !slices.Contains(site.AllowedCommands, argv[0]) {
+		return nil, fmt.Errorf("command %q is not allowed", argv[0])
+	}
+	return exec.CommandContext(ctx, argv[0], argv[1:]...), nil
+}
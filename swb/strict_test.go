@@ -0,0 +1,62 @@
+package swb
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestValidateBlocks checks that the blocks of strict templates using a
+// shell feature or a command which is not allowed are rejected, with their
+// line.
+func TestValidateBlocks(t *testing.T) {
+	tests := []struct {
+		tpl string
+		err string
+	}{
+		{"<p>\n%{\nexec: date +%Y\n}%\n", ""},
+		{"%{\nexec: echo https://example.com/?a=1&b=2;c=3\n}%\n", ""},
+		{"%{\nexec: echo a; rm -rf /\n}%\n", `site.tpl:2: ";" is not allowed in strict mode`},
+		{"%{\nexec: echo a | tee x\n}%\n", `site.tpl:2: "|" is not allowed in strict mode`},
+		{"%{\nexec: echo >x\n}%\n", `site.tpl:2: ">" is not allowed in strict mode`},
+		{"%{\nexec: echo a&\n}%\n", `site.tpl:2: "&" is not allowed in strict mode`},
+		{"\n%{\nexec: echo $(id)\n}%\n", `site.tpl:3: "$(" is not allowed in strict mode`},
+		{"%{\nexec: echo `id`\n}%\n", "site.tpl:2: \"`\" is not allowed in strict mode"},
+		{"%{\nexec: echo https://example.com/$(id)\n}%\n", `site.tpl:2: "$(" is not allowed in strict mode`},
+		{"%{\nexec: $cmd -x\n}%\n", `site.tpl:2: command "$cmd" cannot be a variable in strict mode`},
+		{"%{\nexec: rm -rf /\n}%\n", `site.tpl:2: command "rm" is not allowed`},
+		{"%{\necho a\n}%\n", `site.tpl:2: strict %{ }% block must start with "exec:"`},
+		{"%{\nexec: date\nexec: date\n}%\n", "site.tpl:3: a strict %{ }% block holds a single command"},
+	}
+	site := &Site{Name: "site", TemplateMode: TemplateStrict, AllowedCommands: []string{"date", "echo"}}
+	for _, tt := range tests {
+		err := site.validateBlocks("site.tpl", tt.tpl)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("template %q: %v", tt.tpl, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("template %q: error %v, want %s", tt.tpl, err, tt.err)
+		}
+	}
+}
+
+// TestStrictCommand checks the commands of strict blocks: their variables
+// are expanded without word splitting, and the expanded command must be
+// allowed.
+func TestStrictCommand(t *testing.T) {
+	site := &Site{Name: "site", TemplateMode: TemplateStrict, AllowedCommands: []string{"echo"}}
+	env := []string{"title=a; rm -rf /", "cmd=rm"}
+	cmd, err := site.strictCommand(context.Background(), "exec: echo $title https://example.com/?a=1&b=2", env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"echo", "a; rm -rf /", "https://example.com/?a=1&b=2"}; !slices.Equal(cmd.Args, want) {
+		t.Errorf("argv %q, want %q", cmd.Args, want)
+	}
+	for _, block := range []string{"exec: $cmd -rf /", "exec: rm -rf /", "echo a", "exec:"} {
+		if _, err := site.strictCommand(context.Background(), block, env); err == nil {
+			t.Errorf("block %q accepted", block)
+		}
+	}
+}
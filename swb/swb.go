@@ -0,0 +1,991 @@
+package swb
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Builder struct {
+	Ext string `json:"ext" toml:"ext" yaml:"ext"`
+	Bin string `json:"bin" toml:"bin" yaml:"bin"`
+	// Extension of the built pages, .html by default.
+	OutExt string `json:"outExt,omitempty" toml:"outExt,omitempty" yaml:"outExt,omitempty"`
+	// Stdin, if true, makes swb run Bin itself on the body of the pages,
+	// fed on its standard input, rather than leaving it to the template
+	// (see ContentToken). It is implied by the internal builder (see
+	// BuilderInternal).
+	Stdin bool `json:"stdin,omitempty" toml:"stdin,omitempty" yaml:"stdin,omitempty"`
+}
+
+type Site struct {
+	Name            string       `json:"name" toml:"name" yaml:"name"`
+	SrcRoot         string       `json:"srcRoot" toml:"srcRoot" yaml:"srcRoot"`
+	DstRoot         string       `json:"dstRoot" toml:"dstRoot" yaml:"dstRoot"`
+	TplPath         string       `json:"tplPath" toml:"tplPath" yaml:"tplPath"`
+	Env             []string     `json:"env,omitempty" toml:"env,omitempty" yaml:"env,omitempty"`
+	Keep            []string     `json:"keep,omitempty" toml:"keep,omitempty" yaml:"keep,omitempty"`
+	TemplateMode    string       `json:"templateMode,omitempty" toml:"templateMode,omitempty" yaml:"templateMode,omitempty"`
+	BlockCache      bool         `json:"blockCache,omitempty" toml:"blockCache,omitempty" yaml:"blockCache,omitempty"`
+	AllowedCommands []string     `json:"allowedCommands,omitempty" toml:"allowedCommands,omitempty" yaml:"allowedCommands,omitempty"`
+	Symlinks        string       `json:"symlinks,omitempty" toml:"symlinks,omitempty" yaml:"symlinks,omitempty"`
+	Delimiters      []string     `json:"delimiters,omitempty" toml:"delimiters,omitempty" yaml:"delimiters,omitempty"`
+	Transforms      []Transform  `json:"transforms,omitempty" toml:"transforms,omitempty" yaml:"transforms,omitempty"`
+	PageChecks      []PageCheck  `json:"pageChecks,omitempty" toml:"pageChecks,omitempty" yaml:"pageChecks,omitempty"`
+	LinkCheck       *LinkCheck   `json:"linkCheck,omitempty" toml:"linkCheck,omitempty" yaml:"linkCheck,omitempty"`
+	Fingerprint     []string     `json:"fingerprint,omitempty" toml:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	PreserveTimes   bool         `json:"preserveTimes,omitempty" toml:"preserveTimes,omitempty" yaml:"preserveTimes,omitempty"`
+	Ignore          []string     `json:"ignore,omitempty" toml:"ignore,omitempty" yaml:"ignore,omitempty"`
+	Rebuild         string       `json:"rebuild,omitempty" toml:"rebuild,omitempty" yaml:"rebuild,omitempty"`
+	Assets          string       `json:"assets,omitempty" toml:"assets,omitempty" yaml:"assets,omitempty"`
+	Umask           string       `json:"umask,omitempty" toml:"umask,omitempty" yaml:"umask,omitempty"`
+	CleanURLs       bool         `json:"cleanURLs,omitempty" toml:"cleanURLs,omitempty" yaml:"cleanURLs,omitempty"`
+	Permalinks      []Permalink  `json:"permalinks,omitempty" toml:"permalinks,omitempty" yaml:"permalinks,omitempty"`
+	BaseURL         string       `json:"baseURL,omitempty" toml:"baseURL,omitempty" yaml:"baseURL,omitempty"`
+	Sitemap         bool         `json:"sitemap,omitempty" toml:"sitemap,omitempty" yaml:"sitemap,omitempty"`
+	Robots          bool         `json:"robots,omitempty" toml:"robots,omitempty" yaml:"robots,omitempty"`
+	Feed            *Feed        `json:"feed,omitempty" toml:"feed,omitempty" yaml:"feed,omitempty"`
+	Search          *Search      `json:"search,omitempty" toml:"search,omitempty" yaml:"search,omitempty"`
+	Taxonomy        *Taxonomy    `json:"taxonomy,omitempty" toml:"taxonomy,omitempty" yaml:"taxonomy,omitempty"`
+	PageSize        int          `json:"pageSize,omitempty" toml:"pageSize,omitempty" yaml:"pageSize,omitempty"`
+	Related         int          `json:"related,omitempty" toml:"related,omitempty" yaml:"related,omitempty"`
+	TOC             *TOC         `json:"toc,omitempty" toml:"toc,omitempty" yaml:"toc,omitempty"`
+	Redirects       *Redirects   `json:"redirects,omitempty" toml:"redirects,omitempty" yaml:"redirects,omitempty"`
+	Archetype       string       `json:"archetype,omitempty" toml:"archetype,omitempty" yaml:"archetype,omitempty"`
+	Engine          string       `json:"engine,omitempty" toml:"engine,omitempty" yaml:"engine,omitempty"`
+	Highlight       *Highlight   `json:"highlight,omitempty" toml:"highlight,omitempty" yaml:"highlight,omitempty"`
+	Minify          []string     `json:"minify,omitempty" toml:"minify,omitempty" yaml:"minify,omitempty"`
+	Images          []Image      `json:"images,omitempty" toml:"images,omitempty" yaml:"images,omitempty"`
+	Precompress     *Precompress `json:"precompress,omitempty" toml:"precompress,omitempty" yaml:"precompress,omitempty"`
+	Deploy          *Deploy      `json:"deploy,omitempty" toml:"deploy,omitempty" yaml:"deploy,omitempty"`
+	Hooks           *Hooks       `json:"hooks,omitempty" toml:"hooks,omitempty" yaml:"hooks,omitempty"`
+	// BuildLog is the path of the log of the last build of the site (see
+	// startLog).
+	BuildLog string `json:"buildLog,omitempty" toml:"buildLog,omitempty" yaml:"buildLog,omitempty"`
+	// Languages of the content of the site, the first being the default
+	// one (e.g. ["en", "fr"]), see Site.language.
+	Languages []string `json:"languages,omitempty" toml:"languages,omitempty" yaml:"languages,omitempty"`
+
+	// Src, if not nil, is the src tree of the site (e.g. an embed.FS), read
+	// in place of the directory at SrcRoot, and Dst, if not nil, is where
+	// its dst tree is written (e.g. a MemFS), in place of the directory at
+	// DstRoot. The roots then only name the files of the trees. The
+	// commands run to build the files are given temporary copies of the
+	// files they read, the hooks and the deploys need the directories.
+	Src fs.FS `json:"-" toml:"-" yaml:"-"`
+	Dst DstFS `json:"-" toml:"-" yaml:"-"`
+
+	generated []string
+	// Ignore patterns of the config and of the ignore file.
+	ignores []string
+	// Outputs of the last successful build.
+	manifest Manifest
+	// Dst paths of the files moved by permalinks or by their language.
+	permalinked map[string]bool
+	// Date of the next page to be published, skipped by the build.
+	publish time.Time
+	index   string
+	// Entries of the pages of the site, and the last commits of the files
+	// of its src tree, during a build.
+	entries   []IndexEntry
+	commits   map[string]*GitCommit
+	tplHash   string
+	toolchain string
+	// Hashed dst-relative paths of the fingerprinted assets, by path, and
+	// the other way around.
+	assets   map[string]string
+	hashed   map[string]string
+	includes *regexp.Regexp
+	report   *Report
+	// Log of the current build, if the site has a BuildLog.
+	log *Logger
+	// Templates loaded during a build, by path, and outputs of their
+	// blocks, by key (see blockKey), if the site caches them.
+	templates  map[string]*parsedTpl
+	blockCache map[string]string
+	// Whether the dst tree may be tidied during a build (see checkTidy).
+	cleanable bool
+}
+
+type Config struct {
+	Sites   []*Site `json:"sites" toml:"sites" yaml:"sites"`
+	Builder Builder `json:"builder" toml:"builder" yaml:"builder"`
+	// Builders of the content files of other extensions than the one of
+	// Builder.
+	Builders []Builder `json:"builders,omitempty" toml:"builders,omitempty" yaml:"builders,omitempty"`
+	RunCmd   []string  `json:"runCmd" toml:"runCmd" yaml:"runCmd"`
+	// Filters of the derived files, by output extension.
+	PostProcess map[string][]string `json:"postProcess,omitempty" toml:"postProcess,omitempty" yaml:"postProcess,omitempty"`
+	// Include are the configuration files merged into this one (see
+	// merge), relative to its directory, or glob patterns of them.
+	Include []string `json:"include,omitempty" toml:"include,omitempty" yaml:"include,omitempty"`
+	// Profiles are the overlays of the configuration, by name (see
+	// LoadProfile).
+	Profiles map[string]*Profile `json:"profiles,omitempty" toml:"profiles,omitempty" yaml:"profiles,omitempty"`
+	// QuickCheck, if true, skips the sites whose quick stamp did not change
+	// since their last build (see quickStamp), without stamping their
+	// trees, e.g. for a large number of sites only built by swb.
+	QuickCheck bool `json:"quickCheck,omitempty" toml:"quickCheck,omitempty" yaml:"quickCheck,omitempty"`
+	// CommandTimeout is the time a command run to build a file may take
+	// (e.g. "30s"), 10 minutes by default (see commandContext).
+	CommandTimeout string `json:"commandTimeout,omitempty" toml:"commandTimeout,omitempty" yaml:"commandTimeout,omitempty"`
+
+	// Progress, if not nil, is notified of the progress of the builds.
+	Progress Progress `json:"-" toml:"-" yaml:"-"`
+	// Drafts, if true, builds the draft pages too.
+	Drafts bool `json:"-" toml:"-" yaml:"-"`
+	// Future, if true, builds the pages dated in the future too.
+	Future bool `json:"-" toml:"-" yaml:"-"`
+	// DryRun, if true, reports the actions of the builds and cleanings
+	// without performing them: the dst trees are left untouched, and the
+	// commands of the templates are not run.
+	DryRun bool `json:"-" toml:"-" yaml:"-"`
+	// Wait, if true, waits for the other processes building, cleaning or
+	// deploying a site rather than failing it (see LockFile).
+	Wait bool `json:"-" toml:"-" yaml:"-"`
+	// Force, if true, rebuilds every page and places every asset again,
+	// even if they are up to date.
+	Force bool `json:"-" toml:"-" yaml:"-"`
+	// ForceClean, if true, cleans (and tidies when building) the dst trees
+	// even if they overlap their src tree, or hold none of the files swb
+	// writes in them.
+	ForceClean bool `json:"-" toml:"-" yaml:"-"`
+	// Only, if not empty, restricts the builds to the files of the src
+	// trees matching one of these patterns (see Site.Ignore).
+	Only []string `json:"-" toml:"-" yaml:"-"`
+	// Metrics, if not nil, counts the builds of Daemon, and is served by
+	// it at /metrics.
+	Metrics *Metrics `json:"-" toml:"-" yaml:"-"`
+
+	hash string
+	// Path of the only file built, by BuildPage.
+	page string
+	// Content of the page rendered by RenderPage, if not the one of its
+	// file.
+	pageSrc []byte
+	// Path of the configuration file and profile it was loaded with, the
+	// files it was read from (see Reload), and the selected site (see
+	// SelectSite).
+	path, profile string
+	files         []string
+	siteName      string
+}
+
+// Version is the swb version, it is recorded in the provenance of the
+// builds and can be set at link time.
+var Version = "devel"
+
+// LoadConfig reads, expands and validates the configuration file at
+// configPath, which can be written in JSON, TOML or YAML, and the files it
+// includes.
+func LoadConfig(configPath string) (*Config, error) {
+	return LoadProfile(configPath, "")
+}
+
+// LoadProfile loads the configuration file at configPath like LoadConfig,
+// with its profile called profile (if not empty) merged over it.
+func LoadProfile(configPath, profile string) (*Config, error) {
+	config := new(Config)
+	h := sha256.New()
+	if err := readConfig(configPath, config, h, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		// The sites are rebuilt when the profile changes.
+		fmt.Fprintf(h, "profile %q\n", profile)
+	}
+	config.hash = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	config.path, config.profile = configPath, profile
+	if err := config.applyProfile(profile); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	for _, site := range config.Sites {
+		site.generate(ProvenanceFile)
+		site.generate(StateFile)
+		site.generate(ManifestFile)
+		site.generate(DeployFile)
+		site.generate(LockFile)
+		if len(site.Fingerprint) > 0 {
+			site.generate(AssetManifest)
+		}
+		if site.Sitemap {
+			site.generate(SitemapFile)
+		}
+		if site.Robots {
+			site.generate(RobotsFile)
+		}
+		if site.Feed != nil {
+			site.generate(site.Feed.Path)
+		}
+		if site.Search != nil {
+			site.generate(site.Search.Path)
+		}
+		if site.Taxonomy != nil {
+			site.generate(path.Join(site.Taxonomy.Path, "*.html"))
+			site.generate(path.Join(site.Taxonomy.Path, "*", "page", "*"))
+		}
+		if site.Redirects != nil && site.Redirects.Path != "" {
+			site.generate(site.Redirects.Path)
+		}
+		if site.Highlight != nil && site.Highlight.CSS != "" {
+			site.generate(site.Highlight.CSS)
+		}
+	}
+	return config, nil
+}
+
+// validateRunCmd checks that there is a run command for the template
+// snippets, unless every site uses strict templates (which ignore it) or
+// the Go engine.
+func (config *Config) validateRunCmd() error {
+	if len(config.RunCmd) > 0 && config.RunCmd[0] != "" {
+		return nil
+	}
+	for _, site := range config.Sites {
+		if site.TemplateMode != TemplateStrict && site.Engine != EngineGo {
+			return fmt.Errorf("runCmd: a command is required to run the template snippets of site %s (e.g. [\"sh\", \"-c\"])", site.Name)
+		}
+	}
+	return nil
+}
+
+// maxWalks is the number of times a build walks the src tree at most, if
+// it keeps changing during the walks.
+const maxWalks = 3
+
+func (config *Config) build(ctx context.Context, site *Site) error {
+	start := now()
+	// The times of the phases of the build, for profiling.
+	lap := site.stopwatch()
+	if !config.ForceClean {
+		if err := site.checkOverlap(); err != nil {
+			return phaseError(PhaseDst, site.DstRoot, err)
+		}
+	}
+	config.stampToolchain(site)
+	if err := config.runHooks(ctx, site, PhasePreBuild); err != nil {
+		return phaseError(PhasePreBuild, "", err)
+	}
+	lap(PhasePreBuild)
+	if !config.Force && config.QuickCheck && config.quickUpToDate(site) {
+		// The trees are not walked.
+		lap(PhaseState)
+		config.action(site, ActionSkip, site.DstRoot, 0)
+		return nil
+	}
+	srcStamp, err := config.srcStamp(site)
+	if err != nil {
+		return phaseError(PhaseWalk, site.SrcRoot, err)
+	}
+	lap(PhaseState)
+	if !config.Force && site.upToDate(srcStamp) {
+		config.action(site, ActionSkip, site.DstRoot, 0)
+		return nil
+	}
+	site.publish = time.Time{}
+	site.templates = make(map[string]*parsedTpl)
+	defer func() { site.templates = nil }()
+	if site.BlockCache {
+		site.blockCache = make(map[string]string)
+		defer func() { site.blockCache = nil }()
+	}
+	if err := site.validateTemplate(site.TplPath); err != nil {
+		return phaseError(PhaseTemplate, site.TplPath, err)
+	}
+	lap(PhaseTemplate)
+	// The directories a dry run would have created.
+	planned := make(map[string]bool)
+	mkdir := func(dir string) error {
+		if planned[dir] {
+			return nil
+		}
+		if _, err := site.stat(dir); !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		config.action(site, ActionMkdir, dir, 0)
+		if config.DryRun {
+			planned[dir] = true
+			return nil
+		}
+		return site.mkdirAll(dir, site.dirMode())
+	}
+	if _, err := site.stat(site.DstRoot); err != nil {
+		if err := mkdir(site.DstRoot); err != nil {
+			return phaseError(PhaseDst, site.DstRoot, err)
+		}
+	} else if !config.DryRun {
+		if err := site.probeWritable(); err != nil {
+			return phaseError(PhaseDst, site.DstRoot, err)
+		}
+	}
+	lap(PhaseDst)
+	rules := config.rules(site)
+	if err := site.trackTemplate(rules); err != nil {
+		return phaseError(PhaseTemplate, site.TplPath, err)
+	}
+	lap(PhaseTemplate)
+	site.trackToolchain(rules)
+	// The hashed names of the assets are needed to tidy the dst tree, and
+	// by the pages referencing them.
+	if err := site.fingerprintAssets(rules); err != nil {
+		return phaseError(PhaseFingerprint, "", err)
+	}
+	lap(PhaseFingerprint)
+	if err := site.mapPermalinks(rules); err != nil {
+		return phaseError(PhaseTidy, "", err)
+	}
+	// The outputs of the last build are needed to tidy the dst tree.
+	site.manifest = site.readManifest()
+	site.cleanable = false
+	if err := config.tidy(site); err != nil {
+		return phaseError(PhaseTidy, "", err)
+	}
+	// The next tidy passes only remove the outputs of this build.
+	site.cleanable = true
+	lap(PhaseTidy)
+	if !config.DryRun {
+		if err := site.writeAssetManifest(); err != nil {
+			return phaseError(PhaseFingerprint, "", err)
+		}
+	}
+	lap(PhaseFingerprint)
+	// The index of the pages is written before any page is built, so that
+	// every page sees all the others.
+	site.commits = gitLog(site.SrcRoot)
+	defer func() { site.commits = nil }()
+	pages, err := site.pages(rules)
+	if err != nil {
+		return phaseError(PhaseIndex, "", err)
+	}
+	index, err := writeIndex(pages)
+	if err != nil {
+		return phaseError(PhaseIndex, "", err)
+	}
+	site.index = index
+	site.entries = pages
+	defer func() {
+		os.Remove(index)
+		site.index = ""
+		site.entries = nil
+	}()
+	lap(PhaseIndex)
+	outputs := make(map[string]string)
+	manifest := make(Manifest)
+	// The failure of a file does not prevent the others from being built,
+	// unless it is due to the environment.
+	var errs []error
+	fail := func(phase, path string, err error) error {
+		errs = append(errs, phaseError(phase, path, err))
+		if IsEnvironmental(err) {
+			return errors.Join(errs...)
+		}
+		return nil
+	}
+	record := func(path string, srcInfo fs.FileInfo, eqPath string, r *rule) error {
+		if config.DryRun {
+			return nil
+		}
+		for _, outPath := range r.outputs(eqPath) {
+			e, err := site.manifestEntry(path, srcInfo, outPath)
+			if err != nil {
+				return fail(PhaseManifest, path, err)
+			}
+			manifest[site.rel(outPath)] = e
+		}
+		return nil
+	}
+	// The files walked, to walk again only the ones which changed since.
+	walked := make(map[string]fs.FileInfo)
+	visit := func(path string, srcInfo fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if srcInfo.IsDir() {
+			// If the file is a directory, we simply create a directory with the
+			// same name under the corresponding directory in the dst tree.
+			eqPath := filepath.Join(site.DstRoot, strings.TrimPrefix(path, site.SrcRoot))
+			if err := mkdir(eqPath); err != nil {
+				if err := fail(PhaseBuild, path, err); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+		} else {
+			// If the file is the source of a derived file (e.g. a page to be
+			// built), we derive it and write the result in the dst tree with
+			// the output extension of the rule. If the file is of another type
+			// we place it (a hard link by default, see Assets) under the
+			// corresponding directory in the dst tree.
+			if isDirFile(path) {
+				return nil
+			}
+			if info, ok := walked[path]; ok && info.Size() == srcInfo.Size() && info.ModTime().Equal(srcInfo.ModTime()) {
+				return nil
+			}
+			walked[path] = srcInfo
+			eqPath, r := site.output(rules, path)
+			if r.skipped(path) {
+				return nil
+			}
+			if other, ok := outputs[eqPath]; ok && other != path {
+				return fail(PhaseBuild, path, fmt.Errorf("%s is also the output of %s", eqPath, other))
+			}
+			outputs[eqPath] = path
+			if e := site.entry(path); e != nil && e.listing {
+				// The listing pages are written after the others.
+				return nil
+			}
+			if !config.selected(site, path) {
+				// The outputs of the last build are kept as they are.
+				for _, outPath := range r.outputs(eqPath) {
+					if e, ok := site.manifest[site.rel(outPath)]; ok {
+						manifest[site.rel(outPath)] = e
+					}
+				}
+				return nil
+			}
+			if r != nil {
+				// The output may be the only file of its directory, with
+				// clean URLs or permalinks.
+				if err := mkdir(filepath.Dir(eqPath)); err != nil {
+					return fail(PhaseBuild, path, err)
+				}
+				dstInfo, err := site.stat(eqPath)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return fail(PhaseBuild, path, err)
+				}
+				action := ActionBuild
+				if err == nil {
+					stale, err := r.stale(path, srcInfo, dstInfo)
+					if err == nil && !stale {
+						// The times of the files may not tell that they changed.
+						stale, err = site.changed(path, srcInfo, eqPath, dstInfo)
+					}
+					if err == nil && !stale {
+						stale = r.missingVariant(eqPath)
+					}
+					if err == nil && !stale {
+						// e.g. a script made executable in the src tree.
+						stale = dstInfo.Mode().Perm() != site.fileMode(srcInfo.Mode())
+					}
+					if err != nil {
+						return fail(PhaseBuild, path, err)
+					}
+					if !stale {
+						config.action(site, ActionSkip, eqPath, 0)
+						return record(path, srcInfo, eqPath, r)
+					}
+					// Rebuild the file if it has been updated in the src file tree.
+					action = ActionRebuild
+				}
+				if config.DryRun {
+					config.action(site, action, eqPath, 0)
+					return nil
+				}
+				t := time.Now()
+				if err := r.build(ctx, path, eqPath); err != nil {
+					config.fail(site)
+					return fail(PhaseBuild, path, err)
+				}
+				if err := config.postProcess(ctx, site, path, eqPath); err != nil {
+					// Do not leave an unfiltered output looking up to date.
+					site.remove(eqPath)
+					config.fail(site)
+					return fail(PhaseBuild, path, err)
+				}
+				if err := r.finish(eqPath, srcInfo, site.fileMode(srcInfo.Mode())); err != nil {
+					return fail(PhaseBuild, path, err)
+				}
+				config.action(site, action, eqPath, time.Since(t))
+			} else {
+				if err := config.placeAsset(ctx, site, path, eqPath); err != nil {
+					config.fail(site)
+					return fail(PhaseLink, path, err)
+				}
+			}
+			return record(path, srcInfo, eqPath, r)
+		}
+		return nil
+	}
+	if err := site.walkSrc(visit); err != nil {
+		if len(errs) > 0 {
+			// The walk has been stopped by a failure, already recorded.
+			return err
+		}
+		return phaseError(PhaseWalk, site.SrcRoot, err)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	lap(PhaseWalk)
+	// The sources renamed, added or removed during the walk (e.g. by an
+	// editor) may have been missed by it, and their former outputs by the
+	// tidy pass: as long as the src tree changes during a walk, the dst tree
+	// is tidied again against the manifest of this build, and the changed
+	// files are walked again with the index of the pages as it now is. The
+	// partial builds do not record all the outputs.
+	walkStamp := srcStamp
+	for walks := 1; !config.DryRun && len(config.Only) == 0 && config.page == ""; walks++ {
+		stamp, err := config.srcStamp(site)
+		if err != nil {
+			return phaseError(PhaseWalk, site.SrcRoot, err)
+		}
+		if stamp == walkStamp {
+			break
+		}
+		if walks == maxWalks {
+			config.warn(site, site.SrcRoot, "the src tree kept changing during the build, the next one builds it again")
+			break
+		}
+		walkStamp = stamp
+		site.manifest = manifest
+		if err := config.tidy(site); err != nil {
+			return phaseError(PhaseTidy, "", err)
+		}
+		site.forget(outputs, manifest)
+		if pages, err = site.pages(rules); err != nil {
+			return phaseError(PhaseIndex, "", err)
+		}
+		os.Remove(index)
+		if index, err = writeIndex(pages); err != nil {
+			return phaseError(PhaseIndex, "", err)
+		}
+		site.index, site.entries = index, pages
+		if err := site.walkSrc(visit); err != nil && len(errs) == 0 {
+			return phaseError(PhaseWalk, site.SrcRoot, err)
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+		lap(PhaseWalk)
+	}
+	if err := config.writeListings(ctx, site, pages, outputs, manifest); err != nil {
+		return err
+	}
+	lap(PhaseBuild)
+	if err := config.writeRedirects(site, pages, outputs, manifest); err != nil {
+		return phaseError(PhaseRedirects, "", err)
+	}
+	lap(PhaseRedirects)
+	if err := config.writeTaxonomy(ctx, site, pages, outputs); err != nil {
+		return phaseError(PhaseTaxonomy, "", err)
+	}
+	lap(PhaseTaxonomy)
+	if err := config.writeFeed(site, pages, outputs); err != nil {
+		return phaseError(PhaseFeed, "", err)
+	}
+	lap(PhaseFeed)
+	if err := config.writeSitemap(site, pages, outputs); err != nil {
+		return phaseError(PhaseSitemap, "", err)
+	}
+	lap(PhaseSitemap)
+	if err := config.writeSearchIndex(site, pages, outputs); err != nil {
+		return phaseError(PhaseSearch, "", err)
+	}
+	lap(PhaseSearch)
+	if err := config.writeHighlightCSS(site, outputs); err != nil {
+		return phaseError(PhaseHighlight, "", err)
+	}
+	lap(PhaseHighlight)
+	if err := config.checkLinks(site); err != nil {
+		return phaseError(PhaseLinks, "", err)
+	}
+	lap(PhaseLinks)
+	if err := config.precompress(ctx, site); err != nil {
+		return phaseError(PhasePrecompress, "", err)
+	}
+	lap(PhasePrecompress)
+	if err := config.runHooks(ctx, site, PhasePostBuild); err != nil {
+		return phaseError(PhasePostBuild, "", err)
+	}
+	lap(PhasePostBuild)
+	if config.DryRun {
+		// The records of the build are left as they are.
+		return nil
+	}
+	if err := site.writeManifest(manifest); err != nil {
+		return phaseError(PhaseManifest, "", err)
+	}
+	lap(PhaseManifest)
+	if err := config.writeProvenance(site, start); err != nil {
+		return phaseError(PhaseProvenance, "", err)
+	}
+	lap(PhaseProvenance)
+	if len(config.Only) > 0 || config.page != "" {
+		// The state tells that every file has been built.
+		return nil
+	}
+	defer lap(PhaseState)
+	return phaseError(PhaseState, "", config.writeState(site, srcStamp))
+}
+
+func (config *Config) buildPage(ctx context.Context, site *Site, srcPath, dstPath string) error {
+	page, err := config.renderPage(ctx, site, srcPath, dstPath, nil)
+	if err != nil {
+		return err
+	}
+	return site.writeFile(dstPath, page, 0644)
+}
+
+// renderPage renders the page at srcPath, written at dstPath, through its
+// template. pg is the page of the listing to render, if the page is a
+// paginated listing (see writeListings).
+func (config *Config) renderPage(ctx context.Context, site *Site, srcPath, dstPath string, pg *paginator) ([]byte, error) {
+	src := config.pageSrc
+	if src == nil {
+		var err error
+		if src, err = site.readFile(srcPath); err != nil {
+			return nil, err
+		}
+	}
+	fm, body, err := frontMatter(src)
+	if err != nil {
+		return nil, fmt.Errorf("front matter: %v", err)
+	}
+	tplPath, err := site.pageTemplate(srcPath, fm)
+	if err != nil {
+		return nil, err
+	}
+	// The template is loaded and checked once per build.
+	t, err := site.loadTemplate(tplPath)
+	if err != nil {
+		return nil, err
+	}
+	if site.Engine == EngineGo {
+		return config.renderGoPage(ctx, site, srcPath, dstPath, tplPath, fm, body, pg)
+	}
+	pageVars, err := site.pageVars(srcPath, fm)
+	if err != nil {
+		return nil, err
+	}
+	pageEnv, err := site.pageEnv(srcPath, fm, body)
+	if err != nil {
+		return nil, err
+	}
+	defer removeBody(pageEnv)
+	env := append(append(config.env(site, srcPath, dstPath), pageVars...), pageEnv...)
+	env = append(env, gitEnv(site.lastCommit(srcPath), fm)...)
+	relationsEnv, removeRelations, err := site.relationsEnv(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer removeRelations()
+	env = append(env, relationsEnv...)
+	if pg != nil {
+		itemsPath, err := writeTempJSON("swb-paginator-*.json", pg.Items)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(itemsPath)
+		env = append(env, pg.env(itemsPath)...)
+	}
+	var built string
+	if b := config.builder(filepath.Ext(srcPath)); b.runBySwb() {
+		content, err := config.buildBody(ctx, site, b, body, env)
+		if err != nil {
+			return nil, err
+		}
+		if t := site.pageTOC(fm); t != nil {
+			var entries []tocEntry
+			content, entries = t.tableOfContents(content)
+			tocEnv, err := tocEnv(entries)
+			if err != nil {
+				return nil, err
+			}
+			env = append(env, tocEnv...)
+		}
+		contentPath, err := writeTemp("swb-page-body-*"+b.OutExt, content)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(contentPath)
+		built, err = config.renderContent(ctx, site, t, append(env, "page_body="+contentPath), content)
+		if err != nil {
+			return nil, err
+		}
+	} else if built, err = config.render(ctx, site, t, env); err != nil {
+		return nil, err
+	}
+	page := site.rewriteAssets(dstPath, []byte(built))
+	if err := config.checkPage(site, dstPath, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// render runs the commands of the blocks of the template t with the
+// environment env, and returns the template with the blocks replaced by
+// their output. Every block is run, and the ones which fail are reported
+// in the returned error, with their standard error.
+func (config *Config) render(ctx context.Context, site *Site, t *parsedTpl, env []string) (string, error) {
+	return config.renderChunks(ctx, site, t, env, ContentToken)
+}
+
+// renderChunks renders the template t like render, with the ContentToken
+// replaced by content.
+func (config *Config) renderChunks(ctx context.Context, site *Site, t *parsedTpl, env []string, content string) (string, error) {
+	var b strings.Builder
+	errs := config.renderTo(ctx, site, &b, t.files[0], t.chunks, env, content)
+	return b.String(), errors.Join(errs...)
+}
+
+// renderTo writes the chunks of the template at tplPath rendered with the
+// environment env to b, and returns the errors of their blocks.
+func (config *Config) renderTo(ctx context.Context, site *Site, b *strings.Builder, tplPath string, chunks []tplChunk, env []string, content string) []error {
+	var errs []error
+	for _, c := range chunks {
+		switch {
+		case c.content:
+			b.WriteString(content)
+		case c.block:
+			out, err := config.cachedBlock(ctx, site, c.text, fmt.Sprintf("%s:%d", tplPath, c.line), env)
+			if err != nil {
+				cmdLine, _, _ := strings.Cut(strings.TrimSpace(c.text), "\n")
+				errs = append(errs, fmt.Errorf("command %q: %w", cmdLine, err))
+				continue
+			}
+			b.WriteString(indentLines(out, c.indent))
+		case c.directive == "$":
+			value, _ := envValue(env, c.name)
+			b.WriteString(value)
+		case c.directive == "if":
+			body := c.body
+			if !c.holds(env) {
+				body = c.alt
+			}
+			errs = append(errs, config.renderTo(ctx, site, b, tplPath, body, env, content)...)
+		case c.directive == "for":
+			list, _ := envValue(env, c.name)
+			items := slices.DeleteFunc(strings.Split(list, "\n"), func(item string) bool { return item == "" })
+			if len(items) == 0 {
+				errs = append(errs, config.renderTo(ctx, site, b, tplPath, c.alt, env, content)...)
+			}
+			for _, item := range items {
+				itemEnv := append(slices.Clip(env), c.item+"="+item)
+				errs = append(errs, config.renderTo(ctx, site, b, tplPath, c.body, itemEnv, content)...)
+			}
+		default:
+			b.WriteString(c.text)
+		}
+	}
+	return errs
+}
+
+// runBlock runs the commands of the block of a template at where (as
+// path:line) with the environment env, and returns their output.
+func (config *Config) runBlock(ctx context.Context, site *Site, block, where string, env []string) (string, error) {
+	ctx, cancel := config.commandContext(ctx)
+	defer cancel()
+	var cmd *exec.Cmd
+	if site.TemplateMode == TemplateStrict {
+		var err error
+		cmd, err = site.strictCommand(ctx, block, env)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		// The snippet is the last argument of the run command.
+		args := append(slices.Clone(config.RunCmd[1:]), block)
+		cmd = exec.CommandContext(ctx, config.RunCmd[0], args...)
+	}
+	cmd.Env = env
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	t := time.Now()
+	err := config.runCommand(ctx, cmd)
+	config.command(site, Command{Argv: cmd.Args, Duration: time.Since(t), Page: envPage(env), Block: where, Stderr: stderr.String()})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+func (config *Config) tidy(site *Site) error {
+	rules := config.rules(site)
+	if _, err := site.stat(site.DstRoot); err != nil && errors.Is(err, os.ErrNotExist) {
+		// Nothing has been built yet, so there is nothing to tidy.
+		return nil
+	}
+	return site.walkDst(func(path string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == site.DstRoot {
+			return nil
+		}
+		rel := strings.TrimPrefix(path, site.DstRoot+string(filepath.Separator))
+		if site.kept(rel) {
+			if ent.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dstInfo, err := ent.Info()
+		if err != nil {
+			return err
+		}
+		if dstInfo.IsDir() {
+			// If the file is a directory, we check that a file with the same name and
+			// that is a directory too exists in the src tree, if not we delete it from
+			// the dst tree.
+			eqPath := filepath.Join(site.SrcRoot, strings.TrimPrefix(path, site.DstRoot))
+			srcInfo, err := site.srcStat(eqPath)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if err != nil || !srcInfo.IsDir() {
+				// The directory may hold the output of a file moved by
+				// clean URLs or permalinks.
+				outputDir, err := site.outputDir(rules, path)
+				if err != nil {
+					return err
+				}
+				if !outputDir && !site.keepsUnder(rel) {
+					if err := config.checkTidy(site); err != nil {
+						return err
+					}
+					config.action(site, ActionRmdir, path, 0)
+					if err := config.removeAll(site, path); err != nil {
+						return err
+					}
+					return filepath.SkipDir
+				}
+			}
+		} else {
+			// If the file is not a directory, we simply check that it is
+			// derived from or linked to a file of the src tree, if not we
+			// delete it from the dst tree.
+			var derived bool
+			if _, ok := site.compressedOf(path); ok {
+				// A compressed copy goes with the file it compresses,
+				// which has been walked before it.
+				derived, err = site.copyKept(rules, path)
+			} else {
+				derived, err = site.derived(rules, path, dstInfo)
+			}
+			if err != nil {
+				return err
+			}
+			if !derived {
+				if err := config.checkTidy(site); err != nil {
+					return err
+				}
+				config.action(site, ActionRemove, path, 0)
+				if err := config.removeAll(site, path); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (config *Config) clean(ctx context.Context, site *Site) error {
+	if _, err := site.stat(site.DstRoot); err != nil {
+		return nil
+	}
+	if !config.ForceClean {
+		if err := site.checkCleanable(); err != nil {
+			return fmt.Errorf("%w (use -force to clean it anyway)", err)
+		}
+	}
+	if !config.DryRun {
+		if err := site.probeWritable(); err != nil {
+			return err
+		}
+		unlock, err := config.lock(ctx, site)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if len(site.keepPatterns()) == 0 {
+		config.action(site, ActionRmdir, site.DstRoot, 0)
+		return config.emptyDst(site)
+	}
+	// Some files have to be kept, only remove the entries that are not
+	// matched by the keep patterns.
+	err := site.walkDst(func(path string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == site.DstRoot {
+			return nil
+		}
+		rel := strings.TrimPrefix(path, site.DstRoot+string(filepath.Separator))
+		if site.kept(rel) {
+			if ent.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ent.IsDir() {
+			if site.keepsUnder(rel) {
+				return nil
+			}
+			config.action(site, ActionRmdir, path, 0)
+			if err := config.removeAll(site, path); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		config.action(site, ActionRemove, path, 0)
+		return config.removeAll(site, path)
+	})
+	if err != nil {
+		return err
+	}
+	// The state of the last build no longer describes the dst tree, the
+	// next build must not find the site up to date.
+	return config.removeAll(site, filepath.Join(site.DstRoot, StateFile))
+}
+
+// emptyDst removes everything in the dst tree of the site but its lock
+// file, held by the clean (see lock), unless it is a dry run.
+func (config *Config) emptyDst(site *Site) error {
+	if config.DryRun {
+		return nil
+	}
+	ents, err := site.readDir(site.DstRoot)
+	if err != nil {
+		return err
+	}
+	for _, ent := range ents {
+		if ent.Name() == LockFile {
+			continue
+		}
+		if err := site.removeAll(filepath.Join(site.DstRoot, ent.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAll removes the file or directory at path of the dst tree of the
+// site, unless it is a dry run.
+func (config *Config) removeAll(site *Site, path string) error {
+	if config.DryRun {
+		return nil
+	}
+	return site.removeAll(path)
+}
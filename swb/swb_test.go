@@ -0,0 +1,364 @@
+package swb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the files, by path relative to root, creating their
+// directories.
+func writeFiles(tb testing.TB, root string, files map[string]string) {
+	tb.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// loadConfig writes the configuration config in dir, and loads it.
+func loadConfig(tb testing.TB, dir string, config map[string]any) *Config {
+	tb.Helper()
+	b, err := json.Marshal(config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	path := filepath.Join(dir, "swb.json")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		tb.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return c
+}
+
+// testConfig returns the configuration of the sites of the tests, whose
+// blocks are run by sh and whose Markdown pages are built by the internal
+// builder.
+func testConfig(sites ...map[string]any) map[string]any {
+	return map[string]any{
+		"runCmd":   []string{"sh", "-c"},
+		"builders": []map[string]any{{"ext": ".md", "bin": BuilderInternal}},
+		"sites":    sites,
+	}
+}
+
+// fixtureSite writes the files, by path relative to a temporary directory,
+// and returns the configuration of a site named site built from its src
+// directory to its dst one with its site.tpl template. The fields of the
+// site are set or overridden by fields, whose srcRoot, dstRoot and tplPath
+// are relative to the directory too.
+func fixtureSite(tb testing.TB, files map[string]string, fields map[string]any) *Config {
+	tb.Helper()
+	dir := tb.TempDir()
+	writeFiles(tb, dir, files)
+	site := map[string]any{"name": "site", "srcRoot": "src", "dstRoot": "dst", "tplPath": "site.tpl"}
+	maps.Copy(site, fields)
+	for _, key := range []string{"srcRoot", "dstRoot", "tplPath"} {
+		site[key] = filepath.Join(dir, filepath.FromSlash(site[key].(string)))
+	}
+	return loadConfig(tb, dir, testConfig(site))
+}
+
+// tinySites returns the configuration of n sites of a few pages, sharing a
+// template.
+func tinySites(tb testing.TB, n int, quick bool) *Config {
+	dir := tb.TempDir()
+	writeFiles(tb, dir, map[string]string{"tpl/site.tpl": "<html>\n%content%\n</html>\n"})
+	var sites []map[string]any
+	for i := range n {
+		name := fmt.Sprintf("site%03d", i)
+		writeFiles(tb, filepath.Join(dir, "src", name), map[string]string{
+			"index.md":       "# Home\n",
+			"about/index.md": "# About\n",
+			"style.css":      "body { margin: 0 }\n",
+		})
+		sites = append(sites, map[string]any{
+			"name":    name,
+			"srcRoot": filepath.Join(dir, "src", name),
+			"dstRoot": filepath.Join(dir, "dst", name),
+			"tplPath": filepath.Join(dir, "tpl", "site.tpl"),
+		})
+	}
+	config := testConfig(sites...)
+	config["quickCheck"] = quick
+	return loadConfig(tb, dir, config)
+}
+
+// TestBuild builds a site from a fixture src tree, with a template running
+// a block and a front matter, and checks its dst tree and its report, then
+// that a second build leaves it as it is.
+func TestBuild(t *testing.T) {
+	config := fixtureSite(t, map[string]string{
+		"site.tpl":             "<title>\n%{\necho \"$fm_title\"\n}%\n</title>\n%content%\n",
+		"src/index.md":         "---\ntitle: Home\n---\n# Welcome\n",
+		"src/blog/first.md":    "---\ntitle: First\n---\nHello.\n",
+		"src/css/style.css":    "body { margin: 0 }\n",
+		"src/images/empty.txt": "",
+	}, nil)
+	dst := config.Sites[0].DstRoot
+	ctx := context.Background()
+	results, err := config.Build(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("results = %+v, want one site built", results)
+	}
+	for name, want := range map[string]string{
+		"index.html":       "<title>\nHome\n\n</title>\n<h1>Welcome</h1>\n\n",
+		"blog/first.html":  "<title>\nFirst\n\n</title>\n<p>Hello.</p>\n\n",
+		"css/style.css":    "body { margin: 0 }\n",
+		"images/empty.txt": "",
+	} {
+		b, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+		} else if string(b) != want {
+			t.Errorf("%s = %q, want %q", name, b, want)
+		}
+	}
+	report := results[0].Report
+	built := []string{filepath.Join(dst, "blog", "first.html"), filepath.Join(dst, "index.html")}
+	linked := []string{filepath.Join(dst, "css", "style.css"), filepath.Join(dst, "images", "empty.txt")}
+	if got := slices.Sorted(slices.Values(report.Built)); !slices.Equal(got, built) {
+		t.Errorf("built %v, want %v", got, built)
+	}
+	if got := slices.Sorted(slices.Values(report.Linked)); !slices.Equal(got, linked) {
+		t.Errorf("linked %v, want %v", got, linked)
+	}
+	if len(report.Rebuilt)+len(report.Removed)+len(report.Warnings) > 0 {
+		t.Errorf("first build rebuilt, removed or warned: %+v", report)
+	}
+	if len(report.Commands) != 2 {
+		t.Errorf("ran %d commands, want a block per page", len(report.Commands))
+	}
+
+	if results, err = config.Build(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	report = results[0].Report
+	if len(report.Built)+len(report.Linked)+len(report.Removed) > 0 {
+		t.Errorf("up to date site built again: %+v", report)
+	}
+}
+
+// TestRunCmd checks that the snippets of the templates are run by the run
+// command, given as its last argument, with a fake interpreter printing
+// the arguments it was given.
+func TestRunCmd(t *testing.T) {
+	interp := filepath.Join(t.TempDir(), "interp")
+	writeFiles(t, filepath.Dir(interp), map[string]string{"interp": "#!/bin/sh\nprintf '%s|' \"$@\"\n"})
+	if err := os.Chmod(interp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const block = "echo one\necho 'two three'"
+	tests := []struct {
+		runCmd []string
+		out    string
+	}{
+		{[]string{interp}, block + "|"},
+		{[]string{interp, "-c"}, "-c|" + block + "|"},
+		{[]string{interp, "-e", "-c"}, "-e|-c|" + block + "|"},
+	}
+	for _, tt := range tests {
+		config := &Config{RunCmd: tt.runCmd}
+		site := &Site{Name: "site", report: &Report{}}
+		out, err := config.runBlock(context.Background(), site, block, "site.tpl:1", nil)
+		if err != nil {
+			t.Errorf("runCmd %q: %v", tt.runCmd, err)
+			continue
+		}
+		if out != tt.out {
+			t.Errorf("runCmd %q: interpreter given %q, want %q", tt.runCmd, out, tt.out)
+		}
+		want := append(slices.Clone(tt.runCmd), block)
+		if len(site.report.Commands) != 1 || !slices.Equal(site.report.Commands[0].Argv, want) {
+			t.Errorf("runCmd %q: commands %+v, want argv %q", tt.runCmd, site.report.Commands, want)
+		}
+	}
+}
+
+// TestValidateRunCmd checks that a run command is required to run the
+// snippets of the templates.
+func TestValidateRunCmd(t *testing.T) {
+	tests := []struct {
+		runCmd []string
+		ok     bool
+	}{
+		{nil, false},
+		{[]string{}, false},
+		{[]string{""}, false},
+		{[]string{"sh"}, true},
+		{[]string{"sh", "-c"}, true},
+		{[]string{"rc", "-e", "-c"}, true},
+	}
+	for _, tt := range tests {
+		config := &Config{RunCmd: tt.runCmd, Sites: []*Site{{Name: "site"}}}
+		if err := config.validateRunCmd(); (err == nil) != tt.ok {
+			t.Errorf("runCmd %q: error %v, want ok %v", tt.runCmd, err, tt.ok)
+		}
+	}
+}
+
+// TestBuildEmptyDst checks that the first build of a site creates its dst
+// tree, and that cleaning a site which was never built does nothing.
+func TestBuildEmptyDst(t *testing.T) {
+	config := tinySites(t, 1, false)
+	site := config.Sites[0]
+	ctx := context.Background()
+	if _, err := config.CleanSite(ctx, site); err != nil {
+		t.Fatalf("clean of a missing dst tree: %v", err)
+	}
+	if _, err := os.Stat(site.DstRoot); !os.IsNotExist(err) {
+		t.Fatalf("clean created the dst tree: %v", err)
+	}
+	report, err := config.BuildSite(ctx, site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Built) != 2 || len(report.Linked) != 1 {
+		t.Errorf("built %v and linked %v, want 2 files and 1", report.Built, report.Linked)
+	}
+	for _, name := range []string{"index.html", "about/index.html", "style.css"} {
+		if _, err := os.Stat(filepath.Join(site.DstRoot, filepath.FromSlash(name))); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// A deniedFS is a file system whose file denied (and the files under it)
+// cannot be read.
+type deniedFS struct {
+	fs.FS
+	denied string
+}
+
+func (d deniedFS) Open(name string) (fs.File, error) {
+	if name == d.denied || strings.HasPrefix(name, d.denied+"/") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return d.FS.Open(name)
+}
+
+// TestBuildUnreadableSrc checks that a src entry which cannot be read fails
+// the build with its path, instead of being taken for a missing file.
+func TestBuildUnreadableSrc(t *testing.T) {
+	config := tinySites(t, 1, false)
+	site := config.Sites[0]
+	ctx := context.Background()
+	if _, err := config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	// The permissions of the files do not apply to root, the error is
+	// injected.
+	site.Src = deniedFS{FS: os.DirFS(site.SrcRoot), denied: "about"}
+	dir := filepath.Join(site.SrcRoot, "about")
+	_, err := config.BuildSite(ctx, site)
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), dir) {
+		t.Errorf("build error %v, want a permission error on %s", err, dir)
+	}
+	if _, err := os.Stat(filepath.Join(site.DstRoot, "about", "index.html")); err != nil {
+		t.Errorf("output of an unreadable source removed: %v", err)
+	}
+}
+
+// TestBuildSymlinkDst checks that a followed symbolic link is not walked
+// when it leads into the dst tree or to a directory holding it.
+func TestBuildSymlinkDst(t *testing.T) {
+	config := fixtureSite(t, map[string]string{
+		"site.tpl":          "%content%\n",
+		"src/index.md":      "# Home\n",
+		"shared/credits.md": "# Credits\n",
+	}, nil)
+	dir := filepath.Dir(config.Sites[0].SrcRoot)
+	for link, target := range map[string]string{
+		"src/shared":  "../shared",
+		"src/out":     "../dst",
+		"shared/loop": "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(link))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	site := config.Sites[0]
+	ctx := context.Background()
+	for range 2 {
+		if _, err := config.BuildSite(ctx, site); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(site.DstRoot, "shared", "credits.html")); err != nil {
+		t.Errorf("linked directory not built: %v", err)
+	}
+	for _, name := range []string{"out", "shared/loop"} {
+		if _, err := os.Stat(filepath.Join(site.DstRoot, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("link %s to the dst tree walked: %v", name, err)
+		}
+	}
+}
+
+// TestBuildCleanURLDraft checks that the directory of a page output with
+// clean URLs is removed when the page becomes a draft.
+func TestBuildCleanURLDraft(t *testing.T) {
+	config := fixtureSite(t, map[string]string{
+		"site.tpl":       "%content%\n",
+		"src/posts/a.md": "# A\n",
+		"src/posts/b.md": "# B\n",
+	}, map[string]any{"cleanURLs": true})
+	site := config.Sites[0]
+	ctx := context.Background()
+	if _, err := config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, site.SrcRoot, map[string]string{"posts/b.md": "---\ndraft: true\n---\n# B\n"})
+	if _, err := config.BuildSite(ctx, site); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(site.DstRoot, "posts", "b")); !os.IsNotExist(err) {
+		t.Errorf("directory of a draft kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(site.DstRoot, "posts", "a", "index.html")); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCleanOverlap checks that a dst tree inside its src tree is neither
+// built nor cleaned, unless the clean is forced.
+func TestCleanOverlap(t *testing.T) {
+	config := fixtureSite(t, map[string]string{
+		"site.tpl":          "%content%\n",
+		"src/index.md":      "# Home\n",
+		"src/public/old.md": "# Old\n",
+	}, map[string]any{"dstRoot": "src/public"})
+	site := config.Sites[0]
+	ctx := context.Background()
+	if _, err := config.BuildSite(ctx, site); err == nil || !strings.Contains(err.Error(), "inside srcRoot") {
+		t.Errorf("build error %v, want an overlap error", err)
+	}
+	if _, err := config.CleanSite(ctx, site); err == nil || !strings.Contains(err.Error(), "inside srcRoot") {
+		t.Errorf("clean error %v, want an overlap error", err)
+	}
+	config.ForceClean = true
+	if _, err := config.CleanSite(ctx, site); err != nil {
+		t.Fatalf("forced clean: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(site.DstRoot, "old.md")); !os.IsNotExist(err) {
+		t.Errorf("forced clean kept old.md: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package swb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const (
+	SymlinksFollow = "follow"
+	SymlinksSkip   = "skip"
+)
+
+// walkSrc walks the src tree of the site in lexical order, like
+// filepath.WalkDir, but calls fn with the information about the file the
+// path refers to. Depending on the site's symlinks option, symbolic links
+// are either followed (the default) or skipped. A symbolic link to one of
+// its own ancestors is never followed, so the walk always terminates, and
+// neither is one to the dst tree, to a directory in it or holding it. fn
+// is not called for SrcRoot itself, and can return filepath.SkipDir to
+// avoid descending into a directory.
+func (site *Site) walkSrc(fn func(path string, info fs.FileInfo) error) error {
+	switch site.Symlinks {
+	case "", SymlinksFollow, SymlinksSkip:
+	default:
+		return fmt.Errorf("unknown symlinks option %q", site.Symlinks)
+	}
+	if err := site.loadIgnore(); err != nil {
+		return err
+	}
+	return site.walkDir(site.SrcRoot, nil, fn)
+}
+
+func (site *Site) walkDir(dir string, ancestors []string, fn func(path string, info fs.FileInfo) error) error {
+	if site.Src == nil {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if real, err = filepath.Abs(real); err != nil {
+			return err
+		}
+		ancestors = append(ancestors, real)
+	}
+	ents, err := site.readDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, ent := range ents {
+		path := filepath.Join(dir, ent.Name())
+		info, err := site.srcStat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Skipped or dangling symbolic link.
+			continue
+		} else if err != nil {
+			return err
+		}
+		if info.IsDir() && ent.Type()&fs.ModeSymlink != 0 {
+			if site.Src != nil {
+				// The target of the link cannot be resolved in the file
+				// system, to find the cycles.
+				continue
+			}
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return err
+			}
+			if target, err = filepath.Abs(target); err != nil {
+				return err
+			}
+			if slices.Contains(ancestors, target) {
+				// Symbolic link cycle.
+				continue
+			}
+			// A link into the dst tree, or to one of its ancestors, would
+			// walk the outputs being written.
+			dst, err := realPath(site.DstRoot)
+			if err != nil {
+				return err
+			}
+			if within(dst, target) || within(target, dst) {
+				continue
+			}
+		}
+		if err := fn(path, info); err != nil {
+			if err == filepath.SkipDir && info.IsDir() {
+				continue
+			}
+			return err
+		}
+		if info.IsDir() {
+			if err := site.walkDir(path, ancestors, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// srcStat returns the information about the file at path in the src tree. The
+// ignored files, and the symbolic links if they are skipped, are reported as
+// not existing.
+func (site *Site) srcStat(path string) (fs.FileInfo, error) {
+	if site.ignored(path) {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	if site.Symlinks != SymlinksSkip {
+		return site.stat(path)
+	}
+	info, err := site.lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return nil, &fs.PathError{Op: "lstat", Path: path, Err: fs.ErrNotExist}
+	}
+	return info, nil
+}
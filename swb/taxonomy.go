@@ -0,0 +1,205 @@
+package swb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Taxonomy generates, after each successful build, a listing page for
+// every tag of the pages of a site (from the tags key of their front
+// matter), and an index of the tags, rendered through its template.
+type Taxonomy struct {
+	TplPath string `json:"tplPath" toml:"tplPath" yaml:"tplPath"`
+	// Directory of the tag pages relative to the root of the dst tree, tags
+	// by default.
+	Path string `json:"path,omitempty" toml:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// A tagEntry describes a tag, in the list of tags exported to the taxonomy
+// template.
+type tagEntry struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	URL   string `json:"url"`
+	Count int    `json:"count"`
+}
+
+// validateTaxonomy checks the site's taxonomy, and sets its defaults.
+func (site *Site) validateTaxonomy() error {
+	t := site.Taxonomy
+	if t == nil {
+		return nil
+	}
+	if t.TplPath == "" {
+		return fmt.Errorf("site %s: taxonomy: tplPath is required", site.Name)
+	}
+	tplPath, err := ExpandPath(t.TplPath)
+	if err != nil {
+		return fmt.Errorf("site %s: taxonomy: tplPath: %v", site.Name, err)
+	}
+	t.TplPath = tplPath
+	if t.Path == "" {
+		t.Path = "tags"
+	}
+	t.Path = path.Clean(filepath.ToSlash(t.Path))
+	if path.IsAbs(t.Path) || t.Path == "." || t.Path == ".." || strings.HasPrefix(t.Path, "../") {
+		return fmt.Errorf("site %s: taxonomy: path %s is not a directory of the dst tree", site.Name, t.Path)
+	}
+	return nil
+}
+
+// slug returns the name of the page of a tag, made of lower case letters,
+// digits and dashes (e.g. "Go modules" is go-modules).
+func slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// writeTaxonomy writes the tag pages of the site, if it has a taxonomy,
+// from the entries of its pages, paginated by the site's pageSize, and
+// removes the pages of the tags that are no longer used.
+func (config *Config) writeTaxonomy(ctx context.Context, site *Site, pages []IndexEntry, outputs map[string]string) error {
+	t := site.Taxonomy
+	if t == nil || config.DryRun {
+		// The commands of the template are not run in a dry run.
+		return nil
+	}
+	tpl, err := site.loadTemplate(t.TplPath)
+	if err != nil {
+		return err
+	}
+	// The tags whose names only differ by their case or punctuation share
+	// the page of the first one found.
+	byTag := make(map[string][]IndexEntry)
+	tags := []tagEntry{}
+	for _, page := range pages {
+		seen := make(map[string]bool)
+		for _, name := range page.Tags {
+			s := slug(name)
+			if s == "" || seen[s] {
+				continue
+			}
+			seen[s] = true
+			if _, ok := byTag[s]; !ok {
+				tags = append(tags, tagEntry{Name: name, Slug: s, URL: "/" + path.Join(t.Path, s+".html")})
+			}
+			byTag[s] = append(byTag[s], page)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Slug < tags[j].Slug })
+	for i := range tags {
+		tags[i].Count = len(byTag[tags[i].Slug])
+	}
+	tagsPath, err := writeTempJSON("swb-tags-*.json", tags)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tagsPath)
+	written := make(map[string]bool)
+	// The page pg of tag, or the index of the tags if it is nil, is written
+	// at the dst-relative path rel.
+	write := func(rel string, tag *tagEntry, pg *paginator, env ...string) error {
+		dstPath := filepath.Join(site.DstRoot, filepath.FromSlash(rel))
+		var built string
+		var err error
+		if site.Engine == EngineGo {
+			data := goTaxonomy{Rel: rel, Tags: tags, Site: site.goSite()}
+			if tag != nil {
+				data.Tag, data.Pages, data.Paginator = tag.Name, pg.Items, pg
+			}
+			built, err = site.executeGo(t.TplPath, data)
+		} else {
+			env = append(append(config.taxonomyEnv(site, dstPath), "taxonomy_tags="+tagsPath), env...)
+			built, err = config.render(ctx, site, tpl, env)
+		}
+		if err != nil {
+			return err
+		}
+		page := site.rewriteAssets(dstPath, []byte(built))
+		if err := config.checkPage(site, dstPath, page); err != nil {
+			return err
+		}
+		written[rel] = true
+		return config.writeGenerated(site, rel, page, outputs)
+	}
+	if err := write(path.Join(t.Path, "index.html"), nil, nil); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		rel := strings.TrimPrefix(tag.URL, "/")
+		for _, pg := range site.paginate(byTag[tag.Slug], rel) {
+			pagesPath, err := writeTempJSON("swb-tag-*.json", pg.Items)
+			if err != nil {
+				return err
+			}
+			env := append([]string{"taxonomy_tag=" + tag.Name, "taxonomy_pages=" + pagesPath}, pg.env(pagesPath)...)
+			err = write(site.pagePath(rel, pg.Page), &tag, pg, env...)
+			os.Remove(pagesPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	ents, err := site.readDir(filepath.Join(site.DstRoot, filepath.FromSlash(t.Path)))
+	if err != nil {
+		return err
+	}
+	for _, ent := range ents {
+		rel := path.Join(t.Path, ent.Name())
+		if ent.IsDir() {
+			// The next pages of a tag.
+			if err := config.removePages(site, rel+".html", written, outputs); err != nil {
+				return err
+			}
+			continue
+		}
+		if path.Ext(rel) != ".html" || written[rel] {
+			continue
+		}
+		dstPath := filepath.Join(site.DstRoot, filepath.FromSlash(rel))
+		if _, ok := outputs[dstPath]; ok {
+			continue
+		}
+		config.action(site, ActionRemove, dstPath, 0)
+		if err := site.remove(dstPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taxonomyEnv returns the environment of the commands of the taxonomy
+// template, rendering the page at dstPath.
+func (config *Config) taxonomyEnv(site *Site, dstPath string) []string {
+	base := filepath.Base(dstPath)
+	env := append(os.Environ(),
+		"page_name="+strings.TrimSuffix(base, filepath.Ext(base)),
+		"site_name="+site.Name,
+		"dst_path="+dstPath,
+		"page_rel_path="+site.rel(dstPath),
+	)
+	if site.index != "" {
+		env = append(env, "site_index="+site.index)
+	}
+	if len(site.Fingerprint) > 0 && site.Dst == nil {
+		env = append(env, "asset_manifest="+filepath.Join(site.DstRoot, AssetManifest))
+	}
+	return append(env, site.Env...)
+}
@@ -0,0 +1,398 @@
+package swb
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A tplChunk is a part of a template: static text, the commands of a block,
+// the ContentToken, or a directive (see parseDirectives).
+type tplChunk struct {
+	text    string
+	block   bool
+	content bool
+	// Indentation of the opening delimiter of a block, and the line of the
+	// chunk.
+	indent string
+	line   int
+	// Directive of the chunk: if, for, or $ for the value of the variable
+	// name. The body of a condition is rendered if the variable name
+	// compares to value with op, and the one of a loop for each line of
+	// the variable name, with the variable item set to it. alt is the body
+	// of the else of the directive.
+	directive string
+	name      string
+	op        string
+	value     string
+	item      string
+	body, alt []tplChunk
+}
+
+// A parsedTpl is a template read with its includes inlined and split in
+// chunks, or parsed for the Go engine. The templates are parsed once per
+// build (see loadTemplate).
+type parsedTpl struct {
+	// Paths of the files the template is made of, the template first.
+	files  []string
+	text   string
+	chunks []tplChunk
+	goTpl  *template.Template
+}
+
+// loadTemplate reads and parses the template at tplPath, and checks it (see
+// validateTemplate). During a build, a template is only loaded once.
+func (site *Site) loadTemplate(tplPath string) (*parsedTpl, error) {
+	if t, ok := site.templates[tplPath]; ok {
+		return t, nil
+	}
+	text, files, err := site.readTemplate(tplPath)
+	if err != nil {
+		return nil, err
+	}
+	t := &parsedTpl{files: files, text: text}
+	if site.Engine == EngineGo {
+		if t.goTpl, err = template.New(filepath.Base(tplPath)).Parse(text); err != nil {
+			return nil, err
+		}
+	} else {
+		if site.TemplateMode == TemplateStrict {
+			if err := site.validateFiles(files); err != nil {
+				return nil, err
+			}
+		}
+		// The files are scanned on their own first, so that the errors
+		// tell where they are.
+		for _, path := range files {
+			b, err := site.readFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := site.scanTemplate(path, string(b)); err != nil {
+				return nil, err
+			}
+		}
+		if t.chunks, err = site.scanTemplate(tplPath, text); err != nil {
+			return nil, err
+		}
+		if t.chunks, err = parseDirectives(tplPath, t.chunks); err != nil {
+			return nil, err
+		}
+	}
+	if site.templates != nil {
+		site.templates[tplPath] = t
+	}
+	return t, nil
+}
+
+// scanTemplate splits the template tpl, read from the file name, in chunks:
+// its blocks, and the static text around them, split by the ContentToken.
+// A block opens on a line beginning (after blanks) with the opening
+// delimiter, and closes on the next line beginning with the closing one,
+// whatever the quotes and braces of its commands. The indentation of the
+// opening delimiter is kept, for the output of the block. A delimiter
+// preceded by a backslash at the beginning of a line is literal (e.g.
+// \%{).
+func (site *Site) scanTemplate(name, tpl string) ([]tplChunk, error) {
+	open, close := site.delimiters()
+	var chunks []tplChunk
+	var text strings.Builder
+	// Line of the beginning of text.
+	textLine := 1
+	flush := func() {
+		for i, part := range strings.Split(text.String(), ContentToken) {
+			if i > 0 {
+				chunks = append(chunks, tplChunk{content: true})
+			}
+			if part != "" {
+				chunks = append(chunks, tplChunk{text: part, line: textLine})
+			}
+			textLine += strings.Count(part, "\n")
+		}
+		text.Reset()
+	}
+	lines := strings.SplitAfter(tpl, "\n")
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " \t")
+		indent := lines[i][:len(lines[i])-len(trimmed)]
+		if rest, ok := strings.CutPrefix(trimmed, `\`+open); ok {
+			text.WriteString(indent + open + rest)
+			continue
+		}
+		rest, ok := strings.CutPrefix(trimmed, open)
+		// An include directive may begin with the opening delimiter
+		// when it is a single character (e.g. ⟦i nav.html⟧).
+		if loc := site.includeRe().FindStringIndex(trimmed); loc != nil && loc[0] == 0 {
+			ok = false
+		}
+		if !ok {
+			text.WriteString(lines[i])
+			continue
+		}
+		flush()
+		start := i
+		// The commands of the strict blocks are plain arguments.
+		s := blockScanner{plain: site.TemplateMode == TemplateStrict}
+		var cmd strings.Builder
+		s.scan(rest)
+		cmd.WriteString(rest)
+		closed := false
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			trimmed := strings.TrimLeft(line, " \t")
+			if after, ok := strings.CutPrefix(trimmed, close); ok {
+				chunks = append(chunks, tplChunk{text: cmd.String(), block: true, indent: indent, line: start + 1})
+				text.WriteString(after)
+				textLine = i + 1
+				closed = true
+				break
+			}
+			if after, ok := strings.CutPrefix(trimmed, `\`+close); ok {
+				line = line[:len(line)-len(trimmed)] + close + after
+			}
+			s.scan(line)
+			cmd.WriteString(line)
+		}
+		if !closed {
+			return nil, fmt.Errorf("%s:%d:%d: unterminated %s %s block%s", name, start+1, len(indent)+1, open, close, s.hint())
+		}
+	}
+	flush()
+	return chunks, nil
+}
+
+// directiveRe matches the directives of the static text of the templates,
+// possibly escaped by a backslash: the conditions and the loops, their else
+// and end, and the values of the variables.
+var directiveRe = regexp.MustCompile(`\\?%(?:(if|for)[ \t]+([^%\n]*)|(else|end)|\$([A-Za-z_][A-Za-z0-9_]*))%`)
+
+// parseDirectives parses the directives of the static text of the chunks of
+// the template read from the file name, and returns its chunks with the
+// bodies of the conditions and the loops nested in them:
+//
+//	%if VAR%, %if !VAR%, %if VAR = value% or %if VAR != value%
+//	%for item in $VAR%
+//	%else%
+//	%end%
+//	%$VAR%
+//
+// A condition without an operator holds if the variable is not empty, and
+// the else of a loop is rendered if its list is empty. The lines of the
+// directives alone on their line are left out of the output.
+func parseDirectives(name string, chunks []tplChunk) ([]tplChunk, error) {
+	var root []tplChunk
+	// Open directives, and whether they are in their else.
+	var open []*tplChunk
+	var inAlt []bool
+	add := func(c tplChunk) {
+		switch n := len(open); {
+		case n == 0:
+			root = append(root, c)
+		case inAlt[n-1]:
+			open[n-1].alt = append(open[n-1].alt, c)
+		default:
+			open[n-1].body = append(open[n-1].body, c)
+		}
+	}
+	for _, c := range chunks {
+		if c.block || c.content {
+			add(c)
+			continue
+		}
+		last := 0
+		for _, m := range directiveRe.FindAllStringSubmatchIndex(c.text, -1) {
+			token := c.text[m[0]:m[1]]
+			start, end := m[0], m[1]
+			if token[0] != '\\' && (m[2] >= 0 || m[6] >= 0) {
+				start, end = ownLine(c.text, start, end)
+			}
+			if start > last {
+				add(tplChunk{text: c.text[last:start]})
+			}
+			last = end
+			line := c.line + strings.Count(c.text[:m[0]], "\n")
+			if token[0] == '\\' {
+				add(tplChunk{text: token[1:]})
+				continue
+			}
+			switch {
+			case m[2] >= 0:
+				d := tplChunk{directive: c.text[m[2]:m[3]], line: line}
+				if err := d.parseArgs(strings.TrimSpace(c.text[m[4]:m[5]])); err != nil {
+					return nil, fmt.Errorf("%s:%d: %s: %v", name, line, token, err)
+				}
+				open, inAlt = append(open, &d), append(inAlt, false)
+			case m[6] >= 0 && token == "%else%":
+				if len(open) == 0 || inAlt[len(open)-1] {
+					return nil, fmt.Errorf("%s:%d: %%else%% without %%if%% or %%for%%", name, line)
+				}
+				inAlt[len(open)-1] = true
+			case m[6] >= 0:
+				if len(open) == 0 {
+					return nil, fmt.Errorf("%s:%d: %%end%% without %%if%% or %%for%%", name, line)
+				}
+				d := open[len(open)-1]
+				open, inAlt = open[:len(open)-1], inAlt[:len(inAlt)-1]
+				add(*d)
+			default:
+				add(tplChunk{directive: "$", name: c.text[m[8]:m[9]], line: line})
+			}
+		}
+		if last < len(c.text) {
+			add(tplChunk{text: c.text[last:]})
+		}
+	}
+	if n := len(open); n > 0 {
+		return nil, fmt.Errorf("%s:%d: %%%s%% without %%end%%", name, open[n-1].line, open[n-1].directive)
+	}
+	return root, nil
+}
+
+// ownLine returns the bounds of the line of the directive at text[i:j],
+// with its newline, if the directive is alone on it, so that the line is
+// left out of the output like the ones of the blocks, or i and j.
+func ownLine(text string, i, j int) (int, int) {
+	start := strings.LastIndexByte(text[:i], '\n') + 1
+	rest := strings.TrimLeft(text[j:], " \t")
+	if strings.TrimLeft(text[start:i], " \t") != "" || !strings.HasPrefix(rest, "\n") {
+		return i, j
+	}
+	return start, len(text) - len(rest) + 1
+}
+
+// parseArgs parses the arguments of a condition or a loop.
+func (c *tplChunk) parseArgs(args string) error {
+	if c.directive == "for" {
+		f := strings.Fields(args)
+		if len(f) != 3 || f[1] != "in" || !strings.HasPrefix(f[2], "$") {
+			return fmt.Errorf("want %%for item in $VAR%%")
+		}
+		c.item, c.name = f[0], f[2][1:]
+		if !envNameRe.MatchString(c.item) {
+			return fmt.Errorf("invalid variable name %q", c.item)
+		}
+	} else {
+		name := args
+		for _, op := range []string{"!=", "="} {
+			if before, after, ok := strings.Cut(args, op); ok {
+				name, c.op = strings.TrimSpace(before), op
+				c.value = strings.Trim(strings.TrimSpace(after), `"'`)
+				break
+			}
+		}
+		if rest, ok := strings.CutPrefix(name, "!"); ok && c.op == "" {
+			name, c.op = strings.TrimSpace(rest), "!"
+		}
+		c.name = strings.TrimPrefix(name, "$")
+	}
+	if !envNameRe.MatchString(c.name) {
+		return fmt.Errorf("invalid variable name %q", c.name)
+	}
+	return nil
+}
+
+// holds reports whether the condition c holds with the environment env.
+func (c *tplChunk) holds(env []string) bool {
+	value, _ := envValue(env, c.name)
+	switch c.op {
+	case "!":
+		return value == ""
+	case "=":
+		return value == c.value
+	case "!=":
+		return value != c.value
+	}
+	return value != ""
+}
+
+// envPage returns the src path of the page whose commands get the
+// environment env, if any.
+func envPage(env []string) string {
+	if page, ok := envValue(env, "page_src_path"); ok {
+		return page
+	}
+	// The src_path of a page with a front matter is a copy of its body.
+	page, _ := envValue(env, "src_path")
+	return page
+}
+
+// envValue returns the value of the variable name in the environment env,
+// the last one of a variable overriding the others, and whether it is set.
+func envValue(env []string, name string) (string, bool) {
+	value, set := "", false
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, name+"="); ok {
+			value, set = v, true
+		}
+	}
+	return value, set
+}
+
+// A blockScanner follows the quotes and the braces of the commands of a
+// block, line by line, to tell why a block was not closed (e.g. an
+// unterminated quote). They do not keep a closing delimiter from closing
+// the block: the commands can hold unbalanced quotes (e.g. in a here
+// document).
+type blockScanner struct {
+	plain bool
+	quote byte
+	depth int
+}
+
+// scan scans a line of the commands of a block.
+func (s *blockScanner) scan(line string) {
+	if s.plain {
+		return
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case s.quote == '\'':
+			if c == '\'' {
+				s.quote = 0
+			}
+		case c == '\\':
+			i++
+		case s.quote == '"':
+			if c == '"' {
+				s.quote = 0
+			}
+		case c == '\'' || c == '"':
+			s.quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			// A comment, up to the end of the line.
+			return
+		case c == '{':
+			s.depth++
+		case c == '}' && s.depth > 0:
+			s.depth--
+		}
+	}
+}
+
+// hint tells why a block may not have been closed.
+func (s *blockScanner) hint() string {
+	switch {
+	case s.quote != 0:
+		return fmt.Sprintf(" (unterminated %c quote)", s.quote)
+	case s.depth > 0:
+		return " (unbalanced {)"
+	}
+	return ""
+}
+
+// indentLines prefixes the lines of s which are not empty with indent.
+func indentLines(s, indent string) string {
+	if indent == "" {
+		return s
+	}
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,179 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestScanTemplate checks the blocks found by the scanner in templates, and
+// the static text around them.
+func TestScanTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		tpl    string
+		blocks []string
+		texts  []string
+	}{
+		{
+			"here document",
+			"<p>\n%{\ncat <<EOF\nDon't panic\nEOF\n}%\n</p>\n",
+			[]string{"\ncat <<EOF\nDon't panic\nEOF\n"},
+			[]string{"<p>\n", "\n</p>\n"},
+		},
+		{
+			"quoted closing delimiter",
+			"%{\necho \"a }% b\"\n}%\n",
+			[]string{"\necho \"a }% b\"\n"},
+			[]string{"\n"},
+		},
+		{
+			"escaped closing delimiter",
+			"%{\ncat <<EOF\n\\}%\nEOF\n}%\n",
+			[]string{"\ncat <<EOF\n}%\nEOF\n"},
+			[]string{"\n"},
+		},
+		{
+			"escaped opening delimiter",
+			"  \\%{ not a block\n",
+			nil,
+			[]string{"  %{ not a block\n"},
+		},
+		{
+			"braces",
+			"%{\nf() {\n  echo f\n}\nf\n}%\n",
+			[]string{"\nf() {\n  echo f\n}\nf\n"},
+			[]string{"\n"},
+		},
+	}
+	site := &Site{Name: "site"}
+	for _, tt := range tests {
+		chunks, err := site.scanTemplate("site.tpl", tt.tpl)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var blocks, texts []string
+		for _, c := range chunks {
+			if c.block {
+				blocks = append(blocks, c.text)
+			} else {
+				texts = append(texts, c.text)
+			}
+		}
+		if !slices.Equal(blocks, tt.blocks) {
+			t.Errorf("%s: blocks %q, want %q", tt.name, blocks, tt.blocks)
+		}
+		if !slices.Equal(texts, tt.texts) {
+			t.Errorf("%s: texts %q, want %q", tt.name, texts, tt.texts)
+		}
+	}
+}
+
+// TestScanTemplateIndent checks that the indentation of the opening
+// delimiter of a block is kept.
+func TestScanTemplateIndent(t *testing.T) {
+	site := &Site{Name: "site"}
+	chunks, err := site.scanTemplate("site.tpl", "<ul>\n\t  %{\necho li\n}%\n</ul>\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(chunks, func(c tplChunk) bool { return c.block })
+	if i < 0 || chunks[i].indent != "\t  " || chunks[i].line != 2 {
+		t.Errorf("chunks %+v, want a block indented by %q on line 2", chunks, "\t  ")
+	}
+}
+
+// TestScanTemplateErrors checks the position and the hint of the errors of
+// the unterminated blocks.
+func TestScanTemplateErrors(t *testing.T) {
+	tests := []struct {
+		tpl string
+		err string
+	}{
+		{"<p>\n%{\necho a\n", "site.tpl:2:1: unterminated %{ }% block"},
+		{"<p>\n    %{\necho 'a\n", "site.tpl:2:5: unterminated %{ }% block (unterminated ' quote)"},
+		{"%{\nf() {\necho a\n", "site.tpl:1:1: unterminated %{ }% block (unbalanced {)"},
+		{"%{\necho a }%\n", "site.tpl:1:1: unterminated %{ }% block"},
+	}
+	site := &Site{Name: "site"}
+	for _, tt := range tests {
+		_, err := site.scanTemplate("site.tpl", tt.tpl)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("template %q: error %v, want %s", tt.tpl, err, tt.err)
+		}
+	}
+}
+
+// renderDirectives renders the directives of the template tpl, which has
+// no blocks, with the environment env.
+func renderDirectives(tpl string, env []string) (string, error) {
+	site := &Site{Name: "site"}
+	chunks, err := site.scanTemplate("site.tpl", tpl)
+	if err != nil {
+		return "", err
+	}
+	if chunks, err = parseDirectives("site.tpl", chunks); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	errs := new(Config).renderTo(context.Background(), site, &b, "site.tpl", chunks, env, "CONTENT")
+	return b.String(), errors.Join(errs...)
+}
+
+// TestDirectives checks the rendering of the conditions, the loops and the
+// values of the variables, nested in each other.
+func TestDirectives(t *testing.T) {
+	tests := []struct {
+		tpl  string
+		env  []string
+		want string
+	}{
+		{"%if draft%\nDRAFT\n%end%\n%content%\n", nil, "CONTENT\n"},
+		{"%if draft%\nDRAFT\n%end%\n%content%\n", []string{"draft=true"}, "DRAFT\nCONTENT\n"},
+		{"%if !date%no date%else%%$date%%end%\n", []string{"date=2024"}, "2024\n"},
+		{"%if kind = post%post%end%%if kind != post%page%end%\n", []string{"kind=post"}, "post\n"},
+		{"<ul>\n%for tag in $tags%\n<li>%$tag%</li>\n%end%\n</ul>\n", []string{"tags=go\nweb"}, "<ul>\n<li>go</li>\n<li>web</li>\n</ul>\n"},
+		{"%for tag in $tags%\n%$tag%\n%else%\nno tags\n%end%\n", nil, "no tags\n"},
+		{
+			"%for tag in $tags%\n%if tag = web%\n[%$tag%]\n%else%\n%$tag%\n%end%\n%end%\n",
+			[]string{"tags=go\nweb"},
+			"go\n[web]\n",
+		},
+		{"\\%if draft% and \\%end%\n", nil, "%if draft% and %end%\n"},
+	}
+	for _, tt := range tests {
+		got, err := renderDirectives(tt.tpl, tt.env)
+		if err != nil {
+			t.Errorf("template %q: %v", tt.tpl, err)
+		} else if got != tt.want {
+			t.Errorf("template %q with %q: %q, want %q", tt.tpl, tt.env, got, tt.want)
+		}
+	}
+}
+
+// TestDirectiveErrors checks the errors of the directives, and their
+// positions.
+func TestDirectiveErrors(t *testing.T) {
+	tests := []struct {
+		tpl string
+		err string
+	}{
+		{"<p>\n%if draft%\nDRAFT\n", "site.tpl:2: %if% without %end%"},
+		{"%for a in $list%\n%if a%\n%end%\n", "site.tpl:1: %for% without %end%"},
+		{"%if a%\n%end%\n%end%\n", "site.tpl:3: %end% without %if% or %for%"},
+		{"<p>\n%else%\n", "site.tpl:2: %else% without %if% or %for%"},
+		{"%if a%\n%else%\n%else%\n%end%\n", "site.tpl:3: %else% without %if% or %for%"},
+		{"\n\n%for tag of $tags%\n%end%\n", "site.tpl:3: %for tag of $tags%: want %for item in $VAR%"},
+		{"%if a-b%\n%end%\n", `site.tpl:1: %if a-b%: invalid variable name "a-b"`},
+		{"%{\necho\n}%\n%if a%\n", "site.tpl:4: %if% without %end%"},
+	}
+	for _, tt := range tests {
+		_, err := renderDirectives(tt.tpl, nil)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("template %q: error %v, want %s", tt.tpl, err, tt.err)
+		}
+	}
+}
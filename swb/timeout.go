@@ -0,0 +1,55 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// defaultCommandTimeout is the time a command run by a build may take, if
+// the configuration sets no commandTimeout.
+const defaultCommandTimeout = 10 * time.Minute
+
+// commandWaitDelay is the time the pipes of a killed command are left open
+// for, after which they are closed even if a child of the command (e.g. of
+// sh -c) still holds them.
+const commandWaitDelay = time.Second
+
+func (config *Config) validateCommandTimeout() error {
+	if config.CommandTimeout == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(config.CommandTimeout); err != nil || d <= 0 {
+		return fmt.Errorf("commandTimeout: %q is not a positive duration (e.g. \"30s\" or \"5m\")", config.CommandTimeout)
+	}
+	return nil
+}
+
+// commandTimeout returns the time a command run by a build may take.
+func (config *Config) commandTimeout() time.Duration {
+	d, err := time.ParseDuration(config.CommandTimeout)
+	if err != nil || d <= 0 {
+		return defaultCommandTimeout
+	}
+	return d
+}
+
+// commandContext returns the context of a command run to build a file (a
+// block, a builder, a transform or a filter), done once the command timeout
+// elapsed or when ctx is.
+func (config *Config) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, config.commandTimeout())
+}
+
+// runCommand runs cmd, created with the context ctx returned by
+// commandContext, and reports whether it was killed for taking too long.
+func (config *Config) runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.WaitDelay = commandWaitDelay
+	err := cmd.Run()
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %v (see commandTimeout)", config.commandTimeout())
+	}
+	return err
+}
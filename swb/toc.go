@@ -0,0 +1,145 @@
+package swb
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A TOC is the table of contents of the pages of a site, built from the
+// headings of their body, which get anchors. A page can disable it, or
+// enable it on a site without one, with the toc key of its front matter.
+type TOC struct {
+	// Levels of the headings listed, 2 to 3 by default (h2 and h3).
+	MinLevel int `json:"minLevel,omitempty" toml:"minLevel,omitempty" yaml:"minLevel,omitempty"`
+	MaxLevel int `json:"maxLevel,omitempty" toml:"maxLevel,omitempty" yaml:"maxLevel,omitempty"`
+}
+
+// validateTOC checks the site's table of contents, and sets its defaults.
+func (site *Site) validateTOC() error {
+	if site.TOC == nil {
+		return nil
+	}
+	site.TOC.setDefaults()
+	if site.TOC.MinLevel < 1 || site.TOC.MaxLevel > 6 || site.TOC.MinLevel > site.TOC.MaxLevel {
+		return fmt.Errorf("site %s: toc: invalid levels %d to %d (1 to 6)", site.Name, site.TOC.MinLevel, site.TOC.MaxLevel)
+	}
+	return nil
+}
+
+func (t *TOC) setDefaults() {
+	if t.MinLevel == 0 {
+		t.MinLevel = 2
+	}
+	if t.MaxLevel == 0 {
+		t.MaxLevel = max(3, t.MinLevel)
+	}
+}
+
+// A tocEntry is a heading of a page, in its table of contents.
+type tocEntry struct {
+	Level    int        `json:"level"`
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	Children []tocEntry `json:"children,omitempty"`
+}
+
+var (
+	tocHeadingRe = regexp.MustCompile(`(?is)<h([1-6])(\s[^>]*)?>(.*?)</h[1-6]>`)
+	tocIDRe      = regexp.MustCompile(`(?i)\sid\s*=\s*["']?([^"'\s>]+)`)
+)
+
+// pageTOC returns the table of contents of the pages with the front matter
+// fm, or nil if they have none.
+func (site *Site) pageTOC(fm map[string]any) *TOC {
+	switch v := fm["toc"].(type) {
+	case bool:
+		if !v {
+			return nil
+		}
+		if site.TOC == nil {
+			t := &TOC{}
+			t.setDefaults()
+			return t
+		}
+	}
+	return site.TOC
+}
+
+// tableOfContents adds anchors to the headings of the body of a page
+// without one, and returns the body and its table of contents, nested by
+// level.
+func (t *TOC) tableOfContents(body []byte) ([]byte, []tocEntry) {
+	var flat []tocEntry
+	ids := make(map[string]bool)
+	for _, m := range tocIDRe.FindAllSubmatch(body, -1) {
+		ids[string(m[1])] = true
+	}
+	body = tocHeadingRe.ReplaceAllFunc(body, func(h []byte) []byte {
+		m := tocHeadingRe.FindSubmatch(h)
+		level, _ := strconv.Atoi(string(m[1]))
+		title := plainText(string(m[3]))
+		var id string
+		if idm := tocIDRe.FindSubmatch(m[2]); idm != nil {
+			id = string(idm[1])
+		} else {
+			id = slug(title)
+			if id == "" {
+				id = "section"
+			}
+			for i, base := 1, id; ids[id]; i++ {
+				id = base + "-" + strconv.Itoa(i)
+			}
+			ids[id] = true
+			h = []byte(fmt.Sprintf("<h%d id=\"%s\"%s>%s</h%d>", level, id, m[2], m[3], level))
+		}
+		if level >= t.MinLevel && level <= t.MaxLevel {
+			flat = append(flat, tocEntry{Level: level, ID: id, Title: title})
+		}
+		return h
+	})
+	return body, nestTOC(flat)
+}
+
+// nestTOC nests the headings under the previous ones of a lower level.
+func nestTOC(flat []tocEntry) []tocEntry {
+	var entries []tocEntry
+	for len(flat) > 0 {
+		e := flat[0]
+		i := 1
+		for i < len(flat) && flat[i].Level > e.Level {
+			i++
+		}
+		e.Children = nestTOC(flat[1:i])
+		entries = append(entries, e)
+		flat = flat[i:]
+	}
+	return entries
+}
+
+// tocHTML returns the table of contents entries as nested HTML lists.
+func tocHTML(entries []tocEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<ul>")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "<li><a href=\"#%s\">%s</a>%s</li>", e.ID, html.EscapeString(e.Title), tocHTML(e.Children))
+	}
+	b.WriteString("</ul>")
+	return b.String()
+}
+
+// tocEnv returns the variables of the table of contents entries, for the
+// commands of the templates.
+func tocEnv(entries []tocEntry) ([]string, error) {
+	b, err := json.Marshal(nonNil(entries))
+	if err != nil {
+		return nil, err
+	}
+	return []string{"page_toc=" + tocHTML(entries), "page_toc_json=" + string(b)}, nil
+}
@@ -0,0 +1,49 @@
+package swb
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+)
+
+// validateUmask checks that the site's umask is an octal mode.
+func (site *Site) validateUmask() error {
+	if site.Umask == "" {
+		return nil
+	}
+	if _, err := strconv.ParseUint(site.Umask, 8, 9); err != nil {
+		return fmt.Errorf("site %s: umask: %q is not an octal mode (e.g. 022)", site.Name, site.Umask)
+	}
+	return nil
+}
+
+// umask returns the permissions removed from the files and directories
+// written in the dst tree, 022 if the site has none.
+func (site *Site) umask() fs.FileMode {
+	mask, err := strconv.ParseUint(site.Umask, 8, 9)
+	if err != nil {
+		return 022
+	}
+	return fs.FileMode(mask)
+}
+
+// fileMode returns the permissions of an output of the source having the
+// mode srcMode: the ones of the source (e.g. keeping a CGI script
+// executable), less the umask of the site if it has one.
+func (site *Site) fileMode(srcMode fs.FileMode) fs.FileMode {
+	if site.Umask == "" {
+		return srcMode.Perm()
+	}
+	return srcMode.Perm() &^ site.umask()
+}
+
+// newFileMode returns the permissions of the files generated by swb, which
+// have no source (e.g. the feed).
+func (site *Site) newFileMode() fs.FileMode {
+	return 0666 &^ site.umask()
+}
+
+// dirMode returns the permissions of the directories of the dst tree.
+func (site *Site) dirMode() fs.FileMode {
+	return 0777 &^ site.umask()
+}
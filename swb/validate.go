@@ -0,0 +1,86 @@
+package swb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// validate expands and checks the configuration, reporting all its problems
+// at once rather than the first one.
+func (config *Config) validate() error {
+	errs := []error{
+		config.expandPaths(),
+		config.validateRunCmd(),
+		config.validateBuilders(),
+		config.validatePostProcess(),
+		config.validateCommandTimeout(),
+	}
+	for _, site := range config.Sites {
+		errs = append(errs,
+			site.expandPaths(),
+			site.validateEngine(),
+			site.validateStrict(),
+			site.validateTransforms(),
+			site.validateDelimiters(),
+			site.validatePageChecks(),
+			site.validateLinkCheck(),
+			site.validateIgnore(),
+			site.validateRebuild(),
+			site.validateAssets(),
+			site.validateUmask(),
+			site.validatePermalinks(),
+			site.validateSitemap(),
+			site.validateFeed(),
+			site.validateSearch(),
+			site.validateTaxonomy(),
+			site.validatePageSize(),
+			site.validateRelated(),
+			site.validateTOC(),
+			site.validateRedirects(),
+			site.validateHighlight(),
+			site.validateMinify(),
+			site.validateImages(),
+			site.validatePrecompress(),
+			site.validateDeploy(),
+			site.validateHooks(),
+			site.validateBuildLog(),
+			site.validateLanguages(),
+		)
+	}
+	errs = append(errs, config.validateSites())
+	return errors.Join(errs...)
+}
+
+// validateSites checks that there is at least one site, and that the sites
+// have the required fields and unique names. Whether their src and dst
+// trees overlap is checked when they are built or cleaned (see
+// checkOverlap), so that it can be forced.
+func (config *Config) validateSites() error {
+	if len(config.Sites) == 0 {
+		return errors.New("sites: at least one site is required")
+	}
+	var errs []error
+	names := make(map[string]int)
+	for i, site := range config.Sites {
+		name := "site " + site.Name
+		if site.Name == "" {
+			name = fmt.Sprintf("sites[%d]", i)
+			errs = append(errs, fmt.Errorf("%s: name is required (e.g. \"example.com\")", name))
+		} else if j, ok := names[site.Name]; ok {
+			errs = append(errs, fmt.Errorf("%s: name is already the one of sites[%d], names must be unique", name, j))
+		} else {
+			names[site.Name] = i
+		}
+		fields := []struct{ name, path string }{
+			{"srcRoot", site.SrcRoot},
+			{"dstRoot", site.DstRoot},
+			{"tplPath", site.TplPath},
+		}
+		for _, field := range fields {
+			if field.path == "" {
+				errs = append(errs, fmt.Errorf("%s: %s is required", name, field.name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+package swb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// Kinds of the differences between the dst tree of a site and a build of
+// its src tree.
+const (
+	// DiffMissing is a file of the build which the dst tree does not have.
+	DiffMissing = "missing"
+	// DiffExtra is a file of the dst tree which the build does not have.
+	DiffExtra = "extra"
+	// DiffChanged is a file whose content or type differs.
+	DiffChanged = "changed"
+)
+
+// A Difference is a file of the dst tree of a site which is out of sync
+// with its src tree.
+type Difference struct {
+	// Path of the file relative to the root of the dst tree.
+	Path string
+	Kind string
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffMissing:
+		return d.Path + ": missing from the dst tree"
+	case DiffExtra:
+		return d.Path + ": not built from the src tree"
+	}
+	return d.Path + ": differs from the build"
+}
+
+// Verify builds the site into a temporary directory, and returns the files
+// of its dst tree which differ from this build, sorted by path. The dst
+// tree is left untouched, and the post-build hooks are not run. The
+// records of the builds (e.g. the manifest) and the kept files are not
+// compared.
+func (config *Config) Verify(ctx context.Context, site *Site) ([]Difference, error) {
+	tmp, err := os.MkdirTemp("", "swb-verify-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	fresh := *site
+	fresh.DstRoot, fresh.Dst, fresh.BuildLog = tmp, nil, ""
+	if site.Hooks != nil {
+		// The pre-build hooks may write files to build in the src tree.
+		fresh.Hooks = &Hooks{PreBuild: site.Hooks.PreBuild}
+	}
+	c := *config
+	c.Progress, c.DryRun, c.Force, c.Only, c.page = nil, false, true, nil, ""
+	if _, err := c.BuildSite(ctx, &fresh); err != nil {
+		return nil, err
+	}
+	built, err := verifyTree(&fresh)
+	if err != nil {
+		return nil, err
+	}
+	current, err := verifyTree(site)
+	if errors.Is(err, fs.ErrNotExist) {
+		current = map[string]string{}
+	} else if err != nil {
+		return nil, err
+	}
+	var diffs []Difference
+	for rel, sum := range built {
+		if cur, ok := current[rel]; !ok {
+			diffs = append(diffs, Difference{Path: rel, Kind: DiffMissing})
+		} else if cur != sum {
+			diffs = append(diffs, Difference{Path: rel, Kind: DiffChanged})
+		}
+	}
+	for rel := range current {
+		if _, ok := built[rel]; !ok {
+			diffs = append(diffs, Difference{Path: rel, Kind: DiffExtra})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+// verifyTree returns the hashes of the files of the dst tree of the site by
+// dst-relative path, or the targets of its symbolic links, leaving out the
+// records of the builds and the files kept by the site.
+func verifyTree(site *Site) (map[string]string, error) {
+	sums := make(map[string]string)
+	err := site.walkDst(func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(site.DstRoot, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if slices.Contains(records, rel) || matchAny(site.Keep, rel) {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := site.readlink(path)
+			if err != nil {
+				return err
+			}
+			sums[rel] = fmt.Sprintf("-> %s", target)
+			return nil
+		}
+		sums[rel], err = site.fileHash(path)
+		return err
+	})
+	return sums, err
+}
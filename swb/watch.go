@@ -0,0 +1,183 @@
+package swb
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is the time without any change after which the changed sites
+// are rebuilt, so that a burst of changes (e.g. a checkout) triggers a
+// single build.
+const watchDelay = 100 * time.Millisecond
+
+// Watch rebuilds the sites whenever their src tree or their template files
+// (see watchTemplates) change, until ctx is done. Since the builds are
+// incremental, only the affected files are rebuilt. built is called after
+// each build. If reloaded is not nil, the files of the configuration are
+// watched too: when they change, the configuration is reloaded (see
+// Reload), reloaded is called with its changes, and the sites added or
+// changed are built. An invalid configuration is reported, and the current
+// one is kept.
+func (config *Config) Watch(ctx context.Context, built func(site *Site, report Report, err error), reloaded func(changes []string, err error)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	// Template files of the sites by name, see watchTemplates.
+	tplFiles := make(map[string][]string)
+	if err := config.watchSites(w, tplFiles); err != nil {
+		return err
+	}
+	if reloaded != nil {
+		if err := config.watchConfig(w); err != nil {
+			return err
+		}
+	}
+	// Sites to rebuild by name, since a reload replaces them.
+	dirty := make(map[string]bool)
+	reload := false
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-w.Errors:
+			return err
+		case ev := <-w.Events:
+			if ev.Has(fsnotify.Create) {
+				// New directories of the src trees must be watched too.
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := watchTree(w, ev.Name); err != nil {
+						return err
+					}
+				}
+			}
+			if reloaded != nil && config.isConfigFile(ev.Name) {
+				reload = true
+			}
+			for _, site := range config.Sites {
+				if slices.Contains(tplFiles[site.Name], ev.Name) || under(ev.Name, filepath.Clean(site.SrcRoot)) {
+					dirty[site.Name] = true
+				}
+			}
+			if len(dirty) > 0 || reload {
+				timer.Reset(watchDelay)
+			}
+		case <-timer.C:
+			if reload {
+				reload = false
+				fresh, changes, err := config.Reload()
+				reloaded(changes, err)
+				if err == nil {
+					for _, site := range fresh.Sites {
+						if config.reloaded(fresh, site) {
+							dirty[site.Name] = true
+						}
+					}
+					*config = *fresh
+					clear(tplFiles)
+					if err := config.watchSites(w, tplFiles); err != nil {
+						return err
+					}
+					if err := config.watchConfig(w); err != nil {
+						return err
+					}
+				}
+			}
+			for _, site := range config.Sites {
+				if !dirty[site.Name] {
+					continue
+				}
+				report, err := config.BuildSite(ctx, site)
+				built(site, report, err)
+				// The templates may include other files now.
+				if tplFiles[site.Name], err = watchTemplates(w, site); err != nil {
+					return err
+				}
+			}
+			clear(dirty)
+		}
+	}
+}
+
+// watchSites adds the src trees of the sites to w, and the directories of
+// their template files, which it records in tplFiles by site name.
+func (config *Config) watchSites(w *fsnotify.Watcher, tplFiles map[string][]string) error {
+	for _, site := range config.Sites {
+		if err := watchTree(w, site.SrcRoot); err != nil {
+			return err
+		}
+		files, err := watchTemplates(w, site)
+		if err != nil {
+			return err
+		}
+		tplFiles[site.Name] = files
+	}
+	return nil
+}
+
+// watchTemplates adds to w the directories of the template files of the
+// site: the templates its pages can be built with (the ones next to its
+// template, see srcStamp) and its taxonomy template, with the files they
+// include. Editors often replace a file rather than writing it, so its
+// directory is watched. It returns the cleaned paths of the files.
+func watchTemplates(w *fsnotify.Watcher, site *Site) ([]string, error) {
+	tplDir := filepath.Dir(site.TplPath)
+	tplPaths := []string{site.TplPath}
+	ents, err := os.ReadDir(tplDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, ent := range ents {
+		if !ent.IsDir() {
+			tplPaths = append(tplPaths, filepath.Join(tplDir, ent.Name()))
+		}
+	}
+	if site.Taxonomy != nil {
+		tplPaths = append(tplPaths, site.Taxonomy.TplPath)
+	}
+	var files []string
+	for _, tplPath := range tplPaths {
+		// A template that cannot be read is watched on its own, the build
+		// reports it.
+		_, included, _ := site.readTemplate(tplPath)
+		for _, path := range append(included, tplPath) {
+			path = filepath.Clean(path)
+			if slices.Contains(files, path) {
+				continue
+			}
+			files = append(files, path)
+			if err := w.Add(filepath.Dir(path)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// watchTree adds every directory of the tree at root to w.
+func watchTree(w *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ent.IsDir() {
+			return w.Add(path)
+		}
+		return nil
+	})
+}
+
+// under reports whether path is in the tree at root.
+func under(path, root string) bool {
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
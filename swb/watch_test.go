@@ -0,0 +1,41 @@
+package swb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWatchInclude checks that a site is rebuilt when a file included by
+// its template changes.
+func TestWatchInclude(t *testing.T) {
+	config := fixtureSite(t, map[string]string{
+		"tpl/site.tpl":      "%i{../partials/nav.html}%\n%content%\n",
+		"partials/nav.html": "<nav>\n",
+		"src/index.md":      "# Home\n",
+	}, map[string]any{"tplPath": "tpl/site.tpl"})
+	dir := filepath.Dir(config.Sites[0].SrcRoot)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	builds := make(chan error, 1)
+	done := make(chan error)
+	go func() {
+		done <- config.Watch(ctx, func(site *Site, report Report, err error) { builds <- err }, nil)
+	}()
+	// Leave the watcher the time to start.
+	time.Sleep(100 * time.Millisecond)
+	writeFiles(t, dir, map[string]string{"partials/nav.html": "<nav class=\"top\">\n"})
+	select {
+	case err := <-builds:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("site not rebuilt after a change of an included file")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}